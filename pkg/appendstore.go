@@ -0,0 +1,321 @@
+package util
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	// appendLogFileName is the data file holding every record written by an appendStore.
+	appendLogFileName = "data.log"
+	// appendIndexFileName is the file holding the persisted offset index of an appendStore.
+	appendIndexFileName = "data.idx"
+	// recordHeaderSize is the size of the index and length header preceding each record.
+	recordHeaderSize = 12
+	// tombstoneLength is the length recorded in a header to mark the index as removed.
+	tombstoneLength = math.MaxUint32
+)
+
+// recordLocation is the position of a record's payload within the data file.
+type recordLocation struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// appendIndex is the persisted offset index of an appendStore, valid for the first Size bytes of the data file.
+type appendIndex struct {
+	Size    int64                  `json:"size"`
+	Records map[int]recordLocation `json:"records"`
+}
+
+// appendStore is a store that appends every record to a single data file and keeps an
+// in-memory index of record offsets. Each record is framed with its index and length so
+// the index can be rebuilt by scanning the data file; removals are appended as tombstones.
+type appendStore struct {
+	dir      string
+	dirMode  os.FileMode
+	fileMode os.FileMode
+	mutex    sync.Mutex
+	file     *os.File
+	size     int64
+	records  map[int]recordLocation
+	// syncWrites syncs the data file after every record is written
+	syncWrites bool
+}
+
+// newAppendStore creates an appendStore keeping its files in dir, created with the given modes.
+func newAppendStore(dir string, dirMode, fileMode os.FileMode) *appendStore {
+	return &appendStore{dir: dir, dirMode: dirMode, fileMode: fileMode}
+}
+
+func (s *appendStore) put(index int, data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(true); err != nil {
+		return err
+	}
+
+	if err := s.writeRecord(index, data, uint32(len(data))); err != nil {
+		return err
+	}
+
+	s.records[index] = recordLocation{Offset: s.size + recordHeaderSize, Length: int64(len(data))}
+	s.size += recordHeaderSize + int64(len(data))
+
+	return nil
+}
+
+func (s *appendStore) get(index int) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	loc, err := s.locate(index)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, loc.Length)
+	if _, err := s.file.ReadAt(data, loc.Offset); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *appendStore) remove(index int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(false); err != nil {
+		return err
+	}
+
+	if _, ok := s.records[index]; !ok {
+		return fmt.Errorf("record %d: %w", index, os.ErrNotExist)
+	}
+
+	if err := s.writeRecord(index, nil, tombstoneLength); err != nil {
+		return err
+	}
+
+	delete(s.records, index)
+	s.size += recordHeaderSize
+
+	return nil
+}
+
+func (s *appendStore) recordSize(index int) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(false); err != nil {
+		return 0, err
+	}
+
+	loc, ok := s.records[index]
+	if !ok {
+		return 0, fmt.Errorf("record %d: %w", index, os.ErrNotExist)
+	}
+
+	return recordHeaderSize + loc.Length, nil
+}
+
+func (s *appendStore) overhead() int64 {
+	return recordHeaderSize
+}
+
+func (s *appendStore) indexes() ([]int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(false); err != nil {
+		return nil, err
+	}
+
+	found := make([]int, 0, len(s.records))
+	for index := range s.records {
+		found = append(found, index)
+	}
+	sort.Ints(found)
+
+	return found, nil
+}
+
+func (s *appendStore) flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(appendIndex{Size: s.size, Records: s.records})
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(s.dir, appendIndexFileName), data, s.fileMode, true)
+}
+
+func (s *appendStore) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	s.records = nil
+	s.size = 0
+
+	return err
+}
+
+// locate returns the location of the record for index, loading the offset index if needed.
+func (s *appendStore) locate(index int) (recordLocation, error) {
+	if err := s.load(false); err != nil {
+		return recordLocation{}, err
+	}
+
+	loc, ok := s.records[index]
+	if !ok {
+		return recordLocation{}, fmt.Errorf("record %d: %w", index, os.ErrNotExist)
+	}
+
+	return loc, nil
+}
+
+// writeRecord writes a framed record at the end of the data file.
+func (s *appendStore) writeRecord(index int, data []byte, length uint32) error {
+	buf := make([]byte, recordHeaderSize+len(data))
+	binary.LittleEndian.PutUint64(buf[0:8], uint64(index))
+	binary.LittleEndian.PutUint32(buf[8:12], length)
+	copy(buf[recordHeaderSize:], data)
+
+	// Writing at our own offset rather than appending overwrites any torn record left by a crash
+	if _, err := s.file.WriteAt(buf, s.size); err != nil {
+		return fmt.Errorf("failed to write to disk: %w", err)
+	}
+	if s.syncWrites {
+		if err := syncFile(s.file); err != nil {
+			return fmt.Errorf("failed to sync to disk: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// load opens the data file and builds the offset index on first use. If create is false and
+// no data file exists yet, the store is left empty without creating anything on disk.
+func (s *appendStore) load(create bool) error {
+	if s.file != nil {
+		return nil
+	}
+	if s.records == nil {
+		s.records = make(map[int]recordLocation)
+	}
+
+	logPath := filepath.Join(s.dir, appendLogFileName)
+	flags := os.O_RDWR
+	if create {
+		if err := os.MkdirAll(s.dir, s.dirMode); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		flags |= os.O_CREATE
+	}
+
+	file, err := os.OpenFile(logPath, flags, s.fileMode)
+	if err != nil {
+		if !create && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to open data file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	// Start from the persisted index if it still describes the data file, then scan the rest
+	idx, err := s.readIndex()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if idx != nil && idx.Size <= info.Size() {
+		s.records = idx.Records
+		s.size = idx.Size
+	}
+	if s.records == nil {
+		s.records = make(map[int]recordLocation)
+	}
+
+	if err := s.scan(file, info.Size()); err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	return nil
+}
+
+// readIndex loads the persisted offset index, returning nil if none has been written.
+func (s *appendStore) readIndex() (*appendIndex, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, appendIndexFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read offset index: %w", err)
+	}
+
+	var idx appendIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal offset index: %w", err)
+	}
+
+	return &idx, nil
+}
+
+// scan reads the records from the current size to the end of the data file into the index.
+// A truncated record at the end of the file is ignored and will be overwritten by the next write.
+func (s *appendStore) scan(file *os.File, fileSize int64) error {
+	header := make([]byte, recordHeaderSize)
+
+	for s.size+recordHeaderSize <= fileSize {
+		if _, err := file.ReadAt(header, s.size); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to scan data file: %w", err)
+		}
+
+		index := int(binary.LittleEndian.Uint64(header[0:8]))
+		length := binary.LittleEndian.Uint32(header[8:12])
+
+		if length == tombstoneLength {
+			delete(s.records, index)
+			s.size += recordHeaderSize
+			continue
+		}
+
+		if s.size+recordHeaderSize+int64(length) > fileSize {
+			break
+		}
+
+		s.records[index] = recordLocation{Offset: s.size + recordHeaderSize, Length: int64(length)}
+		s.size += recordHeaderSize + int64(length)
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package util
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestDBList_AppendOnlyFile tests random access across thousands of records in a single data file.
+func TestDBList_AppendOnlyFile(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 10, WithAppendOnlyFile())
+
+	const count = 5000
+	for i := 0; i < count; i++ {
+		if err := list.Add(Item{ID: i}); err != nil {
+			t.Fatalf("Failed to add item: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != appendLogFileName {
+		t.Errorf("Expected only %s on disk, got %v", appendLogFileName, entries)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 1000; n++ {
+		i := r.Intn(count)
+		if item, err := list.Get(i); err != nil || item.ID != i {
+			t.Fatalf("Get(%d): expected ID %d, got %v, err %v", i, i, item, err)
+		}
+	}
+}
+
+// TestDBList_AppendOnlyFileReopen tests reopening an append-only list with and without a persisted index.
+func TestDBList_AppendOnlyFileReopen(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0, WithAppendOnlyFile())
+
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+	if err := list.Flush(); err != nil {
+		t.Fatalf("Failed to flush list: %v", err)
+	}
+
+	// Changes after the flush are recovered by scanning the tail of the data file
+	list.Add(Item{ID: 3})
+	if err := list.Delete(1); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+
+	reopened, err := OpenDBList[Item](tempDir, 0, WithAppendOnlyFile())
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+
+	expected := []int{0, 2, 3}
+	if got := reopened.Size(); got != len(expected) {
+		t.Fatalf("Expected size to be %d, got %d", len(expected), got)
+	}
+	for i, want := range expected {
+		if item, err := reopened.Get(i); err != nil || item.ID != want {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, want, item, err)
+		}
+	}
+}
+
+// TestDBList_AppendOnlyFileStorageMismatch tests that an append-only list cannot be reopened as
+// a list of files, which would not find its records, but can be with a memory-mapped file.
+func TestDBList_AppendOnlyFileStorageMismatch(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0, WithAppendOnlyFile())
+	list.Adds([]Item{{ID: 0}, {ID: 1}})
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close list: %v", err)
+	}
+
+	if _, err := OpenDBList[Item](tempDir, 0); !errors.Is(err, ErrStorageMismatch) {
+		t.Fatalf("Expected ErrStorageMismatch, got %v", err)
+	}
+
+	reopened, err := OpenDBList[Item](tempDir, 0, WithMemoryMappedFile())
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if size := reopened.Size(); size != 2 {
+		t.Errorf("Expected 2 items, got %d", size)
+	}
+}
+
+// TestAppendStore_TornRecord tests that a truncated trailing record is ignored and overwritten.
+func TestAppendStore_TornRecord(t *testing.T) {
+	tempDir := t.TempDir()
+	s := newAppendStore(tempDir, 0o750, 0o640)
+
+	if err := s.put(0, []byte("first")); err != nil {
+		t.Fatalf("Failed to put record: %v", err)
+	}
+	if err := s.put(1, []byte("second")); err != nil {
+		t.Fatalf("Failed to put record: %v", err)
+	}
+	s.file.Close()
+
+	// Simulate a crash partway through writing the second record
+	logPath := filepath.Join(tempDir, appendLogFileName)
+	if err := os.Truncate(logPath, recordHeaderSize+5+recordHeaderSize+2); err != nil {
+		t.Fatalf("Failed to truncate data file: %v", err)
+	}
+
+	s = newAppendStore(tempDir, 0o750, 0o640)
+	if found, err := s.indexes(); err != nil || len(found) != 1 || found[0] != 0 {
+		t.Fatalf("Expected only index 0 to survive, got %v, err %v", found, err)
+	}
+
+	if err := s.put(2, []byte("third")); err != nil {
+		t.Fatalf("Failed to put record: %v", err)
+	}
+	if data, err := s.get(2); err != nil || string(data) != "third" {
+		t.Errorf("Expected record to be readable, got %q, err %v", data, err)
+	}
+	if _, err := s.get(1); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected torn record to be missing, got err %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package util
+
+import (
+	"io"
+	"slices"
+	"sync"
+)
+
+// Backend stores the serialized records of the items that overflow from memory, in place of
+// the files in the disk path, so they can be kept in object storage or elsewhere. Records are
+// keyed by physical index. A Backend may be called from several goroutines at once.
+type Backend interface {
+	// Put stores data as the record for index, replacing any record already there.
+	Put(index int, data []byte) error
+	// Get returns the record for index, or an error wrapping fs.ErrNotExist if there is none.
+	Get(index int) ([]byte, error)
+	// Delete removes the record for index, or returns an error wrapping fs.ErrNotExist if
+	// there is none.
+	Delete(index int) error
+}
+
+// BackendLister may be implemented by a Backend to list the indexes it holds records for, in
+// any order. OpenDBList then finds every record; with a Backend alone it only looks for the
+// indexes up to the last one saved in the metadata.
+type BackendLister interface {
+	Indexes() ([]int, error)
+}
+
+// backendStore adapts a Backend to the store interface. It remembers the size of each record
+// it has seen, so keeping count of the bytes stored does not fetch records back.
+type backendStore[T any] struct {
+	list    *DBList[T]
+	backend Backend
+
+	mutex sync.Mutex
+	sizes map[int]int64
+}
+
+func newBackendStore[T any](list *DBList[T], backend Backend) *backendStore[T] {
+	return &backendStore[T]{list: list, backend: backend, sizes: make(map[int]int64)}
+}
+
+func (s *backendStore[T]) put(index int, data []byte) error {
+	if err := s.backend.Put(index, data); err != nil {
+		return err
+	}
+
+	s.setSize(index, int64(len(data)))
+	return nil
+}
+
+func (s *backendStore[T]) get(index int) ([]byte, error) {
+	data, err := s.backend.Get(index)
+	if err != nil {
+		return nil, err
+	}
+
+	s.setSize(index, int64(len(data)))
+	return data, nil
+}
+
+func (s *backendStore[T]) remove(index int) error {
+	err := s.backend.Delete(index)
+
+	s.mutex.Lock()
+	delete(s.sizes, index)
+	s.mutex.Unlock()
+
+	return err
+}
+
+func (s *backendStore[T]) recordSize(index int) (int64, error) {
+	s.mutex.Lock()
+	size, ok := s.sizes[index]
+	s.mutex.Unlock()
+	if ok {
+		return size, nil
+	}
+
+	data, err := s.get(index)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+func (s *backendStore[T]) overhead() int64 {
+	return 0
+}
+
+func (s *backendStore[T]) setSize(index int, size int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sizes[index] = size
+}
+
+func (s *backendStore[T]) indexes() ([]int, error) {
+	if lister, ok := s.backend.(BackendLister); ok {
+		found, err := lister.Indexes()
+		if err != nil {
+			return nil, err
+		}
+		found = slices.Clone(found)
+		slices.Sort(found)
+		return found, nil
+	}
+
+	var found []int
+	for index := range s.list.nextIndex {
+		if _, err := s.get(index); err == nil {
+			found = append(found, index)
+		}
+	}
+	return found, nil
+}
+
+func (s *backendStore[T]) flush() error {
+	return nil
+}
+
+// close closes the Backend if it is an io.Closer.
+func (s *backendStore[T]) close() error {
+	if closer, ok := s.backend.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// hasDisk reports whether items that do not fit in memory have somewhere to go.
+func (d *DBList[T]) hasDisk() bool {
+	return d.diskPath != "" || d.backend != nil
+}
+
+// derivedOptions returns the options for a new list made from this one, such as by Clone or
+// Filter, which keeps its records in its own disk path rather than sharing the Backend.
+func (d *DBList[T]) derivedOptions() options {
+	o := d.options
+	o.backend = nil
+	return o
+}
+
+// WithBackend stores the items that overflow from memory in backend instead of as files in the
+// disk path. The metadata and the write-ahead log are still kept in the disk path if there is
+// one; without one, the list can spill to the backend but cannot save its order. Lists made
+// from this one by Clone, Filter or Partition keep their records in their own disk paths.
+// WithAppendOnlyFile, WithMemoryMappedFile, WithPathMapper and the file names given by
+// WithKeyFunc do not apply.
+func WithBackend(backend Backend) Option {
+	return func(o *options) {
+		o.backend = backend
+	}
+}
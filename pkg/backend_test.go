@@ -0,0 +1,144 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// memoryBackend keeps records in a map.
+type memoryBackend struct {
+	mutex   sync.Mutex
+	records map[int][]byte
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{records: make(map[int][]byte)}
+}
+
+func (b *memoryBackend) Put(index int, data []byte) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.records[index] = append([]byte(nil), data...)
+	return nil
+}
+
+func (b *memoryBackend) Get(index int) ([]byte, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	data, ok := b.records[index]
+	if !ok {
+		return nil, fmt.Errorf("record %d: %w", index, os.ErrNotExist)
+	}
+	return data, nil
+}
+
+func (b *memoryBackend) Delete(index int) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, ok := b.records[index]; !ok {
+		return fmt.Errorf("record %d: %w", index, os.ErrNotExist)
+	}
+	delete(b.records, index)
+	return nil
+}
+
+func (b *memoryBackend) Indexes() ([]int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	indexes := make([]int, 0, len(b.records))
+	for index := range b.records {
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// TestDBList_WithBackend tests that items overflowing to a Backend are stored, read, updated,
+// deleted and reopened as they are with files.
+func TestDBList_WithBackend(t *testing.T) {
+	dir := t.TempDir()
+	backend := newMemoryBackend()
+	list := NewDBList[Item](dir, 1, WithBackend(backend))
+	list.Adds([]Item{{ID: 2}, {ID: 0}, {ID: 3}, {ID: 1}})
+
+	if got := len(backend.records); got != 3 {
+		t.Fatalf("Expected 3 records in the backend, got %d", got)
+	}
+	if entries, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(entries) != 0 {
+		t.Errorf("Expected no record files, got %v", entries)
+	}
+
+	list.Sort(itemLess)
+	if err := list.Update(3, Item{ID: 4}); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	if err := list.Delete(1); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, ok := backend.records[3]; ok {
+		t.Errorf("Expected the record of the deleted item to be removed")
+	}
+	if bytes := list.DiskBytes(); bytes <= 0 {
+		t.Errorf("Expected the backend records to be counted, got %d bytes", bytes)
+	}
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	reopened, err := OpenDBList[Item](dir, 1, WithBackend(backend))
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	values, err := reopened.Values()
+	if err != nil {
+		t.Fatalf("Failed to read values: %v", err)
+	}
+	expected := []Item{{ID: 0}, {ID: 2}, {ID: 4}}
+	if len(values) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, values)
+	}
+	for i := range expected {
+		if values[i] != expected[i] {
+			t.Errorf("Item %d: expected %v, got %v", i, expected[i], values[i])
+		}
+	}
+
+	// A clone keeps its records in its own disk path
+	clone, err := reopened.Clone(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to clone: %v", err)
+	}
+	if clone.backend != nil {
+		t.Errorf("Expected the clone not to share the backend")
+	}
+
+	if err := backend.Delete(2); err != nil {
+		t.Fatalf("Failed to delete record: %v", err)
+	}
+	if _, err := reopened.Get(2); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound for a missing record, got %v", err)
+	}
+}
+
+// TestDBList_WithBackendNoPath tests spilling to a Backend without a disk path.
+func TestDBList_WithBackendNoPath(t *testing.T) {
+	backend := newMemoryBackend()
+	list, err := NewDBListWithOptions[Item](WithMaxInMemory(1), WithBackend(backend))
+	if err != nil {
+		t.Fatalf("Failed to create list: %v", err)
+	}
+	if err := list.Adds([]Item{{ID: 0}, {ID: 1}}); err != nil {
+		t.Fatalf("Failed to add: %v", err)
+	}
+	if item, err := list.Get(1); err != nil || item.ID != 1 {
+		t.Errorf("Get(1): expected ID 1, got %v, err %v", item, err)
+	}
+}
@@ -0,0 +1,270 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// bufferedStore is a write-behind store that holds records in memory until limit of them
+// are pending, or a flush interval passes, then writes the batch to the inner store in the
+// background. Reads see records that are pending or still being written before falling
+// through to the inner store.
+type bufferedStore struct {
+	inner    store
+	limit    int
+	mutex    sync.Mutex
+	pending  map[int][]byte
+	flushing map[int][]byte
+	done     chan struct{}
+	err      error
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// newBufferedStore wraps inner with a write buffer of limit records. If interval is positive,
+// pending records are also written out every interval until the store is closed.
+func newBufferedStore(inner store, limit int, interval time.Duration) *bufferedStore {
+	s := &bufferedStore{
+		inner:   inner,
+		limit:   limit,
+		pending: make(map[int][]byte),
+	}
+
+	if interval > 0 {
+		s.stop = make(chan struct{})
+		s.stopped = make(chan struct{})
+		go s.flushEvery(interval)
+	}
+
+	return s
+}
+
+// flushEvery starts writing the pending records every interval until stop is closed. A failed
+// write returns its records to the pending set, so they are retried by the next flush.
+func (s *bufferedStore) flushEvery(interval time.Duration) {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mutex.Lock()
+			if len(s.pending) > 0 {
+				s.startFlush()
+			}
+			s.mutex.Unlock()
+		}
+	}
+}
+
+func (s *bufferedStore) put(index int, data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pending[index] = data
+	if len(s.pending) >= s.limit {
+		return s.startFlush()
+	}
+
+	return nil
+}
+
+func (s *bufferedStore) get(index int) ([]byte, error) {
+	s.mutex.Lock()
+	if data, ok := s.pending[index]; ok {
+		s.mutex.Unlock()
+		return data, nil
+	}
+	if data, ok := s.flushing[index]; ok {
+		s.mutex.Unlock()
+		return data, nil
+	}
+	s.mutex.Unlock()
+
+	return s.inner.get(index)
+}
+
+func (s *bufferedStore) remove(index int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Let any write of this index land before removing it from the inner store
+	if err := s.wait(); err != nil {
+		return err
+	}
+
+	_, wasPending := s.pending[index]
+	delete(s.pending, index)
+
+	err := s.inner.remove(index)
+	if wasPending && errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *bufferedStore) recordSize(index int) (int64, error) {
+	s.mutex.Lock()
+	if data, ok := s.pending[index]; ok {
+		s.mutex.Unlock()
+		return s.inner.overhead() + int64(len(data)), nil
+	}
+	if data, ok := s.flushing[index]; ok {
+		s.mutex.Unlock()
+		return s.inner.overhead() + int64(len(data)), nil
+	}
+	s.mutex.Unlock()
+
+	return s.inner.recordSize(index)
+}
+
+func (s *bufferedStore) overhead() int64 {
+	return s.inner.overhead()
+}
+
+func (s *bufferedStore) indexes() ([]int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.wait(); err != nil {
+		return nil, err
+	}
+
+	found, err := s.inner.indexes()
+	if err != nil {
+		return nil, err
+	}
+
+	for index := range s.pending {
+		if i := sort.SearchInts(found, index); i == len(found) || found[i] != index {
+			found = append(found, index)
+		}
+	}
+	sort.Ints(found)
+
+	return found, nil
+}
+
+func (s *bufferedStore) flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.pending) > 0 {
+		if err := s.startFlush(); err != nil {
+			return err
+		}
+	}
+	if err := s.wait(); err != nil {
+		return err
+	}
+
+	return s.inner.flush()
+}
+
+func (s *bufferedStore) close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.stopped
+		s.stop = nil
+	}
+
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	return s.inner.close()
+}
+
+// startFlush waits for any batch in flight, then starts writing the pending records in the background.
+func (s *bufferedStore) startFlush() error {
+	if err := s.wait(); err != nil {
+		return err
+	}
+
+	batch := s.pending
+	s.pending = make(map[int][]byte)
+	s.flushing = batch
+
+	done := make(chan struct{})
+	s.done = done
+	go func() {
+		s.err = writeBatch(s.inner, batch)
+		close(done)
+	}()
+
+	return nil
+}
+
+// wait blocks until the batch in flight, if any, has been written. If the write failed,
+// its records are returned to the pending set so a later flush retries them.
+func (s *bufferedStore) wait() error {
+	if s.done == nil {
+		return nil
+	}
+
+	<-s.done
+	err := s.err
+	if err != nil {
+		for index, data := range s.flushing {
+			if _, ok := s.pending[index]; !ok {
+				s.pending[index] = data
+			}
+		}
+	}
+
+	s.done = nil
+	s.flushing = nil
+	s.err = nil
+
+	return err
+}
+
+// writeBatch writes the records to the store using a pool of concurrent writers.
+func writeBatch(s store, batch map[int][]byte) error {
+	indexes := make(chan int)
+	errs := make(chan error, 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				if err := s.put(index, batch[index]); err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+				}
+			}
+		}()
+	}
+
+	ordered := make([]int, 0, len(batch))
+	for index := range batch {
+		ordered = append(ordered, index)
+	}
+	sort.Ints(ordered)
+
+	for _, index := range ordered {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,99 @@
+package util
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// TestDBList_WithWriteBuffer tests that buffered items are readable before and after reaching disk.
+func TestDBList_WithWriteBuffer(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 1, WithWriteBuffer(10))
+
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+
+	filePath, _ := list.filePathForIndex(2, false)
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Errorf("Expected buffered item not to be on disk yet, got err %v", err)
+	}
+	if item, err := list.Get(2); err != nil || item.ID != 2 {
+		t.Errorf("Expected buffered item 2, got %v, err %v", item, err)
+	}
+
+	if err := list.Flush(); err != nil {
+		t.Fatalf("Failed to flush list: %v", err)
+	}
+	if _, err := os.Stat(filePath); err != nil {
+		t.Errorf("Expected flushed item to be on disk, got err %v", err)
+	}
+	if item, err := list.Get(2); err != nil || item.ID != 2 {
+		t.Errorf("Expected flushed item 2, got %v, err %v", item, err)
+	}
+}
+
+// TestDBList_WithWriteBufferThreshold tests that filling the buffer writes it out without a Flush.
+func TestDBList_WithWriteBufferThreshold(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0, WithWriteBuffer(4))
+
+	for i := 0; i < 10; i++ {
+		if err := list.Add(Item{ID: i}); err != nil {
+			t.Fatalf("Failed to add item: %v", err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if item, err := list.Get(i); err != nil || item.ID != i {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, i, item, err)
+		}
+	}
+
+	// Deleting waits for the batch in flight, so the first batch is on disk afterwards
+	if err := list.Delete(9); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+	for i := 0; i < 8; i++ {
+		filePath, _ := list.filePathForIndex(i, false)
+		if _, err := os.Stat(filePath); err != nil {
+			t.Errorf("Expected item %d to be on disk, got err %v", i, err)
+		}
+	}
+
+	reopened, err := OpenDBList[Item](tempDir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if got := reopened.Size(); got != 8 {
+		t.Errorf("Expected 8 items written without a flush, got %d", got)
+	}
+}
+
+func BenchmarkDBList_AddsBuffered(b *testing.B) {
+	benchmarkAdds(b, WithWriteBuffer(1024))
+}
+
+// TestDBList_WithFlushInterval tests that buffered items reach disk on the timer without a Flush,
+// and that Close stops the background writer.
+func TestDBList_WithFlushInterval(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 0, WithWriteBuffer(100), WithFlushInterval(10*time.Millisecond))
+	list.Adds([]Item{{ID: 0}, {ID: 1}})
+
+	filePath, _ := list.filePathForIndex(1, false)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(filePath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected buffered item to reach disk on the timer")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if buffered := list.usage.store.(*bufferedStore); buffered.stop != nil {
+		t.Errorf("Expected Close to stop the background writer")
+	}
+}
@@ -0,0 +1,36 @@
+package util
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// ErrChecksumMismatch is returned when a disk record does not match the checksum stored with it.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// checksumSize is the length of the CRC32 prefixed to each record when checksums are enabled.
+const checksumSize = 4
+
+// addChecksum prefixes data with its CRC32.
+func addChecksum(data []byte) []byte {
+	out := make([]byte, checksumSize+len(data))
+	binary.BigEndian.PutUint32(out, crc32.ChecksumIEEE(data))
+	copy(out[checksumSize:], data)
+
+	return out
+}
+
+// verifyChecksum checks data produced by addChecksum and returns it without the prefix.
+func verifyChecksum(data []byte) ([]byte, error) {
+	if len(data) < checksumSize {
+		return nil, ErrChecksumMismatch
+	}
+
+	payload := data[checksumSize:]
+	if binary.BigEndian.Uint32(data) != crc32.ChecksumIEEE(payload) {
+		return nil, ErrChecksumMismatch
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,61 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// TestDBList_WithChecksum tests that a flipped byte in a disk record is reported as a checksum mismatch.
+func TestDBList_WithChecksum(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0, WithChecksum())
+	list.Adds([]Item{{ID: 1}, {ID: 2}})
+
+	if item, err := list.Get(1); err != nil || item.ID != 2 {
+		t.Fatalf("Expected ID 2, got %v, err %v", item, err)
+	}
+
+	filePath, _ := list.filePathForIndex(1, false)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read disk file: %v", err)
+	}
+	data[len(data)-2] ^= 0xff
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		t.Fatalf("Failed to write disk file: %v", err)
+	}
+
+	_, err = list.Get(1)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+	if !errors.Is(err, ErrCorruptRecord) {
+		t.Errorf("Expected ErrCorruptRecord, got %v", err)
+	}
+	if item, err := list.Get(0); err != nil || item.ID != 1 {
+		t.Errorf("Expected undamaged item to load, got %v, err %v", item, err)
+	}
+}
+
+// TestDBList_WithChecksumReopen tests that a reopened list verifies checksums without the option being passed again.
+func TestDBList_WithChecksumReopen(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0, WithChecksum())
+	list.Adds([]Item{{ID: 1}, {ID: 2}})
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close list: %v", err)
+	}
+
+	reopened, err := OpenDBList[Item](tempDir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if item, err := reopened.Get(1); err != nil || item.ID != 2 {
+		t.Errorf("Expected ID 2, got %v, err %v", item, err)
+	}
+
+	if _, err := verifyChecksum([]byte{1, 2}); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch for a short record, got %v", err)
+	}
+}
@@ -0,0 +1,457 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// chunkIndexFileName is the file holding the offset index of the records packed into chunks.
+	chunkIndexFileName = "chunks.idx"
+	// chunkFilePrefix and chunkFileExtension frame the number in the name of each chunk file.
+	chunkFilePrefix    = "chunk-"
+	chunkFileExtension = ".dat"
+)
+
+// chunkLocation is the position of a record's payload within a chunk file.
+type chunkLocation struct {
+	Chunk  int   `json:"chunk"`
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// chunkIndex is the persisted offset index of a chunkStore.
+type chunkIndex struct {
+	NextChunk int                   `json:"nextChunk"`
+	Records   map[int]chunkLocation `json:"records"`
+}
+
+// chunkStore wraps the file per record store so that CompactToChunks can pack records into
+// chunk files of many records each. Packed records are read from their chunk until they are
+// written again, which puts them back in a file of their own, or removed. The offset index is
+// rewritten whenever it changes, and a chunk file is deleted once none of its records are left.
+type chunkStore struct {
+	store
+	dir      string
+	fileMode os.FileMode
+	handles  *fileHandles
+
+	mutex     sync.Mutex
+	loaded    bool
+	nextChunk int
+	records   map[int]chunkLocation
+	live      map[int]int
+}
+
+// newChunkStore wraps inner, keeping the chunk files in dir, created with fileMode, and up
+// to maxOpenFiles of them open for reading.
+func newChunkStore(inner store, dir string, fileMode os.FileMode, maxOpenFiles int) *chunkStore {
+	return &chunkStore{store: inner, dir: dir, fileMode: fileMode, handles: newFileHandles(maxOpenFiles)}
+}
+
+func (s *chunkStore) put(index int, data []byte) error {
+	if err := s.store.put(index, data); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, ok := s.records[index]; !ok {
+		return nil
+	}
+
+	return s.drop(index)
+}
+
+func (s *chunkStore) get(index int) ([]byte, error) {
+	s.mutex.Lock()
+	if err := s.load(); err != nil {
+		s.mutex.Unlock()
+		return nil, err
+	}
+	loc, ok := s.records[index]
+	s.mutex.Unlock()
+
+	if !ok {
+		return s.store.get(index)
+	}
+
+	return s.read(loc)
+}
+
+func (s *chunkStore) remove(index int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, ok := s.records[index]; !ok {
+		return s.store.remove(index)
+	}
+
+	return s.drop(index)
+}
+
+func (s *chunkStore) recordSize(index int) (int64, error) {
+	s.mutex.Lock()
+	if err := s.load(); err != nil {
+		s.mutex.Unlock()
+		return 0, err
+	}
+	loc, ok := s.records[index]
+	s.mutex.Unlock()
+
+	if !ok {
+		return s.store.recordSize(index)
+	}
+
+	return loc.Length, nil
+}
+
+func (s *chunkStore) indexes() ([]int, error) {
+	found, err := s.store.indexes()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	for index := range s.records {
+		found = append(found, index)
+	}
+	slices.Sort(found)
+
+	return slices.Compact(found), nil
+}
+
+func (s *chunkStore) close() error {
+	err := s.handles.closeAll()
+	if closeErr := s.store.close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// pack rewrites the records for indexes, in that order, into new chunk files of up to perChunk
+// records each, then deletes the files they were in. Each chunk is written out before the next
+// is read, so only one chunk is held in memory. If a chunk cannot be written, the chunks
+// already written are deleted and the records are left where they were.
+func (s *chunkStore) pack(indexes []int, perChunk int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	records := make(map[int]chunkLocation, len(indexes))
+	live := make(map[int]int)
+	next := s.nextChunk
+	err := func() error {
+		for batch := range slices.Chunk(indexes, perChunk) {
+			var buf []byte
+			for _, index := range batch {
+				data, err := s.locked(index)
+				if err != nil {
+					return fmt.Errorf("failed to read from disk: %w", err)
+				}
+				records[index] = chunkLocation{Chunk: next, Offset: int64(len(buf)), Length: int64(len(data))}
+				buf = append(buf, data...)
+			}
+
+			live[next] = len(batch)
+			if err := writeFileAtomic(s.chunkPath(next), buf, s.fileMode, true); err != nil {
+				return fmt.Errorf("failed to write chunk: %w", err)
+			}
+			next++
+		}
+		return nil
+	}()
+	if err != nil {
+		for chunk := range live {
+			s.removeChunk(chunk)
+		}
+		return err
+	}
+
+	oldRecords, oldLive := s.records, s.live
+	s.records, s.live, s.nextChunk = records, live, next
+	if err := s.saveIndex(); err != nil {
+		s.records, s.live = oldRecords, oldLive
+		for chunk := range live {
+			s.removeChunk(chunk)
+		}
+		return err
+	}
+
+	// The records are now read from the new chunks, so where they were before can go. If this
+	// is cut short, the leftover files are dropped from the index when it is next loaded
+	for _, index := range indexes {
+		if _, ok := oldRecords[index]; ok {
+			continue
+		}
+		if err := s.store.remove(index); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete from disk: %w", err)
+		}
+	}
+	for chunk := range oldLive {
+		if err := s.removeChunk(chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unpack moves every packed record back into a file of its own and deletes the chunk files.
+func (s *chunkStore) unpack() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if len(s.records) == 0 {
+		return nil
+	}
+
+	for index, loc := range s.records {
+		data, err := s.read(loc)
+		if err != nil {
+			return fmt.Errorf("failed to read from disk: %w", err)
+		}
+		if err := s.store.put(index, data); err != nil {
+			return err
+		}
+	}
+
+	clear(s.records)
+	if err := s.saveIndex(); err != nil {
+		return err
+	}
+
+	for chunk := range s.live {
+		delete(s.live, chunk)
+		if err := s.removeChunk(chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// locked reads the record for index while the lock is held.
+func (s *chunkStore) locked(index int) ([]byte, error) {
+	if loc, ok := s.records[index]; ok {
+		return s.read(loc)
+	}
+	return s.store.get(index)
+}
+
+// read returns the payload at loc.
+func (s *chunkStore) read(loc chunkLocation) ([]byte, error) {
+	file, release, err := s.handles.acquire(s.chunkPath(loc.Chunk))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	data := make([]byte, loc.Length)
+	if _, err := file.ReadAt(data, loc.Offset); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// drop removes the record for index from its chunk, deleting the chunk file if it was the
+// last record in it. The caller must hold the lock.
+func (s *chunkStore) drop(index int) error {
+	chunk := s.records[index].Chunk
+	delete(s.records, index)
+	s.live[chunk]--
+
+	if err := s.saveIndex(); err != nil {
+		return err
+	}
+
+	if s.live[chunk] > 0 {
+		return nil
+	}
+	delete(s.live, chunk)
+
+	return s.removeChunk(chunk)
+}
+
+// removeChunk deletes the chunk file numbered chunk, closing it first if it is open.
+func (s *chunkStore) removeChunk(chunk int) error {
+	path := s.chunkPath(chunk)
+	s.handles.forget(path)
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete chunk: %w", err)
+	}
+
+	return nil
+}
+
+// load reads the offset index on first use. A record that also has a file of its own was
+// written after it was packed, or packing was cut short after the index was saved, so the file
+// is kept and the chunk forgotten.
+func (s *chunkStore) load() error {
+	if s.loaded {
+		return nil
+	}
+
+	s.records = make(map[int]chunkLocation)
+	s.live = make(map[int]int)
+
+	data, err := os.ReadFile(filepath.Join(s.dir, chunkIndexFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			s.loaded = true
+			return nil
+		}
+		return fmt.Errorf("failed to read chunk index: %w", err)
+	}
+
+	var idx chunkIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return fmt.Errorf("failed to unmarshal chunk index: %w", err)
+	}
+
+	files, err := s.store.indexes()
+	if err != nil {
+		return err
+	}
+	for _, index := range files {
+		delete(idx.Records, index)
+	}
+
+	s.nextChunk = idx.NextChunk
+	for index, loc := range idx.Records {
+		s.records[index] = loc
+		s.live[loc.Chunk]++
+	}
+	s.loaded = true
+
+	return nil
+}
+
+// saveIndex writes the offset index, or deletes it once no records are left in chunks. The
+// caller must hold the lock.
+func (s *chunkStore) saveIndex() error {
+	indexPath := filepath.Join(s.dir, chunkIndexFileName)
+	if len(s.records) == 0 {
+		if err := os.Remove(indexPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete chunk index: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(chunkIndex{NextChunk: s.nextChunk, Records: s.records})
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(indexPath, data, s.fileMode, true); err != nil {
+		return fmt.Errorf("failed to write chunk index: %w", err)
+	}
+
+	return nil
+}
+
+// chunkPath returns the path of the chunk file numbered chunk.
+func (s *chunkStore) chunkPath(chunk int) string {
+	return filepath.Join(s.dir, chunkFilePrefix+strconv.Itoa(chunk)+chunkFileExtension)
+}
+
+// isChunkFileName reports whether name is that of a file kept by a chunkStore.
+func isChunkFileName(name string) bool {
+	if name == chunkIndexFileName {
+		return true
+	}
+
+	number, ok := strings.CutPrefix(name, chunkFilePrefix)
+	if !ok {
+		return false
+	}
+	number, ok = strings.CutSuffix(number, chunkFileExtension)
+	if !ok {
+		return false
+	}
+	_, err := strconv.Atoi(number)
+	return err == nil
+}
+
+// CompactToChunks packs the records of the items on disk into chunk files holding up to
+// recordsPerChunk records each, in sorted order, with an offset index beside them, so a list
+// fragmented by many adds and deletes is left with a few large files instead of one per item.
+// Reads find packed records transparently. An item written again afterwards, such as by Update,
+// goes back to a file of its own, as does every packed record when Compact renumbers them, and
+// calling CompactToChunks again repacks everything. It needs the default file per record store.
+func (d *DBList[T]) CompactToChunks(recordsPerChunk int) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return err
+	}
+	if recordsPerChunk <= 0 {
+		return fmt.Errorf("invalid records per chunk %d", recordsPerChunk)
+	}
+	if !d.hasDisk() {
+		return d.errNoDisk()
+	}
+	if d.chunks == nil {
+		return errors.New("CompactToChunks needs the default file per record store")
+	}
+	d.waitForWrites()
+
+	if err := d.disk.flush(); err != nil {
+		return err
+	}
+
+	found, err := d.disk.indexes()
+	if err != nil {
+		return err
+	}
+
+	// Records in sorted order come first, so iterating reads through each chunk in turn;
+	// any left behind by items no longer in the list follow, as Compact deals with those
+	stored := make(map[int]bool, len(found))
+	for _, index := range found {
+		stored[index] = true
+	}
+	order := make([]int, 0, len(found))
+	for _, index := range d.sortedIndexes {
+		if stored[index] {
+			order = append(order, index)
+			delete(stored, index)
+		}
+	}
+	for _, index := range found {
+		if stored[index] {
+			order = append(order, index)
+		}
+	}
+
+	return d.chunks.pack(order, recordsPerChunk)
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestDBList_CompactToChunks tests that packing a fragmented list into chunks leaves one file
+// per chunk, and that reads, updates, reopening and deletes still find the packed records.
+func TestDBList_CompactToChunks(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0)
+
+	for i := range 12 {
+		list.Add(Item{ID: i})
+	}
+	// Deleting every third item leaves gaps in the physical indexes
+	for pos := 9; pos >= 0; pos -= 3 {
+		if err := list.Delete(pos); err != nil {
+			t.Fatalf("Failed to delete item %d: %v", pos, err)
+		}
+	}
+	want, _ := list.Values()
+
+	if err := list.CompactToChunks(3); err != nil {
+		t.Fatalf("Failed to compact to chunks: %v", err)
+	}
+
+	records, _ := filepath.Glob(filepath.Join(tempDir, "*.json"))
+	chunks, _ := filepath.Glob(filepath.Join(tempDir, "chunk-*.dat"))
+	if len(records) != 0 || len(chunks) != 3 {
+		t.Errorf("Expected 3 chunk files and no records, got %v and %v", chunks, records)
+	}
+
+	if got, err := list.Values(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v after packing, got %v, err %v", want, got, err)
+	}
+	if item, err := list.Get(4); err != nil || item != want[4] {
+		t.Errorf("Expected %v at 4, got %v, err %v", want[4], item, err)
+	}
+
+	// An updated item moves back to a file of its own
+	if err := list.Update(0, Item{ID: 100}); err != nil {
+		t.Fatalf("Failed to update item: %v", err)
+	}
+	want[0] = Item{ID: 100}
+	if records, _ := filepath.Glob(filepath.Join(tempDir, "*.json")); len(records) != 1 {
+		t.Errorf("Expected the updated record in its own file, got %v", records)
+	}
+
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close list: %v", err)
+	}
+	reopened, err := OpenDBList[Item](tempDir, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen list: %v", err)
+	}
+	if got, err := reopened.Values(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v after reopening, got %v, err %v", want, got, err)
+	}
+
+	// Compact moves the packed records back to files as it renumbers them
+	if err := reopened.Compact(); err != nil {
+		t.Fatalf("Failed to compact list: %v", err)
+	}
+	if got, err := reopened.Values(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v after Compact, got %v, err %v", want, got, err)
+	}
+
+	if err := reopened.CompactToChunks(4); err != nil {
+		t.Fatalf("Failed to compact to chunks again: %v", err)
+	}
+	if err := reopened.Clear(); err != nil {
+		t.Fatalf("Failed to clear list: %v", err)
+	}
+	entries, _ := os.ReadDir(tempDir)
+	for _, entry := range entries {
+		if isChunkFileName(entry.Name()) {
+			t.Errorf("Expected the chunk files to be deleted with their records, found %s", entry.Name())
+		}
+	}
+}
+
+// TestDBList_CompactToChunksErrors tests the lists and arguments CompactToChunks rejects.
+func TestDBList_CompactToChunksErrors(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 0)
+	if err := list.CompactToChunks(0); err == nil {
+		t.Errorf("Expected error for zero records per chunk")
+	}
+
+	appendOnly := NewDBList[Item](t.TempDir(), 0, WithAppendOnlyFile())
+	if err := appendOnly.CompactToChunks(4); err == nil {
+		t.Errorf("Expected error for an append-only list")
+	}
+
+	if err := NewDBList[Item]("", 0).CompactToChunks(4); err == nil {
+		t.Errorf("Expected error for a list without a disk path")
+	}
+}
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Codec serializes and deserializes items stored on disk.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec is a Codec backed by encoding/json. It is the default Codec.
+type JSONCodec struct{}
+
+// Marshal encodes v as JSON.
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes JSON data into v.
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// RawBytesCodec is a Codec for lists of []byte, or of types whose underlying type is []byte,
+// that stores each item's bytes as they are rather than base64-encoded in JSON. It cannot
+// encode anything else, including the records written by AddWithMeta.
+type RawBytesCodec struct{}
+
+// Marshal returns a copy of the bytes of v.
+func (RawBytesCodec) Marshal(v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || !isByteSlice(rv.Type()) {
+		return nil, fmt.Errorf("RawBytesCodec cannot encode a %T", v)
+	}
+
+	return append([]byte(nil), rv.Bytes()...), nil
+}
+
+// Unmarshal sets the byte slice v points to to a copy of data.
+func (RawBytesCodec) Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || !isByteSlice(rv.Type().Elem()) {
+		return fmt.Errorf("RawBytesCodec cannot decode into a %T", v)
+	}
+
+	rv.Elem().SetBytes(append([]byte(nil), data...))
+	return nil
+}
+
+// isByteSlice reports whether typ is a slice of bytes.
+func isByteSlice(typ reflect.Type) bool {
+	return typ != nil && typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8
+}
@@ -0,0 +1,99 @@
+package util
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// gobCodec is a Codec backed by encoding/gob used to exercise WithCodec.
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// TestDBList_WithCodec tests that a custom codec is used for disk storage.
+func TestDBList_WithCodec(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 1, WithCodec(gobCodec{}))
+
+	items := []Item{{ID: 1}, {ID: 2}}
+	list.Adds(items)
+
+	filePath, _ := list.filePathForIndex(1, false)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read disk file: %v", err)
+	}
+
+	var decoded Item
+	if err := (gobCodec{}).Unmarshal(data, &decoded); err != nil || decoded != items[1] {
+		t.Errorf("Expected disk file to be gob encoded, got %q, err %v", data, err)
+	}
+
+	if item, err := list.Get(1); err != nil || !reflect.DeepEqual(item, items[1]) {
+		t.Errorf("Failed to retrieve item from disk: expected %v, got %v, err %v", items[1], item, err)
+	}
+}
+
+// TestJSONCodec tests that JSONCodec round-trips values.
+func TestJSONCodec(t *testing.T) {
+	data, err := JSONCodec{}.Marshal(Item{ID: 7})
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	if string(data) != `{"ID":7}` {
+		t.Errorf("Expected JSON encoding, got %s", data)
+	}
+
+	var item Item
+	if err := (JSONCodec{}).Unmarshal(data, &item); err != nil || item.ID != 7 {
+		t.Errorf("Expected ID 7, got %v, err %v", item, err)
+	}
+}
+
+type blob []byte
+
+// TestRawBytesCodec tests that large byte blobs are stored on disk byte for byte and read back intact.
+func TestRawBytesCodec(t *testing.T) {
+	blobs := make([][]byte, 3)
+	for i := range blobs {
+		blobs[i] = bytes.Repeat([]byte{byte(i), 0xff, 0x00, '"'}, 64<<10)
+	}
+
+	list := NewDBList[[]byte](t.TempDir(), 1, WithCodec(RawBytesCodec{}))
+	list.Adds(blobs)
+
+	for i, want := range blobs {
+		if got, err := list.Get(i); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Get(%d): expected %d bytes back, got %d, err %v", i, len(want), len(got), err)
+		}
+	}
+
+	// The record is the blob itself, with no base64 or JSON quoting
+	filePath, _ := list.filePathForIndex(2, false)
+	if data, err := os.ReadFile(filePath); err != nil || !bytes.Equal(data, blobs[2]) {
+		t.Errorf("Expected the raw %d bytes on disk, got %d, err %v", len(blobs[2]), len(data), err)
+	}
+
+	named := NewDBList[blob](t.TempDir(), 0, WithCodec(RawBytesCodec{}))
+	named.Add(blob("named"))
+	if got, err := named.Get(0); err != nil || string(got) != "named" {
+		t.Errorf("Expected a named byte slice type back, got %q, err %v", got, err)
+	}
+
+	if err := NewDBList[Item](t.TempDir(), 0, WithCodec(RawBytesCodec{})).Add(Item{ID: 1}); err == nil {
+		t.Errorf("Expected an error encoding a struct")
+	}
+}
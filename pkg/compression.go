@@ -0,0 +1,43 @@
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// Compression selects how items are compressed before being stored on disk.
+type Compression int
+
+const (
+	// NoCompression stores items as produced by the Codec. It is the default.
+	NoCompression Compression = iota
+	// Gzip compresses items with gzip and stores them in .json.gz files.
+	Gzip
+)
+
+// gzipCompress compresses data with gzip.
+func gzipCompress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// gzipDecompress decompresses gzip data.
+func gzipDecompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
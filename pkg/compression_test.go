@@ -0,0 +1,68 @@
+package util
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+type Document struct {
+	ID   int
+	Body string
+}
+
+// TestDBList_WithCompression tests that compressed files are smaller and round-trip correctly.
+func TestDBList_WithCompression(t *testing.T) {
+	plainDir := t.TempDir()
+	compressedDir := t.TempDir()
+
+	doc := Document{ID: 1, Body: strings.Repeat("lorem ipsum dolor sit amet ", 200)}
+
+	plain := NewDBList[Document](plainDir, 0)
+	plain.Add(doc)
+	compressed := NewDBList[Document](compressedDir, 0, WithCompression(Gzip))
+	compressed.Add(doc)
+
+	plainPath, _ := plain.filePathForIndex(0, false)
+	compressedPath, _ := compressed.filePathForIndex(0, false)
+	if !strings.HasSuffix(compressedPath, "0.json.gz") {
+		t.Errorf("Expected compressed file to end in .json.gz, got %s", compressedPath)
+	}
+
+	plainInfo, err := os.Stat(plainPath)
+	if err != nil {
+		t.Fatalf("Failed to stat plain file: %v", err)
+	}
+	compressedInfo, err := os.Stat(compressedPath)
+	if err != nil {
+		t.Fatalf("Failed to stat compressed file: %v", err)
+	}
+	if compressedInfo.Size()*4 > plainInfo.Size() {
+		t.Errorf("Expected compressed file to be much smaller, got %d vs %d bytes", compressedInfo.Size(), plainInfo.Size())
+	}
+
+	if got, err := compressed.Get(0); err != nil || got != doc {
+		t.Errorf("Failed to retrieve compressed item, got %v, err %v", got.ID, err)
+	}
+}
+
+// TestDBList_WithCompressionReopen tests that a reopened list picks up compression from its metadata.
+func TestDBList_WithCompressionReopen(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 1, WithCompression(Gzip))
+	list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}})
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close list: %v", err)
+	}
+
+	reopened, err := OpenDBList[Item](tempDir, 1)
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if got := reopened.Size(); got != 3 {
+		t.Fatalf("Expected size to be 3, got %d", got)
+	}
+	if item, err := reopened.Get(2); err != nil || item.ID != 3 {
+		t.Errorf("Expected item 3, got %v, err %v", item, err)
+	}
+}
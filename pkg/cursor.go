@@ -0,0 +1,101 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrCursorInvalid is reported by Cursor.Err once the list has been compacted or cleared since
+// the cursor was created.
+var ErrCursorInvalid = errors.New("cursor invalidated by Compact or Clear")
+
+// Cursor steps back and forth through the items of a DBList in sorted order. It works over a
+// copy of the sort order taken when it was created, so adding, removing or reordering items
+// does not move it; items removed since then are skipped, and items added are not seen. The
+// copy refers to items by physical index, which Compact and Clear give to other items, so once
+// either has run the cursor stops, reporting false, and Err returns ErrCursorInvalid. A Cursor
+// is not safe for concurrent use.
+type Cursor[T any] struct {
+	list       *DBList[T]
+	order      []int
+	pos        int
+	renumbered int
+	err        error
+}
+
+// Cursor returns a Cursor positioned before the first item.
+func (d *DBList[T]) Cursor() *Cursor[T] {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return &Cursor[T]{list: d, order: slices.Clone(d.sortedIndexes), renumbered: d.renumbered}
+}
+
+// Err returns the error that stopped the cursor: ErrClosed once the list is closed, or
+// ErrCursorInvalid once it has been compacted or cleared. It is nil while the cursor is usable,
+// including when Next or Prev report false for reaching an end.
+func (c *Cursor[T]) Err() error {
+	return c.err
+}
+
+// Next advances to the next item and returns it, or reports false once there are no more.
+func (c *Cursor[T]) Next() (T, bool) {
+	return c.step(1)
+}
+
+// Prev moves back to the previous item and returns it, or reports false once there are no more.
+func (c *Cursor[T]) Prev() (T, bool) {
+	return c.step(-1)
+}
+
+// Seek positions the cursor so that Next returns the item at the given sorted index and Prev
+// the one before it. Indexes outside the list are clamped to its ends.
+func (c *Cursor[T]) Seek(index int) {
+	c.pos = min(max(index, 0), len(c.order))
+}
+
+// step moves the cursor one item at a time in the direction of delta until it passes an item
+// that can be loaded, which it returns, or reaches an end.
+func (c *Cursor[T]) step(delta int) (T, bool) {
+	d := c.list
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	var zero T
+	if d.closed {
+		c.err = ErrClosed
+		return zero, false
+	}
+	if d.renumbered != c.renumbered {
+		c.err = ErrCursorInvalid
+		return zero, false
+	}
+
+	for {
+		var pos int
+		if delta > 0 {
+			if c.pos >= len(c.order) {
+				return zero, false
+			}
+			pos = c.pos
+			c.pos++
+		} else {
+			if c.pos <= 0 {
+				return zero, false
+			}
+			c.pos--
+			pos = c.pos
+		}
+
+		item, err := d.getFromStorage(c.order[pos])
+		if err == nil {
+			return item, true
+		}
+		// Items removed since the cursor was created are expected to be missing
+		if errors.Is(err, ErrIndexNotFound) {
+			continue
+		}
+		d.logger.Error(fmt.Sprintf("DBList cursor failed to load index %d", pos), "error", err)
+	}
+}
@@ -0,0 +1,94 @@
+package util
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestCursor tests paging forward and backward, seeking, and that the order is fixed at creation.
+func TestCursor(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}})
+	cursor := list.Cursor()
+
+	// Changes after creation do not affect the cursor
+	list.Add(Item{ID: 5})
+	list.Reverse()
+
+	next := func(expected ...int) {
+		t.Helper()
+		for _, id := range expected {
+			if item, ok := cursor.Next(); !ok || item.ID != id {
+				t.Fatalf("Next: expected ID %d, got %v, %v", id, item, ok)
+			}
+		}
+	}
+	prev := func(expected ...int) {
+		t.Helper()
+		for _, id := range expected {
+			if item, ok := cursor.Prev(); !ok || item.ID != id {
+				t.Fatalf("Prev: expected ID %d, got %v, %v", id, item, ok)
+			}
+		}
+	}
+
+	next(0, 1, 2, 3, 4)
+	if _, ok := cursor.Next(); ok {
+		t.Errorf("Expected Next to report the end")
+	}
+	prev(4, 3)
+
+	cursor.Seek(2)
+	next(2, 3)
+	cursor.Seek(2)
+	prev(1, 0)
+	if _, ok := cursor.Prev(); ok {
+		t.Errorf("Expected Prev to report the start")
+	}
+	next(0)
+
+	cursor.Seek(100)
+	prev(4)
+
+	// Items removed since creation are skipped; ID 2 is at sorted index 3 after Reverse
+	list.Delete(3)
+	cursor.Seek(1)
+	next(1, 3)
+}
+
+// TestCursor_Compact tests that a cursor stops with ErrCursorInvalid once Compact has given its
+// physical indexes to other items, rather than returning them.
+func TestCursor_Compact(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}, {ID: 3}})
+	cursor := list.Cursor()
+
+	if item, ok := cursor.Next(); !ok || item.ID != 0 || cursor.Err() != nil {
+		t.Fatalf("Next: expected ID 0, got %v, %v, err %v", item, ok, cursor.Err())
+	}
+	for {
+		if _, ok := cursor.Next(); !ok {
+			break
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		t.Errorf("Expected no error at the end, got %v", err)
+	}
+
+	list.Delete(0)
+	if err := list.Compact(); err != nil {
+		t.Fatalf("Failed to compact list: %v", err)
+	}
+	cursor.Seek(0)
+	if item, ok := cursor.Next(); ok {
+		t.Errorf("Expected the cursor to stop after Compact, got %v", item)
+	}
+	if err := cursor.Err(); !errors.Is(err, ErrCursorInvalid) {
+		t.Errorf("Expected ErrCursorInvalid, got %v", err)
+	}
+
+	// A cursor created after the Compact works as usual
+	if item, ok := list.Cursor().Next(); !ok || item.ID != 1 {
+		t.Errorf("Next: expected ID 1 from a new cursor, got %v, %v", item, ok)
+	}
+}
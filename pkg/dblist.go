@@ -1,194 +1,2710 @@
 package util
 
 import (
+	"cmp"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log/slog"
+	"iter"
+	"maps"
+	"math"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 )
 
+// ErrClosed is returned by operations on a DBList after Close has been called.
+var ErrClosed = errors.New("dblist is closed")
+
+// ErrReadOnly is returned by operations that would modify the storage of a DBList created by Snapshot.
+var ErrReadOnly = errors.New("dblist is read-only")
+
+// ErrIndexNotFound is returned when the disk record for an item is missing.
+var ErrIndexNotFound = errors.New("index not found")
+
+// ErrCorruptRecord is returned when the disk record for an item cannot be decoded.
+var ErrCorruptRecord = errors.New("corrupt record")
+
+// ErrEmpty is returned by operations that need at least one item when the DBList is empty.
+var ErrEmpty = errors.New("dblist is empty")
+
+// ErrNotSorted is returned by operations that rely on the sort order when the DBList is not sorted.
+var ErrNotSorted = errors.New("dblist is not sorted")
+
+// ErrNoDiskPath is returned when an item needs to overflow to disk but the DBList has no disk path.
+var ErrNoDiskPath = errors.New("disk path not configured")
+
+// ErrMemoryFull is returned instead of ErrNoDiskPath by a DBList created with InMemoryOnly.
+var ErrMemoryFull = errors.New("in-memory dblist is full")
+
+// ErrNotMonotonic is returned by AddMonotonic for an item older than the last one added.
+var ErrNotMonotonic = errors.New("timestamp is not monotonic")
+
 // DBList manages a list of data elements, storing them in memory or on disk.
 type DBList[T any] struct {
-	memoryData    []T
+	memoryData    map[int]T
 	diskPath      string
 	maxInMemory   int
 	mutex         sync.RWMutex
 	totalCount    int
+	nextIndex     int
+	memoryBytes   int64
 	sortedIndexes []int
 	isSorted      bool
+	closed        bool
+	readOnly      bool
+	disk          store
+	usage         *sizedStore
+	addedAt       map[int]int64
+	itemMeta      map[int]map[string]string
+	envelopes     map[int]bool
+	generation    int
+	renumbered    int
+	inflight      int
+	writesDone    *sync.Cond
+	monotonic     sync.Mutex
+	// monotonicAt is the timestamp of the last item AddMonotonic accepted, if hasMonotonicAt.
+	// Both are guarded by mutex rather than monotonic, so Compact and the like can reset them.
+	monotonicAt    int64
+	hasMonotonicAt bool
+	wal            *writeAheadLog
+	createdDir     string
+	onSpill        func(T)
+	spills         []T
+	types          *typeRegistry[T]
+	recency        *recencyTracker
+	reserved       map[int]bool
+	keyOf          func(T) string
+	keys           *keyIndex
+	keyedFiles     bool
+	lookupKey      func(T) string
+	lookups        *keyIndex
+	chunks         *chunkStore
+	times          *timesLog
+	options
 }
 
 // NewDBList creates a new DBList with a given path for disk storage and maximum in-memory length.
-func NewDBList[T any](path string, maxInMemory int) *DBList[T] {
-	return &DBList[T]{
-		memoryData:    make([]T, 0, maxInMemory),
+// It is shorthand for NewDBListWithOptions with WithPath and WithMaxInMemory, except that the
+// options are not validated, so an invalid setting is only reported when it is first used. A
+// maxInMemory of 0 makes the list disk-only, with every item written to disk; a negative one
+// is treated as 0.
+func NewDBList[T any](path string, maxInMemory int, opts ...Option) *DBList[T] {
+	o := resolveOptions(append([]Option{WithPath(path), WithMaxInMemory(maxInMemory)}, opts...))
+
+	return newDBList[T](o.path, o.maxItems, o)
+}
+
+// NewDBListWithOptions creates a new DBList configured entirely by options. Without WithPath
+// the list has no disk tier, and without WithMaxInMemory it keeps up to 1000 items in memory.
+// It returns an error if the options are invalid.
+func NewDBListWithOptions[T any](opts ...Option) (*DBList[T], error) {
+	o := resolveOptions(opts)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	if err := validateTyped[T](o); err != nil {
+		return nil, err
+	}
+
+	return newDBList[T](o.path, o.maxItems, o), nil
+}
+
+// newDBList creates a new DBList with already resolved options.
+func newDBList[T any](path string, maxInMemory int, o options) *DBList[T] {
+	if o.memoryOnly {
+		path = ""
+		o.backend = nil
+	}
+	maxInMemory = max(maxInMemory, 0)
+
+	d := &DBList[T]{
+		memoryData:    make(map[int]T, capacityHint(maxInMemory)),
 		diskPath:      path,
 		maxInMemory:   maxInMemory,
 		totalCount:    0,
-		sortedIndexes: make([]int, 0, maxInMemory),
+		nextIndex:     0,
+		sortedIndexes: make([]int, 0, capacityHint(maxInMemory)),
 		isSorted:      true,
+		options:       o,
+	}
+	d.writesDone = sync.NewCond(&d.mutex)
+	d.onSpill, _ = o.onSpill.(func(T))
+	if o.memoryPolicy == LRU {
+		d.recency = newRecencyTracker()
+	}
+	if factories, ok := o.factories.([]func() T); ok {
+		var err error
+		if d.types, err = newTypeRegistry(factories); err != nil {
+			d.logger.Error("DBList ignoring WithTypes", "error", err)
+		}
+	}
+
+	if o.backend != nil {
+		d.disk = newBackendStore(d, o.backend)
+	} else if o.memoryMapped {
+		s := newMmapStore(path, o.dirMode, o.fileMode)
+		s.syncWrites = o.syncOnWrite
+		d.disk = s
+	} else if o.appendOnly {
+		s := newAppendStore(path, o.dirMode, o.fileMode)
+		s.syncWrites = o.syncOnWrite
+		d.disk = s
+	} else if path != "" {
+		d.chunks = newChunkStore(fileStore[T]{list: d}, path, o.fileMode, o.maxOpenFiles)
+		d.disk = d.chunks
+	} else {
+		d.disk = fileStore[T]{list: d}
+	}
+	if keyOf, ok := o.keyFunc.(func(T) string); ok {
+		d.keyOf = keyOf
+		d.keys = newKeyIndex(nil)
+		d.keyedFiles = o.backend == nil && !o.memoryMapped && !o.appendOnly && o.pathMapper == nil
+	}
+	if o.writeBuffer > 0 {
+		d.disk = newBufferedStore(d.disk, o.writeBuffer, o.flushInterval)
+	}
+	d.usage = newSizedStore(d.disk)
+	d.disk = d.usage
+	if o.writeAheadLog && path != "" {
+		d.wal = newWriteAheadLog(path, o.dirMode, o.fileMode)
 	}
+	if o.ttl > 0 && path != "" {
+		d.times = newTimesLog(path, o.dirMode, o.fileMode, o.syncOnWrite)
+	}
+	if o.ephemeral && path != "" {
+		d.createdDir = missingAncestor(path)
+	}
+
+	return d
 }
 
-// Add appends an item to the DBList, managing memory and disk storage automatically.
-func (d *DBList[T]) Add(item T) error {
-	d.mutex.Lock()
-	defer d.mutex.Unlock()
+// OpenDBList creates a DBList from the items already stored on disk at the given path.
+// If metadata was saved with Flush, the saved sort order is restored; any other items are
+// ordered by their original insertion order. The options must choose the same kind of storage
+// the list was saved with, such as WithAppendOnlyFile, or ErrStorageMismatch is returned. The
+// first maxInMemory items are loaded into memory; their files are left in place so the data
+// remains on disk.
+func OpenDBList[T any](path string, maxInMemory int, opts ...Option) (*DBList[T], error) {
+	d := NewDBList[T](path, maxInMemory, opts...)
+	// Until the records are found, any index may already have one
+	d.usage.next.Store(math.MaxInt64)
 
-	if len(d.memoryData) < d.maxInMemory {
-		d.memoryData = append(d.memoryData, item)
-	} else {
-		filePath, err := d.filePathForIndex(d.totalCount, true)
-		if err != nil {
-			return err
+	meta, err := d.readMetadata()
+	if err != nil {
+		return nil, err
+	}
+	if meta != nil {
+		// The on-disk format is fixed by whatever the list was created with
+		d.compression = meta.Compression
+		d.extension = meta.FileExtension
+		d.zeroPadding = meta.ZeroPadding
+		d.checksum = meta.Checksum
+		d.recordKinds = meta.RecordKinds
+
+		if err := d.checkEncryptionKey(meta); err != nil {
+			return nil, err
+		}
+		if err := d.checkStorage(meta); err != nil {
+			return nil, err
+		}
+		d.usage.bytes.Store(meta.DiskBytes)
+		// A PathMapper without a PathParser, or a Backend that cannot list its records, looks
+		// for the indexes below this
+		d.nextIndex = meta.NextIndex
+		if d.keys != nil {
+			d.keys.replace(meta.Keys)
+		}
+		if d.times != nil {
+			d.times.epoch = meta.TimesEpoch
+		}
+	}
+
+	// Changes logged since the metadata was saved take precedence over it
+	if err := d.replayLog(); err != nil {
+		return nil, err
+	}
+
+	found, err := d.disk.indexes()
+	if err != nil {
+		return nil, err
+	}
+	if found, err = d.adoptKeyedFiles(meta, found); err != nil {
+		return nil, err
+	}
+
+	onDisk := make(map[int]bool, len(found))
+	for _, index := range found {
+		onDisk[index] = true
+	}
+
+	if meta != nil {
+		// Restore the saved order for items that made it to disk
+		for _, index := range meta.SortedIndexes {
+			if onDisk[index] {
+				d.sortedIndexes = append(d.sortedIndexes, index)
+				delete(onDisk, index)
+			}
 		}
+		d.isSorted = meta.IsSorted
+		d.nextIndex = meta.NextIndex
+		d.addedAt = meta.AddedAt
+	}
+
+	// Anything written after the metadata was saved is appended in insertion order
+	for _, index := range found {
+		if onDisk[index] {
+			d.sortedIndexes = append(d.sortedIndexes, index)
+			d.isSorted = false
+		}
+	}
 
-		data, err := json.Marshal(item)
+	// The saved byte count only covers the records that were on disk when it was saved
+	if meta == nil || len(onDisk) > 0 {
+		if err := d.remeasure(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, index := range d.sortedIndexes {
+		item, itemMeta, err := d.retrieveWithMeta(index)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("failed to load index %d: %w", index, err)
 		}
 
-		file, err := os.Create(filePath)
+		if d.reserveMemory(item) {
+			d.memoryData[index] = item
+			d.setItemMeta(index, itemMeta)
+		}
+		d.markEnvelope(index, itemMeta != nil)
+
+		// Without file names to go by, keys written since the metadata are read from the items
+		if d.keys != nil && !d.keyedFiles {
+			if _, ok := d.keys.keyFor(index); !ok {
+				d.keys.set(d.keyOf(item), index)
+			}
+		}
+	}
+
+	if d.times != nil {
+		logged, err := d.times.read()
 		if err != nil {
-			return err
+			return nil, err
+		}
+		for _, index := range d.sortedIndexes {
+			if addedAt, ok := logged[index]; ok {
+				if d.addedAt == nil {
+					d.addedAt = make(map[int]int64)
+				}
+				d.addedAt[index] = addedAt
+			}
+		}
+	}
+	if d.ttl > 0 {
+		for _, index := range d.sortedIndexes {
+			if _, ok := d.addedAt[index]; !ok {
+				d.stamp(index)
+			}
 		}
-		defer file.Close()
+	}
 
-		if _, err = file.Write(data); err != nil {
-			return err
+	d.totalCount = len(d.sortedIndexes)
+	if len(found) > 0 {
+		d.nextIndex = max(d.nextIndex, found[len(found)-1]+1)
+	}
+	d.usage.next.Store(int64(d.nextIndex))
+	if meta == nil {
+		d.isSorted = d.totalCount == 0
+	}
+
+	// Every item is in the records on disk after the replay
+	if d.wal != nil {
+		if err := d.wal.rewrite(nil); err != nil {
+			return nil, err
 		}
 	}
 
-	d.sortedIndexes = append(d.sortedIndexes, d.totalCount)
-	d.totalCount++
-	d.isSorted = false
+	return d, nil
+}
 
-	return nil
+// Add appends an item to the DBList, managing memory and disk storage automatically.
+// An item that overflows to disk is encoded and written without holding the lock, so
+// concurrent adders are not serialized behind disk I/O. The item only becomes visible
+// to Get and the other readers once its record has been written.
+func (d *DBList[T]) Add(item T) error {
+	return d.AddCtx(context.Background(), item)
 }
 
-// Adds appends multiple items to the DBList at once.
-func (d *DBList[T]) Adds(items []T) error {
-	for _, item := range items {
-		if err := d.Add(item); err != nil {
+// AddCtx appends an item as Add does, unless ctx is cancelled first. The context is checked
+// again before an item that overflows is written to disk; if it has been cancelled by then the
+// write is skipped, the index is given back if no other item has been added since, and the
+// context's error is returned. A write already under way is not interrupted.
+func (d *DBList[T]) AddCtx(ctx context.Context, item T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d.keyOf != nil {
+		return d.addKeyed(ctx, item)
+	}
+
+	d.mutex.Lock()
+
+	if err := d.checkWritable(); err != nil {
+		d.mutex.Unlock()
+		return err
+	}
+
+	index := d.nextIndex
+	d.nextIndex++
+
+	if d.reserveMemory(item) {
+		defer d.mutex.Unlock()
+
+		if err := d.logMemoryPut(index, item, nil); err != nil {
+			d.releaseMemory(item)
 			return err
 		}
+		d.memoryData[index] = item
+		d.indexLookup(index, item)
+		d.publish(index)
+		return nil
+	}
+
+	if !d.hasDisk() {
+		d.releaseIndexes(index, 1)
+		d.mutex.Unlock()
+		return d.errNoDisk()
+	}
+
+	d.setReserved(index, 1, true)
+	d.inflight++
+	d.mutex.Unlock()
+
+	// Each index has its own record, so the write needs no lock
+	err := ctx.Err()
+	var data []byte
+	if err == nil {
+		data, err = d.encode(item)
+	}
+	if err == nil {
+		err = d.putLogged(index, data)
+	}
+
+	d.mutex.Lock()
+	defer d.unlock()
+
+	d.writeDone()
+	d.setReserved(index, 1, false)
+	if err != nil {
+		d.releaseIndexes(index, 1)
+		return err
 	}
+	d.indexLookup(index, item)
+	d.publish(index)
+	d.spilled(item)
+
 	return nil
 }
 
-// Size returns the total number of elements in the DBList.
-func (d *DBList[T]) Size() int {
-	return d.totalCount
+// releaseIndexes gives back the count physical indexes reserved from start if they are the
+// last ones reserved, so an add that failed leaves no gap. The caller must hold the write lock.
+func (d *DBList[T]) releaseIndexes(start, count int) {
+	if d.nextIndex == start+count {
+		d.nextIndex = start
+	}
 }
 
-// Get retrieves an item by sorted index.
-func (d *DBList[T]) Get(index int) (T, error) {
+// AddMonotonic appends an item as Add does if its timestamp, as given by ts, is no earlier than
+// that of the last item AddMonotonic accepted, so a list used as an event log stays in time
+// order. An earlier item is rejected with ErrNotMonotonic. The last timestamp is remembered, so
+// the check costs one call to ts; until there is one, because the list was just created or
+// opened or has since been compacted, cleared or replaced, the item with the highest physical
+// index, the last one added, is loaded once to check against. Calls to AddMonotonic are
+// serialized with each other, but not with Add and the other ways of adding.
+func (d *DBList[T]) AddMonotonic(item T, ts func(T) int64) error {
+	d.monotonic.Lock()
+	defer d.monotonic.Unlock()
+
 	d.mutex.RLock()
-	defer d.mutex.RUnlock()
+	lastAt, ok, err := d.lastTimestamp(ts)
+	d.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
 
-	if index >= len(d.sortedIndexes) {
-		var zero T
-		return zero, fmt.Errorf("index out of range")
+	at := ts(item)
+	if ok && at < lastAt {
+		return fmt.Errorf("%w: item at %d is earlier than the last item at %d", ErrNotMonotonic, at, lastAt)
+	}
+
+	if err := d.Add(item); err != nil {
+		return err
 	}
 
-	index = d.sortedIndexes[index]
-	return d.getFromStorage(index)
+	d.mutex.Lock()
+	d.monotonicAt, d.hasMonotonicAt = at, true
+	d.mutex.Unlock()
+
+	return nil
 }
 
-// getFromStorage gets the item at the given index, either from memory or disk.
-func (d *DBList[T]) getFromStorage(index int) (T, error) {
-	if index < len(d.memoryData) {
-		return d.memoryData[index], nil
-	} else {
-		return d.retrieveFromDisk(index)
+// lastTimestamp returns the timestamp AddMonotonic checks against, reporting false if there is
+// none because the list is empty. The caller must hold the lock.
+func (d *DBList[T]) lastTimestamp(ts func(T) int64) (int64, bool, error) {
+	if d.hasMonotonicAt && !d.closed {
+		return d.monotonicAt, true, nil
 	}
+
+	last, ok, err := d.lastAdded()
+	if err != nil || !ok {
+		return 0, false, err
+	}
+
+	return ts(last), true, nil
 }
 
-func (d *DBList[T]) retrieveFromDisk(index int) (T, error) {
-	var item T
+// forgetTimestamp makes the next AddMonotonic check against the items in the list again, after
+// they have been replaced. The caller must hold the write lock.
+func (d *DBList[T]) forgetTimestamp() {
+	d.monotonicAt, d.hasMonotonicAt = 0, false
+}
 
-	filePath, err := d.filePathForIndex(index, false)
-	if err != nil {
-		return item, err
+// lastAdded returns the item with the highest physical index, reporting false if the list is
+// empty. The caller must hold the lock.
+func (d *DBList[T]) lastAdded() (T, bool, error) {
+	var zero T
+	if d.closed {
+		return zero, false, ErrClosed
+	}
+	if len(d.sortedIndexes) == 0 {
+		return zero, false, nil
 	}
 
-	data, err := os.ReadFile(filePath)
+	item, err := d.getFromStorage(slices.Max(d.sortedIndexes))
 	if err != nil {
-		return item, fmt.Errorf("failed to read from disk: %w", err)
+		return zero, false, fmt.Errorf("failed to load the last item: %w", err)
 	}
 
-	err = json.Unmarshal(data, &item)
-	if err != nil {
-		return item, fmt.Errorf("failed to unmarshal data: %w", err)
+	return item, true, nil
+}
+
+// publish appends the item at index to the end of the sorted order. The caller must hold the lock.
+func (d *DBList[T]) publish(index int) {
+	d.stamp(index)
+	d.sortedIndexes = append(d.sortedIndexes, index)
+	d.totalCount++
+	d.isSorted = false
+	d.generation++
+}
+
+// writeDone records that a disk write made without the lock has finished, waking anything
+// in waitForWrites. The caller must hold the lock.
+func (d *DBList[T]) writeDone() {
+	d.inflight--
+	d.writesDone.Broadcast()
+}
+
+// waitForWrites blocks until no disk writes made without the lock are in progress, so
+// their records are not mistaken for orphans or left behind. The caller must hold the lock.
+func (d *DBList[T]) waitForWrites() {
+	for d.inflight > 0 {
+		d.writesDone.Wait()
 	}
+}
 
-	return item, nil
+// Adds appends multiple items to the DBList at once. The batch is atomic: indexes and memory
+// slots for all the items are reserved under one lock, the items that overflow are written to
+// disk, and then all of them become visible to readers together, in slice order. If any write
+// fails, none of the items are added. It is AddsParallel with a single writer. With
+// WithKeyFunc each item is added as by Add instead, as described there.
+func (d *DBList[T]) Adds(items []T) error {
+	return d.AddsCtx(context.Background(), items)
 }
 
-// Iterator returns a channel that iterates over all elements, both in memory and on disk.
-func (d *DBList[T]) Iterator(ctx context.Context) <-chan T {
-	ch := make(chan T)
+// AddsCtx appends multiple items atomically as Adds does, unless ctx is cancelled first. The
+// context is checked before each write to disk; once it has been cancelled no more items are
+// written, none of the items are added, and the context's error is returned.
+func (d *DBList[T]) AddsCtx(ctx context.Context, items []T) error {
+	if len(items) == 0 {
+		return nil
+	}
 
-	go func() {
-		defer close(ch)
+	return d.addsParallel(ctx, items, 1)
+}
 
-		for i := 0; i < d.totalCount; i++ {
-			if ctx.Err() != nil {
-				// Exit if the context has been cancelled or timed out
-				return
+// setReserved marks the count indexes from start as those of items being added without the
+// lock and not yet published, which readers must not see and promoteHot must not move, or
+// unmarks them once they are published or rolled back. The caller must hold the write lock.
+func (d *DBList[T]) setReserved(start, count int, reserved bool) {
+	if d.reserved == nil {
+		d.reserved = make(map[int]bool)
+	}
+	for index := start; index < start+count; index++ {
+		if reserved {
+			d.reserved[index] = true
+		} else {
+			delete(d.reserved, index)
+		}
+	}
+}
+
+// spilled queues an item written to disk when it was added for the WithOnSpill callback, if
+// any, which unlock calls once the lock is released. The caller must hold the write lock.
+func (d *DBList[T]) spilled(item T) {
+	if d.onSpill != nil {
+		d.spills = append(d.spills, item)
+	}
+}
+
+// unlock releases the write lock, then calls the WithOnSpill callback for each item queued by
+// spilled, so the callback is free to use the list. Methods that add items release the lock
+// with unlock rather than directly.
+func (d *DBList[T]) unlock() {
+	spills := d.spills
+	d.spills = nil
+	d.mutex.Unlock()
+
+	for _, item := range spills {
+		d.onSpill(item)
+	}
+}
+
+// AddFromChannel appends the items received from ch with Add until ch is closed or ctx is
+// cancelled. It returns the number of items added, along with the first Add error or the
+// context's error; items received before an error stay in the list.
+func (d *DBList[T]) AddFromChannel(ctx context.Context, ch <-chan T) (added int, err error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return added, ctx.Err()
+		case item, ok := <-ch:
+			if !ok {
+				return added, nil
 			}
+			if err := d.Add(item); err != nil {
+				return added, err
+			}
+			added++
+		}
+	}
+}
 
-			item, err := d.Get(i)
-			if err != nil {
-				slog.Error(fmt.Sprintf("DBList failed to load index %d", i))
-				continue
+// Append adds every item of other to the end of d in other's current sorted order, reading
+// them one at a time with IteratorErr so neither list is loaded into memory as a whole. It
+// stops with the first item of other that cannot be loaded or added, leaving the items
+// appended before it in d.
+func (d *DBList[T]) Append(other *DBList[T]) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for result := range other.IteratorErr(ctx) {
+		if result.Err != nil {
+			return result.Err
+		}
+		if err := d.Add(result.Item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddsParallel appends multiple items, writing the ones that overflow to disk across a pool
+// of workers goroutines (GOMAXPROCS if workers is not positive). Indexes are reserved up
+// front and the lock is not held during disk writes. The items keep their slice order and
+// become visible together at the end of the sorted order once every write has completed;
+// items added concurrently may therefore appear before them. If any write fails, none of
+// the items are added. With WithKeyFunc the items are added one at a time as by Adds.
+func (d *DBList[T]) AddsParallel(items []T, workers int) error {
+	return d.addsParallel(context.Background(), items, workers)
+}
+
+// addsParallel implements AddsParallel, stopping the writes once ctx is cancelled.
+func (d *DBList[T]) addsParallel(ctx context.Context, items []T, workers int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d.keyOf != nil {
+		return d.addsKeyed(ctx, items)
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	// Reserve indexes and claim the free memory slots for the first items
+	d.mutex.Lock()
+	if err := d.checkWritable(); err != nil {
+		d.mutex.Unlock()
+		return err
+	}
+	base := d.nextIndex
+	d.nextIndex += len(items)
+	inMemory := 0
+	for inMemory < len(items) && d.reserveMemory(items[inMemory]) {
+		d.memoryData[base+inMemory] = items[inMemory]
+		inMemory++
+	}
+	if inMemory < len(items) && !d.hasDisk() {
+		for i := 0; i < inMemory; i++ {
+			d.releaseMemory(items[i])
+			delete(d.memoryData, base+i)
+		}
+		d.releaseIndexes(base, len(items))
+		d.mutex.Unlock()
+		return d.errNoDisk()
+	}
+	d.setReserved(base, len(items), true)
+	d.inflight++
+	d.mutex.Unlock()
+
+	jobs := make(chan int)
+	errs := make(chan error, 1)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// Items claimed for memory only need writing to the log, if there is one
+				if i < inMemory && d.wal == nil {
+					continue
+				}
+
+				err := ctx.Err()
+				var data []byte
+				if err == nil {
+					data, err = d.encode(items[i])
+				}
+				if err == nil {
+					err = d.logPut(base+i, data)
+				}
+				if err == nil && i >= inMemory {
+					err = d.disk.put(base+i, data)
+				}
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+				}
 			}
+		}()
+	}
+	for i := range items {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 
-			select {
-			case ch <- item:
-			case <-ctx.Done():
-				// Exit if context is cancelled
-				return
+	d.mutex.Lock()
+	defer d.unlock()
+
+	d.writeDone()
+	d.setReserved(base, len(items), false)
+
+	var err error
+	select {
+	case err = <-errs:
+	default:
+	}
+
+	if err != nil {
+		for i := range items {
+			if i < inMemory {
+				d.releaseMemory(items[i])
+				delete(d.memoryData, base+i)
+			} else {
+				d.disk.remove(base + i)
 			}
+			d.logDelete(base + i)
 		}
-	}()
+		d.releaseIndexes(base, len(items))
+		return err
+	}
 
-	return ch
+	for i, item := range items {
+		d.stamp(base + i)
+		d.indexLookup(base+i, item)
+		d.sortedIndexes = append(d.sortedIndexes, base+i)
+	}
+	for _, item := range items[inMemory:] {
+		d.spilled(item)
+	}
+	d.totalCount += len(items)
+	d.isSorted = false
+	d.generation++
+
+	return nil
 }
 
-// Sort will rebuild the sorted index based on the provided compare function
-func (d *DBList[T]) Sort(compare func(a, b T) bool) {
+// Clear removes all items from the DBList, deleting any files it wrote to disk, including its metadata.
+func (d *DBList[T]) Clear() error {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
-	if d.isSorted {
-		return
+	if err := d.checkWritable(); err != nil {
+		return err
 	}
+	d.waitForWrites()
 
-	sort.SliceStable(d.sortedIndexes, func(i, j int) bool {
-		itemA, _ := d.getFromStorage(d.sortedIndexes[i])
-		itemB, _ := d.getFromStorage(d.sortedIndexes[j])
-		return compare(itemA, itemB)
-	})
+	for _, index := range d.sortedIndexes {
+		if err := d.deleteFromStorage(index); err != nil {
+			return err
+		}
+	}
+
+	if err := d.removeMetadata(); err != nil {
+		return err
+	}
+	if d.times != nil {
+		if err := d.times.reset(0); err != nil {
+			return err
+		}
+	}
 
+	d.memoryData = make(map[int]T, capacityHint(d.maxInMemory))
+	d.memoryBytes = 0
+	d.addedAt = nil
+	d.itemMeta = nil
+	d.envelopes = nil
+	if d.recency != nil {
+		d.recency.reset(nil)
+	}
+	if d.keys != nil {
+		d.keys.reset(nil)
+	}
+	if d.lookups != nil {
+		d.lookups.reset(nil)
+	}
+	d.sortedIndexes = make([]int, 0, capacityHint(d.maxInMemory))
+	d.totalCount = 0
+	d.nextIndex = 0
+	d.renumbered++
+	d.forgetTimestamp()
 	d.isSorted = true
+	d.generation++
+
+	// Indexes are reused from 0, so nothing from before may be replayed
+	return d.checkpoint()
 }
 
-// filePathForIndex generates the file path for a given index and ensures the path exists if required.
-func (d *DBList[T]) filePathForIndex(index int, create bool) (string, error) {
-	filePath := filepath.Join(d.diskPath, fmt.Sprintf("%d.json", index))
+// ReplaceAll replaces every item in the list with items, in their slice order, in one step
+// under the write lock, so readers see either the old items or the new ones. The new items are
+// stored first, at fresh physical indexes in the same storage, and the old ones are deleted only
+// once every new item is stored; if storing one fails, the list is left as it was. The new
+// order is saved to the metadata file, as Compact does.
+func (d *DBList[T]) ReplaceAll(items []T) error {
+	if err := d.checkUnkeyed("ReplaceAll"); err != nil {
+		return err
+	}
 
-	if create {
-		// Ensure the directory exists
-		dirPath := filepath.Dir(filePath)
-		if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
-			return "", fmt.Errorf("failed to create directory: %w", err)
+	d.mutex.Lock()
+	defer d.unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return err
+	}
+	d.waitForWrites()
+
+	// Decide which of the new items fit in memory as if it were empty
+	oldMemory, oldBytes := d.memoryData, d.memoryBytes
+	d.memoryData, d.memoryBytes = make(map[int]T, capacityHint(d.maxInMemory)), 0
+	base := d.nextIndex
+	for i, item := range items {
+		if d.reserveMemory(item) {
+			d.memoryData[base+i] = item
 		}
 	}
+	newMemory, newBytes := d.memoryData, d.memoryBytes
+	d.memoryData, d.memoryBytes = oldMemory, oldBytes
 
-	return filePath, nil
+	if err := d.storeReplacements(base, items, newMemory); err != nil {
+		return err
+	}
+	d.nextIndex = base + len(items)
+
+	for _, index := range d.sortedIndexes {
+		if err := d.deleteFromStorage(index); err != nil {
+			return err
+		}
+	}
+
+	d.memoryData, d.memoryBytes = newMemory, newBytes
+	d.sortedIndexes = make([]int, len(items))
+	for i, item := range items {
+		d.sortedIndexes[i] = base + i
+		d.stamp(base + i)
+		d.indexLookup(base+i, item)
+	}
+	d.totalCount = len(items)
+	d.isSorted = len(items) == 0
+	d.generation++
+	d.forgetTimestamp()
+
+	if err := d.writeMetadata(); err != nil {
+		return err
+	}
+
+	// The log holds the old items
+	return d.checkpoint()
+}
+
+// storeReplacements writes the items for ReplaceAll that are not in memory to disk, at the
+// physical indexes from base, removing the records already written if one fails. The caller
+// must hold the write lock.
+func (d *DBList[T]) storeReplacements(base int, items []T, memory map[int]T) error {
+	var written []int
+	err := func() error {
+		for i, item := range items {
+			index := base + i
+			if _, ok := memory[index]; ok {
+				continue
+			}
+			if !d.hasDisk() {
+				return d.errNoDisk()
+			}
+
+			data, err := d.encode(item)
+			if err != nil {
+				return err
+			}
+			if err := d.disk.put(index, data); err != nil {
+				return err
+			}
+			written = append(written, index)
+			d.spilled(item)
+		}
+		return nil
+	}()
+
+	if err != nil {
+		for _, index := range written {
+			d.disk.remove(index)
+		}
+		d.spills = nil
+	}
+	return err
+}
+
+// Close writes the in-memory items to disk, flushes any pending writes and metadata, and
+// releases the disk storage. The whole list can then be restored with OpenDBList. Any
+// further operations on the list return ErrClosed.
+func (d *DBList[T]) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	// A snapshot shares its disk storage with the original, which remains responsible for it
+	if d.readOnly {
+		d.closed = true
+		return nil
+	}
+
+	d.waitForWrites()
+
+	if d.createdDir != "" {
+		return d.closeEphemeral()
+	}
+
+	if d.hasDisk() {
+		for index, item := range d.memoryData {
+			if err := d.writeWithMeta(index, item, d.itemMeta[index]); err != nil {
+				return err
+			}
+		}
+
+		if err := d.disk.flush(); err != nil {
+			return err
+		}
+
+		if err := d.writeMetadata(); err != nil {
+			return err
+		}
+	}
+
+	// Every item is now in the records on disk, so the log is no longer needed
+	if d.wal != nil {
+		if err := d.wal.rewrite(nil); err != nil {
+			return err
+		}
+		if err := d.wal.close(); err != nil {
+			return err
+		}
+	}
+	if d.times != nil {
+		if err := d.times.close(); err != nil {
+			return err
+		}
+	}
+
+	if err := d.disk.close(); err != nil {
+		return err
+	}
+
+	d.closed = true
+
+	return nil
+}
+
+// closeEphemeral releases the disk storage and removes the directories the list created,
+// without persisting anything. The caller must hold the write lock.
+func (d *DBList[T]) closeEphemeral() error {
+	if d.wal != nil {
+		if err := d.wal.close(); err != nil {
+			return err
+		}
+	}
+	if d.times != nil {
+		if err := d.times.close(); err != nil {
+			return err
+		}
+	}
+	if err := d.disk.close(); err != nil {
+		return err
+	}
+
+	if d.createdDir != "" {
+		if err := os.RemoveAll(d.createdDir); err != nil {
+			return fmt.Errorf("failed to remove disk storage: %w", err)
+		}
+	}
+
+	d.closed = true
+
+	return nil
+}
+
+// missingAncestor returns the outermost directory of path that does not exist, which is the
+// one os.MkdirAll would create first, or "" if path already exists.
+func missingAncestor(path string) string {
+	missing := ""
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			return missing
+		}
+		missing = dir
+		if parent := filepath.Dir(dir); parent == dir {
+			return missing
+		}
+	}
+}
+
+// Compact renumbers the items of the DBList to the contiguous physical indexes 0..n-1,
+// moving their disk records and removing any records on disk that no item refers to.
+// The sort order is preserved and the metadata is rewritten to match.
+func (d *DBList[T]) Compact() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return err
+	}
+	d.waitForWrites()
+
+	found, err := d.disk.indexes()
+	if err != nil {
+		return err
+	}
+
+	live := slices.Clone(d.sortedIndexes)
+	sort.Ints(live)
+
+	// Packed records are found by index, so they go back to files before being renumbered
+	if d.chunks != nil {
+		if err := d.chunks.unpack(); err != nil {
+			return err
+		}
+	}
+
+	// Remove records left behind by items no longer in the list
+	renumbered := make(map[int]int, len(live))
+	for i, index := range live {
+		renumbered[index] = i
+	}
+	for _, index := range found {
+		if _, ok := renumbered[index]; ok {
+			continue
+		}
+		if err := d.disk.remove(index); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete from disk: %w", err)
+		}
+	}
+
+	// Records named by key keep their names, so while the others move they are all named by
+	// index and the keyed ones are left alone
+	var keyed map[int]string
+	if d.keyedFiles {
+		if err := d.disk.flush(); err != nil {
+			return err
+		}
+		keyed = d.keys.snapshot()
+		d.keys.reset(nil)
+	}
+	err = d.moveRecords(live, keyed)
+	if d.keyedFiles {
+		if err != nil {
+			d.keys.replace(keyed)
+		} else {
+			d.keys.replace(renumberKeys(keyed, renumbered))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, index := range d.sortedIndexes {
+		d.sortedIndexes[i] = renumbered[index]
+	}
+	d.generation++
+	d.addedAt = renumberKeys(d.addedAt, renumbered)
+	d.itemMeta = renumberKeys(d.itemMeta, renumbered)
+	d.envelopes = renumberKeys(d.envelopes, renumbered)
+	if d.recency != nil {
+		d.recency.reset(renumbered)
+	}
+	if d.keys != nil && !d.keyedFiles {
+		d.keys.reset(renumbered)
+	}
+	if d.lookups != nil {
+		d.lookups.reset(renumbered)
+	}
+	d.nextIndex = len(live)
+	d.renumbered++
+	d.forgetTimestamp()
+
+	if err := d.writeMetadata(); err != nil {
+		return err
+	}
+
+	// The log refers to the old indexes
+	return d.checkpoint()
+}
+
+// moveRecords moves the items at the physical indexes in live, which are in ascending order, to
+// the indexes 0 to len(live)-1, skipping the records in keyed. The caller must hold the write lock.
+func (d *DBList[T]) moveRecords(live []int, keyed map[int]string) error {
+	// Moving in ascending order never overwrites an item that has yet to move
+	for newIndex, index := range live {
+		if newIndex == index {
+			continue
+		}
+
+		if item, ok := d.memoryData[index]; ok {
+			delete(d.memoryData, index)
+			d.memoryData[newIndex] = item
+
+			if err := d.disk.remove(index); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to delete from disk: %w", err)
+			}
+			continue
+		}
+
+		if _, ok := keyed[index]; ok {
+			continue
+		}
+
+		data, err := d.disk.get(index)
+		if err != nil {
+			return fmt.Errorf("failed to read from disk: %w", err)
+		}
+		if err := d.disk.put(newIndex, data); err != nil {
+			return err
+		}
+		if err := d.disk.remove(index); err != nil {
+			return fmt.Errorf("failed to delete from disk: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Snapshot returns a copy of the DBList as it is now. The in-memory items and sort order are
+// copied, so adding, removing or reordering items in the original does not affect the snapshot.
+// Disk records are shared with the original rather than copied: the snapshot only reads them,
+// and any operation on the snapshot that would modify storage returns ErrReadOnly. Records
+// updated, deleted or renumbered by Compact through the original are seen as changed or missing.
+func (d *DBList[T]) Snapshot() *DBList[T] {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	snapshot := &DBList[T]{
+		memoryData:    maps.Clone(d.memoryData),
+		addedAt:       maps.Clone(d.addedAt),
+		itemMeta:      maps.Clone(d.itemMeta),
+		envelopes:     maps.Clone(d.envelopes),
+		diskPath:      d.diskPath,
+		maxInMemory:   d.maxInMemory,
+		totalCount:    d.totalCount,
+		nextIndex:     d.nextIndex,
+		memoryBytes:   d.memoryBytes,
+		sortedIndexes: slices.Clone(d.sortedIndexes),
+		isSorted:      d.isSorted,
+		closed:        d.closed,
+		readOnly:      true,
+		disk:          d.disk,
+		usage:         d.usage,
+		types:         d.types,
+		keyOf:         d.keyOf,
+		keyedFiles:    d.keyedFiles,
+		options:       d.options,
+	}
+	if d.keys != nil {
+		snapshot.keys = newKeyIndex(d.keys.snapshot())
+	}
+	snapshot.writesDone = sync.NewCond(&snapshot.mutex)
+
+	return snapshot
+}
+
+// Clone copies the DBList to a new list storing its disk tier at newPath. In-memory items are
+// copied by value and disk records are copied as is, keeping their physical indexes; the sort
+// order, counters and metadata are copied too, so changes to either list do not affect the
+// other. Items holding pointers, slices or maps share what they refer to with the original.
+// The read lock is held throughout, so the copy is consistent but writers wait for it.
+func (d *DBList[T]) Clone(ctx context.Context, newPath string) (*DBList[T], error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if d.closed {
+		return nil, ErrClosed
+	}
+	if newPath != "" && filepath.Clean(newPath) == filepath.Clean(d.diskPath) {
+		return nil, fmt.Errorf("cannot clone to the list's own path %s", newPath)
+	}
+
+	clone := newDBList[T](newPath, d.maxInMemory, d.derivedOptions())
+	if d.keys != nil {
+		clone.keys.replace(d.keys.snapshot())
+	}
+	for _, index := range d.sortedIndexes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if item, ok := d.memoryData[index]; ok {
+			clone.memoryData[index] = item
+			continue
+		}
+
+		if newPath == "" {
+			return nil, ErrNoDiskPath
+		}
+		data, err := d.disk.get(index)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from disk: %w", err)
+		}
+		if err := clone.disk.put(index, data); err != nil {
+			return nil, err
+		}
+	}
+
+	clone.sortedIndexes = slices.Clone(d.sortedIndexes)
+	clone.addedAt = maps.Clone(d.addedAt)
+	clone.itemMeta = maps.Clone(d.itemMeta)
+	clone.envelopes = maps.Clone(d.envelopes)
+	clone.totalCount = d.totalCount
+	clone.nextIndex = d.nextIndex
+	clone.memoryBytes = d.memoryBytes
+	clone.isSorted = d.isSorted
+
+	if err := clone.disk.flush(); err != nil {
+		return nil, err
+	}
+	if err := clone.writeMetadata(); err != nil {
+		return nil, err
+	}
+	if err := clone.checkpoint(); err != nil {
+		return nil, err
+	}
+
+	return clone, nil
+}
+
+// checkWritable returns an error if the storage of the DBList may not be modified.
+func (d *DBList[T]) checkWritable() error {
+	if d.closed {
+		return ErrClosed
+	}
+	if d.readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// Size returns the total number of elements in the DBList.
+func (d *DBList[T]) Size() int {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.totalCount
+}
+
+// Get retrieves an item by sorted index. Negative indexes count back from the end,
+// so Get(-1) returns the last item.
+// Under the LRU memory policy, getting an item counts as a use of it.
+func (d *DBList[T]) Get(index int) (T, error) {
+	item, physical, inMemory, err := d.lookup(index)
+	if err == nil && d.recency != nil {
+		d.used(physical, item, inMemory)
+	}
+
+	return item, err
+}
+
+// get retrieves an item by sorted index as Get does, without counting it as a use, for
+// methods that scan the list.
+func (d *DBList[T]) get(index int) (T, error) {
+	item, _, _, err := d.lookup(index)
+	return item, err
+}
+
+// lookup retrieves an item by sorted index, along with its physical index and whether it
+// was held in memory.
+func (d *DBList[T]) lookup(index int) (item T, physical int, inMemory bool, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if d.closed {
+		return item, 0, false, ErrClosed
+	}
+
+	if index < 0 {
+		index += len(d.sortedIndexes)
+	}
+	if index < 0 || index >= len(d.sortedIndexes) {
+		return item, 0, false, fmt.Errorf("index out of range")
+	}
+
+	physical = d.sortedIndexes[index]
+	if item, inMemory = d.memoryData[physical]; inMemory {
+		return item, physical, true, nil
+	}
+
+	item, err = d.retrieveFromDisk(physical)
+	return item, physical, false, err
+}
+
+// Order returns the physical index of the item at each sorted position, the indexes GetRaw
+// takes, as a copy that the caller may keep or modify. Physical indexes stay valid until the
+// next Compact or Clear.
+func (d *DBList[T]) Order() []int {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return slices.Clone(d.sortedIndexes)
+}
+
+// GetRaw retrieves an item by physical index, the position it was given in insertion order
+// when it was added, rather than by its position in the sort order like Get. The two agree
+// until the list is sorted, reordered or compacted. Physical indexes are not reused, so the
+// index of a removed item returns ErrIndexNotFound, as does that of an item still being added.
+// Compact renumbers the physical indexes.
+func (d *DBList[T]) GetRaw(physicalIndex int) (T, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	var zero T
+	if d.closed {
+		return zero, ErrClosed
+	}
+
+	if d.reserved[physicalIndex] {
+		return zero, fmt.Errorf("%w: %d", ErrIndexNotFound, physicalIndex)
+	}
+	if _, ok := d.memoryData[physicalIndex]; !ok && (!d.hasDisk() || physicalIndex < 0 || physicalIndex >= d.nextIndex) {
+		return zero, fmt.Errorf("%w: %d", ErrIndexNotFound, physicalIndex)
+	}
+
+	return d.getFromStorage(physicalIndex)
+}
+
+// GetMany retrieves the items at the given sorted indexes, in the same order, taking the read
+// lock once for the whole batch. It fails if any index is out of range.
+func (d *DBList[T]) GetMany(indexes []int) ([]T, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if d.closed {
+		return nil, ErrClosed
+	}
+
+	items := make([]T, 0, len(indexes))
+	for _, index := range indexes {
+		if index < 0 || index >= len(d.sortedIndexes) {
+			return nil, fmt.Errorf("index %d out of range", index)
+		}
+
+		item, err := d.getFromStorage(d.sortedIndexes[index])
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// First retrieves the first item in sorted order, or ErrEmpty if there are no items.
+func (d *DBList[T]) First() (T, error) {
+	return d.end(true)
+}
+
+// Last retrieves the last item in sorted order, or ErrEmpty if there are no items.
+func (d *DBList[T]) Last() (T, error) {
+	return d.end(false)
+}
+
+// end retrieves the first or last item in sorted order.
+func (d *DBList[T]) end(first bool) (T, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	var zero T
+	if d.closed {
+		return zero, ErrClosed
+	}
+	if len(d.sortedIndexes) == 0 {
+		return zero, ErrEmpty
+	}
+
+	if first {
+		return d.getFromStorage(d.sortedIndexes[0])
+	}
+	return d.getFromStorage(d.sortedIndexes[len(d.sortedIndexes)-1])
+}
+
+// Min returns the smallest item according to less, reading every item once without changing
+// the sort order. Of equal items, the first in sorted order is returned. It returns ErrEmpty
+// if there are no items, or the error of any item that cannot be loaded.
+func (d *DBList[T]) Min(less func(a, b T) bool) (T, error) {
+	return d.extreme(less)
+}
+
+// Max returns the largest item according to less, as Min does the smallest.
+func (d *DBList[T]) Max(less func(a, b T) bool) (T, error) {
+	return d.extreme(func(a, b T) bool { return less(b, a) })
+}
+
+// extreme scans the list for the item that sorts first by less.
+func (d *DBList[T]) extreme(less func(a, b T) bool) (T, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	var best T
+	if d.closed {
+		return best, ErrClosed
+	}
+	if len(d.sortedIndexes) == 0 {
+		return best, ErrEmpty
+	}
+
+	for i, index := range d.sortedIndexes {
+		item, err := d.getFromStorage(index)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		if i == 0 || less(item, best) {
+			best = item
+		}
+	}
+
+	return best, nil
+}
+
+// Range retrieves the items at sorted indexes [start, end).
+func (d *DBList[T]) Range(start, end int) ([]T, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if d.closed {
+		return nil, ErrClosed
+	}
+
+	if start < 0 || end > len(d.sortedIndexes) || start > end {
+		return nil, fmt.Errorf("invalid range [%d, %d)", start, end)
+	}
+
+	items := make([]T, 0, end-start)
+	for _, index := range d.sortedIndexes[start:end] {
+		item, err := d.getFromStorage(index)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// ToSlice returns every item in sorted order, or an error without reading any if the list
+// holds more than limit items, to guard against loading a large disk tier by accident. A
+// limit of zero or less means no limit.
+func (d *DBList[T]) ToSlice(limit int) ([]T, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if d.closed {
+		return nil, ErrClosed
+	}
+	if limit > 0 && len(d.sortedIndexes) > limit {
+		return nil, fmt.Errorf("dblist has %d items, more than the limit of %d", len(d.sortedIndexes), limit)
+	}
+
+	items := make([]T, 0, len(d.sortedIndexes))
+	for _, index := range d.sortedIndexes {
+		item, err := d.getFromStorage(index)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// Values returns every item in sorted order. Unlike Iterator, which logs and skips the items
+// it cannot load, it fails with the first such error, so a missing or corrupt record is never
+// mistaken for a shorter list. It is ToSlice without a limit.
+func (d *DBList[T]) Values() ([]T, error) {
+	return d.ToSlice(0)
+}
+
+// getFromStorage gets the item at the given index, either from memory or disk.
+func (d *DBList[T]) getFromStorage(index int) (T, error) {
+	if item, ok := d.memoryData[index]; ok {
+		return item, nil
+	} else {
+		return d.retrieveFromDisk(index)
+	}
+}
+
+// Update replaces the item at the given sorted index, marking the list as unsorted.
+func (d *DBList[T]) Update(index int, item T) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return err
+	}
+
+	if index < 0 || index >= len(d.sortedIndexes) {
+		return fmt.Errorf("index out of range")
+	}
+
+	if err := d.updateInStorage(d.sortedIndexes[index], item); err != nil {
+		return err
+	}
+
+	d.isSorted = false
+	d.generation++
+
+	return nil
+}
+
+// CompareAndUpdate replaces the item at the given sorted index with new only if the current
+// item is equal to expected according to eq, reporting whether it did. The read, comparison
+// and write happen under the write lock, so of several concurrent callers expecting the same
+// item exactly one succeeds. A successful update marks the list as unsorted, as Update does.
+func (d *DBList[T]) CompareAndUpdate(index int, expected, new T, eq func(a, b T) bool) (bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return false, err
+	}
+
+	if index < 0 || index >= len(d.sortedIndexes) {
+		return false, fmt.Errorf("index out of range")
+	}
+
+	current, err := d.getFromStorage(d.sortedIndexes[index])
+	if err != nil {
+		return false, err
+	}
+	if !eq(current, expected) {
+		return false, nil
+	}
+
+	if err := d.updateInStorage(d.sortedIndexes[index], new); err != nil {
+		return false, err
+	}
+
+	d.isSorted = false
+	d.generation++
+
+	return true, nil
+}
+
+// updateInStorage replaces the item at the given physical index, either in memory or on disk.
+func (d *DBList[T]) updateInStorage(index int, item T) error {
+	if old, ok := d.memoryData[index]; ok {
+		if err := d.logMemoryPut(index, item, d.itemMeta[index]); err != nil {
+			return err
+		}
+		d.releaseMemory(old)
+		d.memoryData[index] = item
+		// The item stays in memory even if it no longer fits, since the budget is an estimate
+		d.reserveMemory(item)
+		d.indexLookup(index, item)
+
+		// Drop the now stale disk record kept when the item was loaded from disk, if any
+		if err := d.disk.remove(index); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete from disk: %w", err)
+		}
+		d.markEnvelope(index, false)
+		return nil
+	}
+
+	// Keep any metadata stored with the item
+	var itemMeta map[string]string
+	if d.envelopes[index] {
+		var err error
+		if _, itemMeta, err = d.retrieveWithMeta(index); err != nil {
+			return err
+		}
+	}
+
+	data, err := d.encodeWithMeta(item, itemMeta)
+	if err != nil {
+		return err
+	}
+	if err := d.logPut(index, data); err != nil {
+		return err
+	}
+	if err := d.putWithMeta(index, data, itemMeta != nil); err != nil {
+		return err
+	}
+
+	d.indexLookup(index, item)
+	return nil
+}
+
+// Delete removes the item at the given sorted index from the DBList.
+func (d *DBList[T]) Delete(index int) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return err
+	}
+
+	return d.deleteAt(index)
+}
+
+// deleteAt removes the item at the given sorted index. The caller must hold the write lock.
+func (d *DBList[T]) deleteAt(index int) error {
+	if index < 0 || index >= len(d.sortedIndexes) {
+		return fmt.Errorf("index out of range")
+	}
+
+	_, inMemory := d.memoryData[d.sortedIndexes[index]]
+	if err := d.logDelete(d.sortedIndexes[index]); err != nil {
+		return err
+	}
+	if err := d.deleteFromStorage(d.sortedIndexes[index]); err != nil {
+		return err
+	}
+
+	d.sortedIndexes = append(d.sortedIndexes[:index], d.sortedIndexes[index+1:]...)
+	d.totalCount--
+	d.generation++
+
+	if inMemory && d.promote {
+		d.promoteFromDisk()
+	}
+
+	return nil
+}
+
+// Pop removes the last item in sorted order and returns it, or ErrEmpty if there are no items.
+// Together with Add it lets the list be used as a stack.
+func (d *DBList[T]) Pop() (T, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var zero T
+	if err := d.checkWritable(); err != nil {
+		return zero, err
+	}
+	if len(d.sortedIndexes) == 0 {
+		return zero, ErrEmpty
+	}
+
+	last := len(d.sortedIndexes) - 1
+	item, err := d.getFromStorage(d.sortedIndexes[last])
+	if err != nil {
+		return zero, err
+	}
+
+	if err := d.deleteAt(last); err != nil {
+		return zero, err
+	}
+
+	return item, nil
+}
+
+// Prune removes every item for which shouldRemove returns true and reports how many were removed.
+// All items are examined before any are removed, and the write lock is held throughout.
+// If ctx is cancelled or an item cannot be loaded while examining, nothing is removed.
+func (d *DBList[T]) Prune(ctx context.Context, shouldRemove func(T) bool) (removed int, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	var positions []int
+	for i, index := range d.sortedIndexes {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		item, err := d.getFromStorage(index)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load index %d: %w", index, err)
+		}
+		if shouldRemove(item) {
+			positions = append(positions, i)
+		}
+	}
+
+	// Deleting from the end keeps the earlier positions valid
+	for i := len(positions) - 1; i >= 0; i-- {
+		if err := d.deleteAt(positions[i]); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// Truncate caps the list at maxItems items, removing the excess from the front of the sorted
+// order if fromEnd is false, or from the end if it is true, and reports how many were removed.
+// For a list that has not been reordered the front holds the oldest items. If removing an item
+// fails, the ones already removed stay removed.
+func (d *DBList[T]) Truncate(maxItems int, fromEnd bool) (removed int, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return 0, err
+	}
+	if maxItems < 0 {
+		return 0, fmt.Errorf("invalid maximum size %d", maxItems)
+	}
+
+	excess := len(d.sortedIndexes) - maxItems
+	freed := 0
+	for removed < excess {
+		// Remove one item at a time from the chosen end, so a failure leaves the order intact
+		pos := removed
+		if fromEnd {
+			pos = len(d.sortedIndexes) - 1 - removed
+		}
+		index := d.sortedIndexes[pos]
+
+		if _, inMemory := d.memoryData[index]; inMemory {
+			freed++
+		}
+		if err = d.logDelete(index); err != nil {
+			break
+		}
+		if err = d.deleteFromStorage(index); err != nil {
+			break
+		}
+		removed++
+	}
+
+	if fromEnd {
+		d.sortedIndexes = d.sortedIndexes[:len(d.sortedIndexes)-removed]
+	} else {
+		d.sortedIndexes = slices.Delete(d.sortedIndexes, 0, removed)
+	}
+	d.totalCount -= removed
+	d.generation++
+
+	if d.promote {
+		for i := 0; i < freed; i++ {
+			d.promoteFromDisk()
+		}
+	}
+
+	return removed, err
+}
+
+// Dedup removes every item whose key has already been seen earlier in sorted order, keeping
+// the first occurrence of each key, and reports how many were removed. Like Prune, all items
+// are examined before any are removed and nothing is removed if an item cannot be loaded.
+// The keys seen are held in memory, so the key should be short for a large list.
+func (d *DBList[T]) Dedup(key func(T) string) (removed int, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	seen := make(map[string]struct{})
+	var positions []int
+	for i, index := range d.sortedIndexes {
+		item, err := d.getFromStorage(index)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load index %d: %w", index, err)
+		}
+
+		k := key(item)
+		if _, ok := seen[k]; ok {
+			positions = append(positions, i)
+			continue
+		}
+		seen[k] = struct{}{}
+	}
+
+	for i := len(positions) - 1; i >= 0; i-- {
+		if err := d.deleteAt(positions[i]); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// deleteFromStorage removes the item at the given physical index, either from memory or disk.
+func (d *DBList[T]) deleteFromStorage(index int) error {
+	delete(d.addedAt, index)
+	delete(d.itemMeta, index)
+	delete(d.envelopes, index)
+	if d.recency != nil {
+		d.recency.forget(index)
+	}
+
+	item, inMemory := d.memoryData[index]
+	if inMemory {
+		d.releaseMemory(item)
+		delete(d.memoryData, index)
+	}
+
+	// Memory items only have a disk record if they were loaded from disk
+	if err := d.disk.remove(index); err != nil && !(inMemory && errors.Is(err, os.ErrNotExist)) {
+		return fmt.Errorf("failed to delete from disk: %w", err)
+	}
+
+	// The record may be named by its key, so the key is only dropped once it is gone
+	if d.keys != nil {
+		d.keys.forget(index)
+	}
+	if d.lookups != nil {
+		d.lookups.forget(index)
+	}
+
+	return nil
+}
+
+func (d *DBList[T]) retrieveFromDisk(index int) (T, error) {
+	item, _, err := d.retrieveWithMeta(index)
+	return item, err
+}
+
+// retrieveWithMeta reads the item at the given physical index from disk, along with any
+// metadata stored with it by AddWithMeta.
+func (d *DBList[T]) retrieveWithMeta(index int) (T, map[string]string, error) {
+	data, err := d.disk.get(index)
+	if err != nil {
+		var zero T
+		if errors.Is(err, os.ErrNotExist) {
+			return zero, nil, fmt.Errorf("failed to read from disk: %w: %w", ErrIndexNotFound, err)
+		}
+		return zero, nil, fmt.Errorf("failed to read from disk: %w", err)
+	}
+
+	return d.decode(data)
+}
+
+// encode serializes a value, normally an item, into the record stored on disk.
+func (d *DBList[T]) encode(v any) ([]byte, error) {
+	data, err := d.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if d.types != nil {
+		if data, err = d.types.tag(v, data); err != nil {
+			return nil, err
+		}
+	}
+	if d.recordKinds {
+		kind := recordItem
+		if _, ok := v.(recordEnvelope[T]); ok {
+			kind = recordWithMeta
+		}
+		data = append([]byte{kind}, data...)
+	}
+
+	if d.compression == Gzip {
+		if data, err = gzipCompress(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.encryptionKey != nil {
+		if data, err = encrypt(d.encryptionKey, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.checksum {
+		data = addChecksum(data)
+	}
+
+	return data, nil
+}
+
+// decode deserializes an item from a record stored on disk, along with the metadata stored
+// with it if the record is an envelope.
+func (d *DBList[T]) decode(data []byte) (T, map[string]string, error) {
+	var err error
+	var item T
+
+	if d.checksum {
+		if data, err = verifyChecksum(data); err != nil {
+			return item, nil, fmt.Errorf("failed to verify data: %w: %w", ErrCorruptRecord, err)
+		}
+	}
+
+	if d.encryptionKey != nil {
+		if data, err = decrypt(d.encryptionKey, data); err != nil {
+			return item, nil, fmt.Errorf("failed to decrypt data: %w: %w", ErrCorruptRecord, err)
+		}
+	}
+
+	if d.compression == Gzip {
+		if data, err = gzipDecompress(data); err != nil {
+			return item, nil, fmt.Errorf("failed to decompress data: %w: %w", ErrCorruptRecord, err)
+		}
+	}
+
+	if d.recordKinds {
+		if len(data) == 0 {
+			return item, nil, fmt.Errorf("failed to read record kind: %w", ErrCorruptRecord)
+		}
+		switch kind := data[0]; kind {
+		case recordItem:
+			data = data[1:]
+		case recordWithMeta:
+			var env recordEnvelope[T]
+			err := d.unmarshal(data[1:], &env)
+			return env.Item, env.Meta, err
+		default:
+			return item, nil, fmt.Errorf("failed to read record kind: %w: unknown kind %d", ErrCorruptRecord, kind)
+		}
+	}
+
+	err = d.unmarshal(data, &item)
+	return item, nil, err
+}
+
+// unmarshal deserializes the encoding of an item, or of a recordEnvelope, into v.
+func (d *DBList[T]) unmarshal(data []byte, v any) error {
+	var err error
+
+	if d.types != nil {
+		if data, err = d.types.prepare(data, v); err != nil {
+			return fmt.Errorf("failed to read type: %w: %w", ErrCorruptRecord, err)
+		}
+	}
+
+	if err := d.codec.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to unmarshal data: %w: %w", ErrCorruptRecord, err)
+	}
+
+	return nil
+}
+
+// Iterator returns a channel that iterates over all elements, both in memory and on disk.
+// It covers the elements present when Iterator is called; items added afterwards are not included.
+func (d *DBList[T]) Iterator(ctx context.Context) <-chan T {
+	return d.RangeIterator(ctx, 0, d.Size())
+}
+
+// RangeIterator returns a channel that yields the items at sorted indexes [start, end), clipped
+// to the items present when it is called, without collecting them into a slice as Range does.
+// As with Iterator, items that cannot be loaded are logged and skipped, and the channel is
+// closed once the range is exhausted or ctx is cancelled.
+func (d *DBList[T]) RangeIterator(ctx context.Context, start, end int) <-chan T {
+	ch := make(chan T)
+	start = max(start, 0)
+	end = min(end, d.Size())
+
+	go func() {
+		defer close(ch)
+
+		for i := start; i < end; i++ {
+			if ctx.Err() != nil {
+				// Exit if the context has been cancelled or timed out
+				return
+			}
+
+			item, err := d.iterGet(i)
+			if errors.Is(err, ErrClosed) {
+				return
+			}
+			if errors.Is(err, errExpired) {
+				continue
+			}
+			if err != nil {
+				d.logger.Error(fmt.Sprintf("DBList failed to load index %d", i), "error", err)
+				continue
+			}
+
+			select {
+			case ch <- item:
+			case <-ctx.Done():
+				// Exit if context is cancelled
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// ItemResult is an element yielded by IteratorErr: either an item or the error loading it.
+type ItemResult[T any] struct {
+	Item T
+	Err  error
+}
+
+// IteratorErr is like Iterator, but instead of logging the items it cannot load it sends
+// their errors, so a missing or corrupt record can be told apart from the end of the list.
+// Iteration continues after an item fails to load, and stops after sending ErrClosed.
+func (d *DBList[T]) IteratorErr(ctx context.Context) <-chan ItemResult[T] {
+	ch := make(chan ItemResult[T])
+	count := d.Size()
+
+	go func() {
+		defer close(ch)
+
+		for i := 0; i < count; i++ {
+			if ctx.Err() != nil {
+				return
+			}
+
+			item, err := d.iterGet(i)
+			if errors.Is(err, errExpired) {
+				continue
+			}
+			if err != nil {
+				err = fmt.Errorf("failed to load index %d: %w", i, err)
+			}
+
+			select {
+			case ch <- ItemResult[T]{Item: item, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+
+			if errors.Is(err, ErrClosed) {
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Drain returns a channel that yields the items of the list in sorted order, as a queue
+// consumer would pop them from the front, removing each item and its disk record once it has
+// been received. Items added meanwhile are yielded too. The channel is closed when the list is
+// empty, when ctx is cancelled, which leaves every item not yet received in the list, or when
+// the first item cannot be loaded or removed, which is logged and also leaves it in place.
+func (d *DBList[T]) Drain(ctx context.Context) <-chan T {
+	ch := make(chan T)
+
+	go func() {
+		defer close(ch)
+
+		for ctx.Err() == nil {
+			item, physical, err := d.front()
+			if errors.Is(err, ErrEmpty) || errors.Is(err, ErrClosed) {
+				return
+			}
+			if err != nil {
+				d.logger.Error("DBList failed to load the first item to drain", "error", err)
+				return
+			}
+
+			select {
+			case ch <- item:
+			case <-ctx.Done():
+				return
+			}
+
+			if err := d.removePhysical(physical); err != nil {
+				d.logger.Error(fmt.Sprintf("DBList failed to remove drained index %d", physical), "error", err)
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// front returns the first item in sorted order and its physical index.
+func (d *DBList[T]) front() (T, int, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	var zero T
+	if err := d.checkWritable(); err != nil {
+		return zero, 0, err
+	}
+	if len(d.sortedIndexes) == 0 {
+		return zero, 0, ErrEmpty
+	}
+
+	physical := d.sortedIndexes[0]
+	item, err := d.getFromStorage(physical)
+	return item, physical, err
+}
+
+// removePhysical deletes the item at physical index from wherever it now is in the sorted
+// order, doing nothing if it has already been deleted.
+func (d *DBList[T]) removePhysical(physical int) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return err
+	}
+
+	if pos := slices.Index(d.sortedIndexes, physical); pos >= 0 {
+		return d.deleteAt(pos)
+	}
+	return nil
+}
+
+// IteratorBuffered is like Iterator, but loads up to prefetch items ahead of the consumer in
+// background goroutines, so reading from disk overlaps with processing earlier items. Items
+// are still delivered in sorted order. A prefetch below 1 is treated as 1.
+func (d *DBList[T]) IteratorBuffered(ctx context.Context, prefetch int) <-chan T {
+	if prefetch < 1 {
+		prefetch = 1
+	}
+
+	type result struct {
+		item T
+		err  error
+	}
+
+	ch := make(chan T)
+	count := d.Size()
+	ctx, cancel := context.WithCancel(ctx)
+
+	// Each load gets its own result channel, queued in order; the queue bounds how far ahead we read
+	pending := make(chan chan result, prefetch)
+	go func() {
+		defer close(pending)
+
+		for i := 0; i < count; i++ {
+			res := make(chan result, 1)
+			select {
+			case pending <- res:
+			case <-ctx.Done():
+				return
+			}
+
+			go func() {
+				item, err := d.iterGet(i)
+				res <- result{item: item, err: err}
+			}()
+		}
+	}()
+
+	go func() {
+		defer close(ch)
+		defer cancel()
+
+		i := 0
+		for res := range pending {
+			r := <-res
+			if ctx.Err() != nil {
+				return
+			}
+
+			if errors.Is(r.err, ErrClosed) {
+				return
+			}
+			if errors.Is(r.err, errExpired) {
+				i++
+				continue
+			}
+			if r.err != nil {
+				d.logger.Error(fmt.Sprintf("DBList failed to load index %d", i), "error", r.err)
+				i++
+				continue
+			}
+
+			select {
+			case ch <- r.item:
+			case <-ctx.Done():
+				return
+			}
+			i++
+		}
+	}()
+
+	return ch
+}
+
+// All returns an iterator over all elements in sorted order, for use with range.
+// Unlike Iterator, no goroutine is started, so breaking out of the loop needs no cleanup.
+func (d *DBList[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for _, item := range d.All2() {
+			if !yield(item) {
+				return
+			}
+		}
+	}
+}
+
+// All2 returns an iterator over all elements in sorted order, yielding each sorted index with its element.
+// Like Iterator, it covers the elements present when the loop starts.
+func (d *DBList[T]) All2() iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		count := d.Size()
+		for i := 0; i < count; i++ {
+			item, err := d.iterGet(i)
+			if errors.Is(err, ErrClosed) {
+				return
+			}
+			if errors.Is(err, errExpired) {
+				continue
+			}
+			if err != nil {
+				d.logger.Error(fmt.Sprintf("DBList failed to load index %d", i), "error", err)
+				continue
+			}
+
+			if !yield(i, item) {
+				return
+			}
+		}
+	}
+}
+
+// CountWhere returns the number of items, in memory or on disk, for which pred returns true.
+// It loads the items one at a time, and like Reduce it stops with the error of an item that
+// cannot be loaded, or with the context's error if ctx is cancelled.
+func (d *DBList[T]) CountWhere(ctx context.Context, pred func(T) bool) (int, error) {
+	count, err := Reduce(ctx, d, 0, func(n int, item T) int {
+		if pred(item) {
+			n++
+		}
+		return n
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// SampleN returns n items chosen uniformly at random with r, or every item if there are no
+// more than n, by reservoir sampling: the items are loaded one at a time in sorted order and
+// only the sample is kept, so a list on disk is never held in memory as a whole. The sample is
+// not in sorted order. Like Reduce it stops with the error of an item that cannot be loaded.
+func (d *DBList[T]) SampleN(n int, r *rand.Rand) ([]T, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid sample size %d", n)
+	}
+	if n == 0 {
+		return []T{}, nil
+	}
+
+	seen := 0
+	sample, err := Reduce(context.Background(), d, make([]T, 0, min(n, d.Size())), func(sample []T, item T) []T {
+		seen++
+		if len(sample) < n {
+			return append(sample, item)
+		}
+		if i := r.Intn(seen); i < n {
+			sample[i] = item
+		}
+		return sample
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sample, nil
+}
+
+// Equal reports whether d and other have the same size and eq returns true for the items at
+// each sorted position, comparing them one pair at a time through Get and stopping at the first
+// pair that differs, so neither list is copied to a slice. Each Get takes its list's lock on its
+// own, so a list modified during the comparison may be compared partly before and partly after.
+func (d *DBList[T]) Equal(other *DBList[T], eq func(a, b T) bool) (bool, error) {
+	size := d.Size()
+	if other.Size() != size {
+		return false, nil
+	}
+
+	for i := range size {
+		a, err := d.Get(i)
+		if err != nil {
+			return false, err
+		}
+		b, err := other.Get(i)
+		if err != nil {
+			return false, err
+		}
+		if !eq(a, b) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Filter returns a new DBList holding the items for which keep returns true, in sorted order.
+// The new list uses the same settings as this one and keeps its disk tier in a new temporary
+// directory, which its Close removes instead of persisting the list, as with
+// WithEphemeralStorage; a list made with InMemoryOnly gets no directory. An item that cannot be
+// loaded stops the filter with its error.
+func (d *DBList[T]) Filter(ctx context.Context, keep func(T) bool) (*DBList[T], error) {
+	var dir string
+	if !d.memoryOnly {
+		var err error
+		if dir, err = os.MkdirTemp("", "dblist-filter-"); err != nil {
+			return nil, fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+	filtered := newDBList[T](dir, d.maxInMemory, d.derivedOptions())
+	filtered.createdDir = dir
+
+	if err := d.filterInto(ctx, keep, filtered); err != nil {
+		if dir != "" {
+			os.RemoveAll(dir)
+		}
+		return nil, err
+	}
+
+	return filtered, nil
+}
+
+// filterInto adds the items for which keep returns true to filtered, stopping with the first
+// item that cannot be loaded or added.
+func (d *DBList[T]) filterInto(ctx context.Context, keep func(T) bool, filtered *DBList[T]) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for result := range d.IteratorErr(ctx) {
+		if result.Err != nil {
+			return result.Err
+		}
+		if !keep(result.Item) {
+			continue
+		}
+		if err := filtered.Add(result.Item); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// Partition streams the items of the list in sorted order into two new lists, match for the items
+// for which pred returns true and rest for the others, each at its own path with up to
+// maxInMemory items in memory and otherwise the settings of this list. If ctx is cancelled or an
+// item cannot be loaded or added, both new lists are discarded, removing what they wrote to
+// disk, and the error is returned.
+func (d *DBList[T]) Partition(ctx context.Context, pred func(T) bool, matchPath, restPath string, maxInMemory int) (match, rest *DBList[T], err error) {
+	matchDir, restDir := missingAncestor(matchPath), missingAncestor(restPath)
+	matched := newDBList[T](matchPath, maxInMemory, d.derivedOptions())
+	others := newDBList[T](restPath, maxInMemory, d.derivedOptions())
+
+	if err := d.partition(ctx, pred, matched, others); err != nil {
+		matched.discard(matchDir)
+		others.discard(restDir)
+		return nil, nil, err
+	}
+
+	return matched, others, nil
+}
+
+// partition adds each item of the list to match or rest by pred.
+func (d *DBList[T]) partition(ctx context.Context, pred func(T) bool, match, rest *DBList[T]) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for result := range d.IteratorErr(ctx) {
+		if result.Err != nil {
+			return result.Err
+		}
+
+		dst := rest
+		if pred(result.Item) {
+			dst = match
+		}
+		if err := dst.Add(result.Item); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// discard deletes everything the list has written to disk, including the directories from
+// createdDir down if it is not empty, and closes the list without persisting anything.
+func (d *DBList[T]) discard(createdDir string) error {
+	if err := d.Clear(); err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.createdDir = createdDir
+	return d.closeEphemeral()
+}
+
+// Sort will rebuild the sorted index based on the provided compare function.
+// The sort is stable, so items that compare equal keep their relative order.
+// The new order is computed on a copy under the read lock, so Get and the iterators keep
+// working against the old order while items are compared, and it is swapped in under a
+// brief write lock. If the list is modified meanwhile, the copy is discarded and the sort
+// is redone under the write lock.
+func (d *DBList[T]) Sort(compare func(a, b T) bool) {
+	d.sort(compare, sort.SliceStable)
+}
+
+// SortUnstable rebuilds the sorted index like Sort, but with an unstable sort, which makes
+// fewer comparisons and moves. Items that compare equal may end up in any order, so use it
+// when compare never reports two distinct items as equal or their order does not matter.
+func (d *DBList[T]) SortUnstable(compare func(a, b T) bool) {
+	d.sort(compare, sort.Slice)
+}
+
+// sort implements Sort and SortUnstable, ordering the physical indexes with sortSlice.
+func (d *DBList[T]) sort(compare func(a, b T) bool, sortSlice func(x any, less func(i, j int) bool)) {
+	d.mutex.RLock()
+	if d.isSorted {
+		d.mutex.RUnlock()
+		return
+	}
+	generation := d.generation
+	order := d.sortOrder(slices.Clone(d.sortedIndexes), compare, sortSlice)
+	d.mutex.RUnlock()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.generation != generation {
+		if d.isSorted {
+			return
+		}
+		order = d.sortOrder(d.sortedIndexes, compare, sortSlice)
+	}
+
+	d.sortedIndexes = order
+	d.isSorted = true
+	d.generation++
+
+	if err := d.persistSortOrder(); err != nil {
+		d.logger.Error("DBList failed to save its sort order", "error", err)
+	}
+}
+
+// sortOrder sorts the physical indexes in order by compare with sortSlice and returns them.
+// The caller must hold the lock.
+func (d *DBList[T]) sortOrder(order []int, compare func(a, b T) bool, sortSlice func(x any, less func(i, j int) bool)) []int {
+	sortSlice(order, func(i, j int) bool {
+		itemA, _ := d.getFromStorage(order[i])
+		itemB, _ := d.getFromStorage(order[j])
+		return compare(itemA, itemB)
+	})
+
+	return order
+}
+
+// Swap exchanges the items at sorted indexes i and j, marking the list as unsorted.
+// Only the sorted order changes; the items stay where they are in storage.
+func (d *DBList[T]) Swap(i, j int) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	if i < 0 || i >= len(d.sortedIndexes) || j < 0 || j >= len(d.sortedIndexes) {
+		return fmt.Errorf("index out of range")
+	}
+
+	d.sortedIndexes[i], d.sortedIndexes[j] = d.sortedIndexes[j], d.sortedIndexes[i]
+	d.isSorted = false
+	d.generation++
+
+	return nil
+}
+
+// Reverse reverses the sorted order in place without touching storage. The list is
+// marked unsorted, so a later Sort rebuilds the order rather than returning early.
+func (d *DBList[T]) Reverse() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	slices.Reverse(d.sortedIndexes)
+	d.isSorted = false
+	d.generation++
+
+	return nil
+}
+
+// Shuffle puts the sorted order in a random order drawn from r, without touching storage. Like
+// Reverse, it marks the list unsorted. Passing a generator with a fixed seed gives the same
+// order every time for lists of the same size.
+func (d *DBList[T]) Shuffle(r *rand.Rand) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	r.Shuffle(len(d.sortedIndexes), func(i, j int) {
+		d.sortedIndexes[i], d.sortedIndexes[j] = d.sortedIndexes[j], d.sortedIndexes[i]
+	})
+	d.isSorted = false
+	d.generation++
+
+	return nil
+}
+
+// Map returns a new DBList at dstPath holding the result of applying f to each item of src, in sorted order.
+// The new list is created as by NewDBList with opts, since the settings of src are for another
+// element type; without them it is unencrypted, uncompressed and uses the default codec. If ctx
+// is cancelled or an item of src cannot be loaded or added, the new list is discarded, removing
+// what it wrote to disk, and the error is returned.
+func Map[T, U any](ctx context.Context, src *DBList[T], f func(T) U, dstPath string, maxInMemory int, opts ...Option) (*DBList[U], error) {
+	dstDir := missingAncestor(dstPath)
+	dst := NewDBList[U](dstPath, maxInMemory, opts...)
+
+	if err := mapInto(ctx, src, f, dst); err != nil {
+		dst.discard(dstDir)
+		return nil, err
+	}
+
+	return dst, nil
+}
+
+// mapInto adds the result of applying f to each item of src to dst.
+func mapInto[T, U any](ctx context.Context, src *DBList[T], f func(T) U, dst *DBList[U]) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for result := range src.IteratorErr(ctx) {
+		if result.Err != nil {
+			return result.Err
+		}
+		if err := dst.Add(f(result.Item)); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// GroupBy splits src into one DBList per key, appending each item in sorted order to the list
+// for key(item). Each list is created when its key is first seen, at pathFor(key) and with
+// maxInMemory items in memory, and otherwise with the settings of src, such as its codec,
+// compression and encryption. If ctx is cancelled, an item of src cannot be loaded or an Add
+// fails, the lists created so far are returned along with the error.
+func GroupBy[T any, K comparable](ctx context.Context, src *DBList[T], key func(T) K, pathFor func(K) string, maxInMemory int) (map[K]*DBList[T], error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	groups := make(map[K]*DBList[T])
+	for result := range src.IteratorErr(ctx) {
+		if result.Err != nil {
+			return groups, result.Err
+		}
+
+		k := key(result.Item)
+		dst, ok := groups[k]
+		if !ok {
+			dst = newDBList[T](pathFor(k), maxInMemory, src.derivedOptions())
+			groups[k] = dst
+		}
+		if err := dst.Add(result.Item); err != nil {
+			return groups, err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return groups, err
+	}
+
+	return groups, nil
+}
+
+// Reduce folds f over the items of src in sorted order, starting from init, and returns the
+// final accumulator. Unlike iterating with Iterator, an item that cannot be loaded stops the
+// fold with its error. It stops with the context's error if ctx is cancelled.
+func Reduce[T, A any](ctx context.Context, src *DBList[T], init A, f func(A, T) A) (A, error) {
+	acc := init
+	count := src.Size()
+	for i := 0; i < count; i++ {
+		if err := ctx.Err(); err != nil {
+			return acc, err
+		}
+
+		item, err := src.get(i)
+		if err != nil {
+			return acc, err
+		}
+		acc = f(acc, item)
+	}
+
+	return acc, nil
+}
+
+// SortByKey rebuilds the sorted index of the list by comparing the keys extracted from each item.
+// Unlike Sort, each item is loaded from storage only once, so a disk-backed list costs O(n) reads.
+func SortByKey[T any, K cmp.Ordered](d *DBList[T], key func(T) K) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	if d.isSorted {
+		return nil
+	}
+
+	type keyed struct {
+		key   K
+		index int
+	}
+
+	keys := make([]keyed, len(d.sortedIndexes))
+	for i, index := range d.sortedIndexes {
+		item, err := d.getFromStorage(index)
+		if err != nil {
+			return fmt.Errorf("failed to load index %d: %w", index, err)
+		}
+		keys[i] = keyed{key: key(item), index: index}
+	}
+
+	slices.SortStableFunc(keys, func(a, b keyed) int {
+		return cmp.Compare(a.key, b.key)
+	})
+
+	for i, k := range keys {
+		d.sortedIndexes[i] = k.index
+	}
+	d.isSorted = true
+	d.generation++
+
+	return d.persistSortOrder()
+}
+
+// filePathForIndex generates the file path for a given index and ensures the path exists if required.
+func (d *DBList[T]) filePathForIndex(index int, create bool) (string, error) {
+	// Without a disk path there is no record, rather than one in the working directory
+	if d.diskPath == "" {
+		return "", fmt.Errorf("%w: %w", ErrNoDiskPath, os.ErrNotExist)
+	}
+
+	filePath := filepath.Join(d.diskPath, d.fileBaseName(index)+d.fileExtension())
+	if d.pathMapper != nil {
+		var err error
+		if filePath, err = d.mappedPath(index); err != nil {
+			return "", err
+		}
+	}
+
+	if create {
+		// Ensure the directory exists
+		dirPath := filepath.Dir(filePath)
+		if err := os.MkdirAll(dirPath, d.dirMode); err != nil {
+			return "", fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+
+	return filePath, nil
+}
+
+// fileBaseName returns the name without extension of the file generated by filePathForIndex.
+func (d *DBList[T]) fileBaseName(index int) string {
+	if d.keyedFiles {
+		if key, ok := d.keys.keyFor(index); ok {
+			return key
+		}
+	}
+	return fmt.Sprintf("%0*d", d.zeroPadding, index)
+}
+
+// fileExtension returns the extension of the files generated by filePathForIndex.
+func (d *DBList[T]) fileExtension() string {
+	if d.extension != "" {
+		return d.extension
+	}
+	if d.compression == Gzip {
+		return ".json.gz"
+	}
+	return ".json"
+}
+
+// indexForFileName parses the index from a file name generated by filePathForIndex.
+func (d *DBList[T]) indexForFileName(name string) (int, bool) {
+	if !d.keyedFiles {
+		return d.indexName(name)
+	}
+
+	if key, ok := strings.CutSuffix(name, d.fileExtension()); ok {
+		if index, ok := d.keys.lookup(key); ok {
+			return index, true
+		}
+	}
+	index, ok := d.indexName(name)
+	if _, keyed := d.keys.keyFor(index); !ok || keyed {
+		return 0, false
+	}
+	return index, true
+}
+
+// indexName parses the index from a file name generated by filePathForIndex for an item with
+// no key.
+func (d *DBList[T]) indexName(name string) (int, bool) {
+	base, ok := strings.CutSuffix(name, d.fileExtension())
+	if !ok {
+		return 0, false
+	}
+
+	index, err := strconv.Atoi(base)
+	if err != nil || index < 0 || d.fileBaseName(index) != base {
+		return 0, false
+	}
+
+	return index, true
 }
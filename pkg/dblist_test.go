@@ -1,9 +1,20 @@
 package util
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 type Item struct {
@@ -100,3 +111,2189 @@ func TestDBList_Concurrency(t *testing.T) {
 		t.Errorf("Expected size to be 100, got %d", got)
 	}
 }
+
+// TestDBList_ConcurrentAddGet tests that items added concurrently to disk can be read as soon as they are visible.
+func TestDBList_ConcurrentAddGet(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0)
+
+	var wg sync.WaitGroup
+	wg.Add(10)
+	for w := 0; w < 10; w++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if err := list.Add(Item{ID: i}); err != nil {
+					t.Errorf("Failed to add item: %v", err)
+				}
+				if _, err := list.Get(list.Size() - 1); err != nil {
+					t.Errorf("Failed to get item: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := list.Size(); got != 200 {
+		t.Errorf("Expected size to be 200, got %d", got)
+	}
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close list: %v", err)
+	}
+
+	reopened, err := OpenDBList[Item](tempDir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if got := reopened.Size(); got != 200 {
+		t.Errorf("Expected reopened size to be 200, got %d", got)
+	}
+}
+
+// TestDBList_Delete tests deleting items from both memory and disk storage.
+func TestDBList_Delete(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2)
+
+	items := []Item{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}
+	list.Adds(items)
+
+	// Delete a memory item
+	if err := list.Delete(0); err != nil {
+		t.Fatalf("Failed to delete memory item: %v", err)
+	}
+
+	// Delete a disk item
+	filePath, _ := list.filePathForIndex(3, false)
+	if err := list.Delete(2); err != nil {
+		t.Fatalf("Failed to delete disk item: %v", err)
+	}
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Errorf("Expected file %s to be removed, got err %v", filePath, err)
+	}
+
+	if got := list.Size(); got != 2 {
+		t.Errorf("Expected size to be 2, got %d", got)
+	}
+
+	expected := []Item{{ID: 2}, {ID: 3}}
+	for i, want := range expected {
+		if item, err := list.Get(i); err != nil || !reflect.DeepEqual(item, want) {
+			t.Errorf("Get(%d): expected %v, got %v, err %v", i, want, item, err)
+		}
+	}
+
+	if err := list.Delete(2); err == nil {
+		t.Errorf("Expected error deleting out of range index")
+	}
+	if err := list.Delete(-1); err == nil {
+		t.Errorf("Expected error deleting negative index")
+	}
+}
+
+// TestDBList_DeleteThenAdd tests that freed memory slots don't collide with disk items.
+func TestDBList_DeleteThenAdd(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2)
+
+	list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}})
+	if err := list.Delete(0); err != nil {
+		t.Fatalf("Failed to delete memory item: %v", err)
+	}
+
+	// The new item takes the freed memory slot but must not shadow the disk item
+	if err := list.Add(Item{ID: 4}); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if got := len(list.memoryData); got != 2 {
+		t.Errorf("Expected 2 items in memory, got %d", got)
+	}
+
+	expected := []Item{{ID: 2}, {ID: 3}, {ID: 4}}
+	for i, want := range expected {
+		if item, err := list.Get(i); err != nil || !reflect.DeepEqual(item, want) {
+			t.Errorf("Get(%d): expected %v, got %v, err %v", i, want, item, err)
+		}
+	}
+}
+
+// TestDBList_Clear tests that Clear empties the list and removes its disk files.
+func TestDBList_Clear(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2)
+
+	list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}})
+
+	// An unrelated file in the same directory must survive
+	otherFile := filepath.Join(tempDir, "other.txt")
+	if err := os.WriteFile(otherFile, []byte("keep"), 0o644); err != nil {
+		t.Fatalf("Failed to write unrelated file: %v", err)
+	}
+
+	if err := list.Clear(); err != nil {
+		t.Fatalf("Failed to clear list: %v", err)
+	}
+
+	if got := list.Size(); got != 0 {
+		t.Errorf("Expected size to be 0, got %d", got)
+	}
+	if got := len(list.memoryData); got != 0 {
+		t.Errorf("Expected 0 items in memory, got %d", got)
+	}
+
+	for _, index := range []int{2, 3} {
+		filePath, _ := list.filePathForIndex(index, false)
+		if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+			t.Errorf("Expected file %s to be removed, got err %v", filePath, err)
+		}
+	}
+	if _, err := os.Stat(otherFile); err != nil {
+		t.Errorf("Expected unrelated file to survive, got err %v", err)
+	}
+
+	// The list is reusable after clearing
+	list.Adds([]Item{{ID: 5}, {ID: 6}, {ID: 7}})
+	if item, err := list.Get(2); err != nil || item.ID != 7 {
+		t.Errorf("Expected item 7 after reuse, got %v, err %v", item, err)
+	}
+}
+
+func TestDBList_ReplaceAll(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2)
+
+	list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}})
+
+	if err := list.ReplaceAll([]Item{{ID: 10}, {ID: 11}, {ID: 12}}); err != nil {
+		t.Fatalf("Failed to replace items: %v", err)
+	}
+
+	values, err := list.Values()
+	if err != nil {
+		t.Fatalf("Failed to read values: %v", err)
+	}
+	if !reflect.DeepEqual(values, []Item{{ID: 10}, {ID: 11}, {ID: 12}}) {
+		t.Errorf("Expected only the new items, got %v", values)
+	}
+
+	// The old items on disk are gone, and the new one that did not fit in memory is on disk
+	for _, index := range []int{2, 3} {
+		filePath, _ := list.filePathForIndex(index, false)
+		if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+			t.Errorf("Expected file %s to be removed, got err %v", filePath, err)
+		}
+	}
+	filePath, _ := list.filePathForIndex(6, false)
+	if _, err := os.Stat(filePath); err != nil {
+		t.Errorf("Expected the new item on disk at %s, got err %v", filePath, err)
+	}
+
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close list: %v", err)
+	}
+	reopened, err := OpenDBList[Item](tempDir, 2)
+	if err != nil {
+		t.Fatalf("Failed to reopen list: %v", err)
+	}
+	if values, err := reopened.Values(); err != nil || !reflect.DeepEqual(values, []Item{{ID: 10}, {ID: 11}, {ID: 12}}) {
+		t.Errorf("Expected the new items after reopening, got %v, err %v", values, err)
+	}
+
+	if err := reopened.ReplaceAll(nil); err != nil {
+		t.Fatalf("Failed to replace items with none: %v", err)
+	}
+	if got := reopened.Size(); got != 0 {
+		t.Errorf("Expected size to be 0, got %d", got)
+	}
+}
+
+// TestOpenDBList tests reopening a list from the files left on disk by a previous instance.
+func TestOpenDBList(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 1)
+
+	list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}})
+	// Leave a gap in the on-disk indexes
+	if err := list.Delete(2); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+
+	reopened, err := OpenDBList[Item](tempDir, 2)
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+
+	// Only disk items survive since the memory tier was never written out
+	expected := []Item{{ID: 2}, {ID: 4}, {ID: 5}}
+	if got := reopened.Size(); got != len(expected) {
+		t.Fatalf("Expected size to be %d, got %d", len(expected), got)
+	}
+	if got := len(reopened.memoryData); got != 2 {
+		t.Errorf("Expected 2 items in memory, got %d", got)
+	}
+	for i, want := range expected {
+		if item, err := reopened.Get(i); err != nil || !reflect.DeepEqual(item, want) {
+			t.Errorf("Get(%d): expected %v, got %v, err %v", i, want, item, err)
+		}
+	}
+
+	// New items must not overwrite existing files
+	if err := reopened.Add(Item{ID: 6}); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if item, err := reopened.Get(2); err != nil || item.ID != 5 {
+		t.Errorf("Expected item 5 to be intact, got %v, err %v", item, err)
+	}
+	if item, err := reopened.Get(3); err != nil || item.ID != 6 {
+		t.Errorf("Expected item 6, got %v, err %v", item, err)
+	}
+}
+
+// TestOpenDBList_Missing tests that opening a nonexistent path yields an empty list.
+func TestOpenDBList_Missing(t *testing.T) {
+	list, err := OpenDBList[Item](filepath.Join(t.TempDir(), "missing"), 2)
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if got := list.Size(); got != 0 {
+		t.Errorf("Expected size to be 0, got %d", got)
+	}
+}
+
+// TestOpenDBList_Corrupt tests that corrupt JSON on disk is reported.
+func TestOpenDBList_Corrupt(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "0.json"), []byte("{not json"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if _, err := OpenDBList[Item](tempDir, 2); err == nil {
+		t.Errorf("Expected error opening list with corrupt data")
+	}
+}
+
+// TestSortByKey tests sorting by an extracted key across memory and disk.
+func TestSortByKey(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2)
+
+	list.Adds([]Item{{ID: 5}, {ID: 3}, {ID: 4}, {ID: 1}, {ID: 2}})
+	if err := SortByKey(list, func(item Item) int { return item.ID }); err != nil {
+		t.Fatalf("Failed to sort: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if item, err := list.Get(i); err != nil || item.ID != i+1 {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, i+1, item, err)
+		}
+	}
+}
+
+// newBenchmarkList builds a disk-backed list of n items in shuffled ID order.
+func newBenchmarkList(b *testing.B, n int) *DBList[Item] {
+	b.Helper()
+	list := NewDBList[Item](b.TempDir(), 0)
+	for _, id := range rand.New(rand.NewSource(1)).Perm(n) {
+		if err := list.Add(Item{ID: id}); err != nil {
+			b.Fatalf("Failed to add item: %v", err)
+		}
+	}
+	return list
+}
+
+// BenchmarkDBList_Sort sorts a list held on disk, restoring the same shuffled order before
+// each sort.
+func BenchmarkDBList_Sort(b *testing.B) {
+	list := newBenchmarkList(b, 50000)
+	shuffled := slices.Clone(list.sortedIndexes)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		copy(list.sortedIndexes, shuffled)
+		list.isSorted = false
+		b.StartTimer()
+
+		list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+	}
+}
+
+// TestDBList_SortUnstable tests that the stable and unstable sorts both order the list, across
+// memory and disk, and that only Sort is guaranteed to keep equal items in insertion order.
+func TestDBList_SortUnstable(t *testing.T) {
+	type pair struct{ Key, Seq int }
+	items := make([]pair, 200)
+	for i := range items {
+		items[i] = pair{Key: (i * 7919) % 10, Seq: i}
+	}
+	byKey := func(a, b pair) bool { return a.Key < b.Key }
+
+	for name, sortList := range map[string]func(*DBList[pair]){
+		"stable":   func(list *DBList[pair]) { list.Sort(byKey) },
+		"unstable": func(list *DBList[pair]) { list.SortUnstable(byKey) },
+	} {
+		list := NewDBList[pair](t.TempDir(), 50)
+		if err := list.Adds(items); err != nil {
+			t.Fatalf("%s: failed to add: %v", name, err)
+		}
+		sortList(list)
+
+		values, err := list.Values()
+		if err != nil {
+			t.Fatalf("%s: failed to read values: %v", name, err)
+		}
+		if len(values) != len(items) {
+			t.Fatalf("%s: expected %d items, got %d", name, len(items), len(values))
+		}
+		for i := 1; i < len(values); i++ {
+			if values[i-1].Key > values[i].Key {
+				t.Fatalf("%s: items %d and %d are out of order: %v, %v", name, i-1, i, values[i-1], values[i])
+			}
+			if name == "stable" && values[i-1].Key == values[i].Key && values[i-1].Seq > values[i].Seq {
+				t.Fatalf("%s: equal items %d and %d changed order", name, i-1, i)
+			}
+		}
+	}
+}
+
+// BenchmarkDBList_SortInMemory compares Sort and SortUnstable on a list held in memory,
+// restoring the same shuffled order before each sort.
+func BenchmarkDBList_SortInMemory(b *testing.B) {
+	const n = 100000
+	list := NewDBList[Item]("", n)
+	for _, id := range rand.New(rand.NewSource(1)).Perm(n) {
+		if err := list.Add(Item{ID: id}); err != nil {
+			b.Fatalf("Failed to add item: %v", err)
+		}
+	}
+	shuffled := slices.Clone(list.sortedIndexes)
+	less := func(a, b Item) bool { return a.ID < b.ID }
+
+	for name, sortList := range map[string]func(){
+		"Stable":   func() { list.Sort(less) },
+		"Unstable": func() { list.SortUnstable(less) },
+	} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				copy(list.sortedIndexes, shuffled)
+				list.isSorted = false
+				b.StartTimer()
+
+				sortList()
+			}
+		})
+	}
+}
+
+// BenchmarkSortByKey sorts a list held on disk by key, restoring the same shuffled order
+// before each sort.
+func BenchmarkSortByKey(b *testing.B) {
+	list := newBenchmarkList(b, 50000)
+	shuffled := slices.Clone(list.sortedIndexes)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		copy(list.sortedIndexes, shuffled)
+		list.isSorted = false
+		b.StartTimer()
+
+		if err := SortByKey(list, func(item Item) int { return item.ID }); err != nil {
+			b.Fatalf("Failed to sort: %v", err)
+		}
+	}
+}
+
+// TestDBList_All tests ranging over the list with All and All2, including breaking early.
+func TestDBList_All(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2)
+	list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}})
+
+	var ids []int
+	for item := range list.All() {
+		ids = append(ids, item.ID)
+	}
+	if !reflect.DeepEqual(ids, []int{1, 2, 3, 4}) {
+		t.Errorf("Expected IDs [1 2 3 4], got %v", ids)
+	}
+
+	for i, item := range list.All2() {
+		if item.ID != i+1 {
+			t.Errorf("Expected ID %d at index %d, got %d", i+1, i, item.ID)
+		}
+	}
+
+	count := 0
+	for range list.All() {
+		count++
+		if count == 2 {
+			break
+		}
+	}
+	if count != 2 {
+		t.Errorf("Expected to stop after 2 items, got %d", count)
+	}
+}
+
+// TestDBList_Update tests replacing items in both memory and disk storage.
+func TestDBList_Update(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 1)
+
+	list.Adds([]Item{{ID: 1}, {ID: 2}})
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+
+	if err := list.Update(0, Item{ID: 10}); err != nil {
+		t.Fatalf("Failed to update memory item: %v", err)
+	}
+	if err := list.Update(1, Item{ID: 20}); err != nil {
+		t.Fatalf("Failed to update disk item: %v", err)
+	}
+
+	if list.isSorted {
+		t.Errorf("Expected list to be unsorted after update")
+	}
+	if item, err := list.Get(0); err != nil || item.ID != 10 {
+		t.Errorf("Expected updated memory item 10, got %v, err %v", item, err)
+	}
+	if item, err := list.Get(1); err != nil || item.ID != 20 {
+		t.Errorf("Expected updated disk item 20, got %v, err %v", item, err)
+	}
+	if item, err := list.retrieveFromDisk(1); err != nil || item.ID != 20 {
+		t.Errorf("Expected disk file to hold item 20, got %v, err %v", item, err)
+	}
+
+	if err := list.Update(2, Item{}); err == nil {
+		t.Errorf("Expected error updating out of range index")
+	}
+}
+
+// TestDBList_Close tests that closing and reopening a list loses nothing and that a closed list is unusable.
+func TestDBList_Close(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2, WithWriteBuffer(10))
+
+	list.Adds([]Item{{ID: 4}, {ID: 2}, {ID: 5}, {ID: 1}, {ID: 3}})
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close list: %v", err)
+	}
+
+	if err := list.Add(Item{ID: 6}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from Add, got %v", err)
+	}
+	if _, err := list.Get(0); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from Get, got %v", err)
+	}
+	if err := list.Close(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from second Close, got %v", err)
+	}
+
+	reopened, err := OpenDBList[Item](tempDir, 2)
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if got := reopened.Size(); got != 5 {
+		t.Fatalf("Expected size to be 5, got %d", got)
+	}
+	for i := 0; i < 5; i++ {
+		if item, err := reopened.Get(i); err != nil || item.ID != i+1 {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, i+1, item, err)
+		}
+	}
+}
+
+// TestDBList_IteratorConcurrentAdd tests iterating while items are added, and is meant to be run with -race.
+func TestDBList_IteratorConcurrentAdd(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 5)
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}, {ID: 6}, {ID: 7}})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 8; i < 50; i++ {
+			if err := list.Add(Item{ID: i}); err != nil {
+				t.Errorf("Failed to add item: %v", err)
+			}
+		}
+	}()
+
+	count := 0
+	for item := range list.Iterator(context.Background()) {
+		if item.ID != count {
+			t.Errorf("Expected ID %d, got %d", count, item.ID)
+		}
+		count++
+	}
+	wg.Wait()
+
+	// The iterator only covers the items present when it was created
+	if count < 8 || count > 50 {
+		t.Errorf("Expected between 8 and 50 items, got %d", count)
+	}
+}
+
+// TestDBList_GetNegative tests retrieving items with negative indexes.
+func TestDBList_GetNegative(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 1)
+	list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}})
+
+	if item, err := list.Get(-1); err != nil || item.ID != 3 {
+		t.Errorf("Get(-1): expected ID 3, got %v, err %v", item, err)
+	}
+	if item, err := list.Get(-3); err != nil || item.ID != 1 {
+		t.Errorf("Get(-3): expected ID 1, got %v, err %v", item, err)
+	}
+	if _, err := list.Get(-4); err == nil {
+		t.Errorf("Get(-4): expected out of range error")
+	}
+}
+
+// TestDBList_Range tests retrieving a range of items spanning memory and disk.
+func TestDBList_Range(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2)
+	list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}, {ID: 6}})
+
+	items, err := list.Range(0, 5)
+	if err != nil {
+		t.Fatalf("Failed to get range: %v", err)
+	}
+	if expected := []Item{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}}; !reflect.DeepEqual(items, expected) {
+		t.Errorf("Expected %v, got %v", expected, items)
+	}
+
+	if items, err := list.Range(3, 3); err != nil || len(items) != 0 {
+		t.Errorf("Expected empty range, got %v, err %v", items, err)
+	}
+
+	for _, bounds := range [][2]int{{-1, 2}, {0, 7}, {4, 2}} {
+		if _, err := list.Range(bounds[0], bounds[1]); err == nil {
+			t.Errorf("Range(%d, %d): expected error", bounds[0], bounds[1])
+		}
+	}
+}
+
+// TestDBList_Filter tests filtering a disk-backed list into a new list, whose temporary
+// directory is removed by Close.
+func TestDBList_Filter(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2)
+	for i := 0; i < 10; i++ {
+		list.Add(Item{ID: i})
+	}
+
+	filtered, err := list.Filter(context.Background(), func(item Item) bool { return item.ID%3 == 0 })
+	if err != nil {
+		t.Fatalf("Failed to filter list: %v", err)
+	}
+	if got := filtered.Size(); got != 4 {
+		t.Fatalf("Expected size to be 4, got %d", got)
+	}
+	for i, want := range []int{0, 3, 6, 9} {
+		if item, err := filtered.Get(i); err != nil || item.ID != want {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, want, item, err)
+		}
+	}
+	if got := list.Size(); got != 10 {
+		t.Errorf("Expected source size to be unchanged, got %d", got)
+	}
+
+	if err := filtered.Close(); err != nil {
+		t.Fatalf("Failed to close filtered list: %v", err)
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("Expected the temporary directory to be removed, found %v", entries)
+	}
+}
+
+// TestDBList_FilterCancelled tests that Filter stops when its context is cancelled.
+func TestDBList_FilterCancelled(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := list.Filter(ctx, func(item Item) bool {
+		cancel()
+		return true
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// TestDBList_FilterLoadError tests that Filter fails on a record that cannot be loaded instead
+// of returning a shorter list.
+func TestDBList_FilterLoadError(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	dir := t.TempDir()
+	list := NewDBList[Item](dir, 1)
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+	if err := os.WriteFile(filepath.Join(dir, "1.json"), []byte("garbage"), 0o640); err != nil {
+		t.Fatalf("Failed to corrupt record: %v", err)
+	}
+
+	filtered, err := list.Filter(context.Background(), func(Item) bool { return true })
+	if !errors.Is(err, ErrCorruptRecord) || filtered != nil {
+		t.Errorf("Expected ErrCorruptRecord and no list, got %v, err %v", filtered, err)
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("Expected the temporary directory to be removed, found %v", entries)
+	}
+}
+
+// TestDBList_FilterInMemoryOnly tests that filtering an in-memory list creates no directory.
+func TestDBList_FilterInMemoryOnly(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	list, err := NewDBListWithOptions[Item](InMemoryOnly())
+	if err != nil {
+		t.Fatalf("Failed to create list: %v", err)
+	}
+	list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}})
+
+	filtered, err := list.Filter(context.Background(), func(item Item) bool { return item.ID != 2 })
+	if err != nil {
+		t.Fatalf("Failed to filter list: %v", err)
+	}
+	if size := filtered.Size(); size != 2 || filtered.diskPath != "" {
+		t.Errorf("Expected 2 items and no disk path, got %d at %q", size, filtered.diskPath)
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("Expected no temporary directory, found %v", entries)
+	}
+}
+
+// TestDBList_CountWhere tests counting even IDs across memory and disk, and cancellation.
+func TestDBList_CountWhere(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 3)
+	for i := range 10 {
+		list.Add(Item{ID: i})
+	}
+	even := func(item Item) bool { return item.ID%2 == 0 }
+
+	if count, err := list.CountWhere(context.Background(), even); err != nil || count != 5 {
+		t.Errorf("Expected 5 even IDs, got %d, err %v", count, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := list.CountWhere(ctx, even); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// TestDBList_Partition tests splitting a list into even and odd IDs, and that cancelling part
+// way through removes both new lists.
+func TestDBList_Partition(t *testing.T) {
+	dir := t.TempDir()
+	list := NewDBList[Item](filepath.Join(dir, "src"), 2)
+	list.Adds([]Item{{ID: 5}, {ID: 2}, {ID: 4}, {ID: 1}, {ID: 0}, {ID: 3}, {ID: 6}})
+	even := func(item Item) bool { return item.ID%2 == 0 }
+
+	match, rest, err := list.Partition(context.Background(), even, filepath.Join(dir, "even"), filepath.Join(dir, "odd"), 1)
+	if err != nil {
+		t.Fatalf("Failed to partition: %v", err)
+	}
+	for name, tc := range map[string]struct {
+		list     *DBList[Item]
+		expected []int
+	}{"match": {match, []int{2, 4, 0, 6}}, "rest": {rest, []int{5, 1, 3}}} {
+		values, err := tc.list.Values()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		var got []int
+		for _, item := range values {
+			got = append(got, item.ID)
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", name, tc.expected, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "odd", "1.json")); err != nil {
+		t.Errorf("Expected rest to spill to its own path: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	seen := 0
+	_, _, err = list.Partition(ctx, func(item Item) bool {
+		if seen++; seen == 4 {
+			cancel()
+		}
+		return even(item)
+	}, filepath.Join(dir, "cancelled", "even"), filepath.Join(dir, "cancelled", "odd"), 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cancelled")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the partial lists to be removed, got %v", err)
+	}
+	if size := list.Size(); size != 7 {
+		t.Errorf("Expected the source to be unchanged, got size %d", size)
+	}
+}
+
+// TestMap tests transforming a disk-backed list into a list of a different type.
+func TestMap(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 3}, {ID: 1}, {ID: 2}, {ID: 5}})
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+
+	ids, err := Map(context.Background(), list, func(item Item) int { return item.ID * 10 }, t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("Failed to map list: %v", err)
+	}
+
+	if got := ids.Size(); got != 4 {
+		t.Fatalf("Expected size to be 4, got %d", got)
+	}
+	for i, want := range []int{10, 20, 30, 50} {
+		if id, err := ids.Get(i); err != nil || id != want {
+			t.Errorf("Get(%d): expected %d, got %d, err %v", i, want, id, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Map(ctx, list, func(item Item) int { return item.ID }, t.TempDir(), 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// The destination takes its own options
+	dstDir := t.TempDir()
+	key := bytes.Repeat([]byte{7}, 32)
+	if _, err := Map(context.Background(), list, func(item Item) int { return item.ID }, dstDir, 0, WithEncryption(key)); err != nil {
+		t.Fatalf("Failed to map list with options: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dstDir, "0.json")); err != nil || bytes.Equal(data, []byte("1")) {
+		t.Errorf("Expected an encrypted record, got %q, err %v", data, err)
+	}
+
+	// An item that cannot be loaded stops the map instead of being skipped, and what was
+	// written before it is removed
+	if err := os.Remove(filepath.Join(list.diskPath, "3.json")); err != nil {
+		t.Fatalf("Failed to remove record: %v", err)
+	}
+	failDir := filepath.Join(t.TempDir(), "mapped")
+	if _, err := Map(context.Background(), list, func(item Item) int { return item.ID }, failDir, 0); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound, got %v", err)
+	}
+	if _, err := os.Stat(failDir); !os.IsNotExist(err) {
+		t.Errorf("Expected the destination to be removed, got err %v", err)
+	}
+}
+
+// TestDBList_Compact tests that compaction renumbers items and removes orphaned files.
+func TestDBList_Compact(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0)
+	for i := 0; i < 10; i++ {
+		list.Add(Item{ID: i})
+	}
+	list.Sort(func(a, b Item) bool { return a.ID > b.ID })
+
+	// Delete every other item, leaving gaps in the physical indexes
+	for i := 8; i >= 0; i -= 2 {
+		if err := list.Delete(i); err != nil {
+			t.Fatalf("Failed to delete item: %v", err)
+		}
+	}
+
+	// Simulate a file orphaned by a crash
+	orphanPath, _ := list.filePathForIndex(42, true)
+	if err := os.WriteFile(orphanPath, []byte(`{"ID":42}`), 0o644); err != nil {
+		t.Fatalf("Failed to write orphan file: %v", err)
+	}
+
+	if err := list.Compact(); err != nil {
+		t.Fatalf("Failed to compact list: %v", err)
+	}
+
+	found, err := list.disk.indexes()
+	if err != nil {
+		t.Fatalf("Failed to list disk files: %v", err)
+	}
+	if !reflect.DeepEqual(found, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("Expected files 0..4 after compaction, got %v", found)
+	}
+	if len(found) != list.Size() {
+		t.Errorf("Expected file count %d to equal size %d", len(found), list.Size())
+	}
+
+	for i, want := range []int{8, 6, 4, 2, 0} {
+		if item, err := list.Get(i); err != nil || item.ID != want {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, want, item, err)
+		}
+	}
+
+	if err := list.Add(Item{ID: 10}); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if item, err := list.Get(5); err != nil || item.ID != 10 {
+		t.Errorf("Expected new item after compaction, got %v, err %v", item, err)
+	}
+}
+
+// TestDBList_FirstLast tests the First and Last accessors on empty, single and multi-item lists.
+func TestDBList_FirstLast(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 1)
+
+	if _, err := list.First(); !errors.Is(err, ErrEmpty) {
+		t.Errorf("Expected ErrEmpty from First, got %v", err)
+	}
+	if _, err := list.Last(); !errors.Is(err, ErrEmpty) {
+		t.Errorf("Expected ErrEmpty from Last, got %v", err)
+	}
+
+	list.Add(Item{ID: 2})
+	if item, err := list.First(); err != nil || item.ID != 2 {
+		t.Errorf("Expected First to be 2, got %v, err %v", item, err)
+	}
+	if item, err := list.Last(); err != nil || item.ID != 2 {
+		t.Errorf("Expected Last to be 2, got %v, err %v", item, err)
+	}
+
+	list.Adds([]Item{{ID: 3}, {ID: 1}})
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+	if item, err := list.First(); err != nil || item.ID != 1 {
+		t.Errorf("Expected First to be 1, got %v, err %v", item, err)
+	}
+	if item, err := list.Last(); err != nil || item.ID != 3 {
+		t.Errorf("Expected Last to be 3, got %v, err %v", item, err)
+	}
+}
+
+// TestDBList_Snapshot tests that a snapshot is unaffected by later changes to the original.
+func TestDBList_Snapshot(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}})
+
+	snapshot := list.Snapshot()
+
+	list.Adds([]Item{{ID: 4}, {ID: 5}})
+	if err := list.Delete(0); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+	if err := list.Update(0, Item{ID: 20}); err != nil {
+		t.Fatalf("Failed to update item: %v", err)
+	}
+	list.Sort(func(a, b Item) bool { return a.ID > b.ID })
+
+	if got := snapshot.Size(); got != 3 {
+		t.Errorf("Expected snapshot size to be 3, got %d", got)
+	}
+	for i := 0; i < 3; i++ {
+		if item, err := snapshot.Get(i); err != nil || item.ID != i+1 {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, i+1, item, err)
+		}
+	}
+
+	if err := snapshot.Add(Item{ID: 6}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from Add, got %v", err)
+	}
+	if err := snapshot.Close(); err != nil {
+		t.Errorf("Failed to close snapshot: %v", err)
+	}
+	if item, err := list.Get(-1); err != nil || item.ID != 3 {
+		t.Errorf("Expected original to be usable after closing snapshot, got %v, err %v", item, err)
+	}
+}
+
+// TestDBList_GetErrors tests that missing and corrupt disk records are reported distinctly.
+func TestDBList_GetErrors(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 0)
+	list.Adds([]Item{{ID: 1}, {ID: 2}})
+
+	missingPath, _ := list.filePathForIndex(0, false)
+	if err := os.Remove(missingPath); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	_, err := list.Get(0)
+	if !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound, got %v", err)
+	}
+	if errors.Is(err, ErrCorruptRecord) {
+		t.Errorf("Expected missing record not to be reported as corrupt")
+	}
+
+	corruptPath, _ := list.filePathForIndex(1, false)
+	if err := os.WriteFile(corruptPath, []byte("{truncated"), 0o644); err != nil {
+		t.Fatalf("Failed to corrupt file: %v", err)
+	}
+	_, err = list.Get(1)
+	if !errors.Is(err, ErrCorruptRecord) {
+		t.Errorf("Expected ErrCorruptRecord, got %v", err)
+	}
+	if errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected corrupt record not to be reported as missing")
+	}
+}
+
+// TestDBList_AddsParallel tests that a parallel bulk add keeps the slice order across both tiers.
+func TestDBList_AddsParallel(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 3)
+	list.Add(Item{ID: 0})
+
+	items := make([]Item, 100)
+	for i := range items {
+		items[i] = Item{ID: i + 1}
+	}
+	if err := list.AddsParallel(items, 4); err != nil {
+		t.Fatalf("Failed to add items: %v", err)
+	}
+
+	if got := list.Size(); got != 101 {
+		t.Fatalf("Expected size to be 101, got %d", got)
+	}
+	if got := len(list.memoryData); got != 3 {
+		t.Errorf("Expected 3 items in memory, got %d", got)
+	}
+	for i := 0; i <= 100; i++ {
+		if item, err := list.Get(i); err != nil || item.ID != i {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, i, item, err)
+		}
+	}
+}
+
+// TestDBList_AddsParallelError tests that a failed parallel add leaves the list unchanged.
+func TestDBList_AddsParallelError(t *testing.T) {
+	tempDir := t.TempDir()
+	// A regular file where the disk path should be makes every disk write fail
+	diskPath := filepath.Join(tempDir, "blocked")
+	if err := os.WriteFile(diskPath, nil, 0o644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	list := NewDBList[Item](diskPath, 1)
+	if err := list.AddsParallel([]Item{{ID: 1}, {ID: 2}, {ID: 3}}, 2); err == nil {
+		t.Fatalf("Expected error adding items")
+	}
+	if got := list.Size(); got != 0 {
+		t.Errorf("Expected size to be 0, got %d", got)
+	}
+	if got := len(list.memoryData); got != 0 {
+		t.Errorf("Expected no items in memory, got %d", got)
+	}
+}
+
+func benchmarkAdds(b *testing.B, opts ...Option) {
+	items := make([]Item, 100000)
+	for i := range items {
+		items[i] = Item{ID: i}
+	}
+
+	for i := 0; i < b.N; i++ {
+		list := NewDBList[Item](b.TempDir(), 0, opts...)
+		if err := list.Adds(items); err != nil {
+			b.Fatalf("Failed to add items: %v", err)
+		}
+		if err := list.Flush(); err != nil {
+			b.Fatalf("Failed to flush list: %v", err)
+		}
+	}
+}
+
+func BenchmarkDBList_Adds(b *testing.B) {
+	benchmarkAdds(b)
+}
+
+func BenchmarkDBList_AddsParallel(b *testing.B) {
+	items := make([]Item, 100000)
+	for i := range items {
+		items[i] = Item{ID: i}
+	}
+
+	for i := 0; i < b.N; i++ {
+		list := NewDBList[Item](b.TempDir(), 0)
+		if err := list.AddsParallel(items, 0); err != nil {
+			b.Fatalf("Failed to add items: %v", err)
+		}
+		if err := list.Flush(); err != nil {
+			b.Fatalf("Failed to flush list: %v", err)
+		}
+	}
+}
+
+// TestDBList_Prune tests pruning every other item from a disk-backed list.
+func TestDBList_Prune(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 3)
+	for i := 0; i < 10; i++ {
+		list.Add(Item{ID: i})
+	}
+
+	removed, err := list.Prune(context.Background(), func(item Item) bool { return item.ID%2 == 1 })
+	if err != nil {
+		t.Fatalf("Failed to prune list: %v", err)
+	}
+	if removed != 5 {
+		t.Errorf("Expected 5 items removed, got %d", removed)
+	}
+	if got := list.Size(); got != 5 {
+		t.Errorf("Expected size to be 5, got %d", got)
+	}
+
+	for i, want := range []int{0, 2, 4, 6, 8} {
+		if item, err := list.Get(i); err != nil || item.ID != want {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, want, item, err)
+		}
+	}
+
+	// Physical indexes 3..9 are on disk; only the even ones should remain
+	found, _ := list.disk.indexes()
+	if !reflect.DeepEqual(found, []int{4, 6, 8}) {
+		t.Errorf("Expected disk files for 4, 6 and 8, got %v", found)
+	}
+}
+
+func BenchmarkDBList_AddConcurrent(b *testing.B) {
+	list := NewDBList[Item](b.TempDir(), 0)
+	b.SetParallelism(8)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := list.Add(Item{ID: 1}); err != nil {
+				b.Errorf("Failed to add item: %v", err)
+			}
+		}
+	})
+}
+
+// TestDBList_Swap tests that Swap reorders the items without touching their storage.
+func TestDBList_Swap(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2)
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}, {ID: 3}})
+
+	before, err := os.ReadFile(filepath.Join(tempDir, "3.json"))
+	if err != nil {
+		t.Fatalf("Failed to read record: %v", err)
+	}
+
+	if err := list.Swap(0, 3); err != nil {
+		t.Fatalf("Failed to swap items: %v", err)
+	}
+
+	for i, want := range []int{3, 1, 2, 0} {
+		item, err := list.Get(i)
+		if err != nil {
+			t.Fatalf("Failed to get item %d: %v", i, err)
+		}
+		if item.ID != want {
+			t.Errorf("Expected ID %d at index %d, got %d", want, i, item.ID)
+		}
+	}
+
+	// The item at position 0 is still stored at physical index 3
+	after, err := os.ReadFile(filepath.Join(tempDir, "3.json"))
+	if err != nil {
+		t.Fatalf("Failed to read record: %v", err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("Expected record to be unchanged")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "0.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no record for the in-memory item, got %v", err)
+	}
+	if got := len(list.memoryData); got != 2 {
+		t.Errorf("Expected 2 items in memory, got %d", got)
+	}
+
+	if list.isSorted {
+		t.Errorf("Expected list to be marked unsorted")
+	}
+	if err := list.Swap(0, 4); err == nil {
+		t.Errorf("Expected error swapping out of range")
+	}
+	if err := list.Swap(-1, 0); err == nil {
+		t.Errorf("Expected error swapping out of range")
+	}
+}
+
+// TestDBList_Reverse tests reversing a list sorted in ascending order.
+func TestDBList_Reverse(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2)
+	list.Adds([]Item{{ID: 3}, {ID: 1}, {ID: 4}, {ID: 2}})
+
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+	if err := list.Reverse(); err != nil {
+		t.Fatalf("Failed to reverse list: %v", err)
+	}
+
+	for i, want := range []int{4, 3, 2, 1} {
+		item, err := list.Get(i)
+		if err != nil {
+			t.Fatalf("Failed to get item %d: %v", i, err)
+		}
+		if item.ID != want {
+			t.Errorf("Expected ID %d at index %d, got %d", want, i, item.ID)
+		}
+	}
+
+	// Sorting again must not be skipped now that the order has changed
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+	if first, _ := list.First(); first.ID != 1 {
+		t.Errorf("Expected ID 1 first after sorting again, got %d", first.ID)
+	}
+}
+
+// TestDBList_Pop tests popping items from disk and memory storage, then from an empty list.
+func TestDBList_Pop(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2)
+	list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}})
+
+	// The last item overflowed to disk, so popping it removes its record
+	item, err := list.Pop()
+	if err != nil {
+		t.Fatalf("Failed to pop item: %v", err)
+	}
+	if item.ID != 3 {
+		t.Errorf("Expected ID 3, got %d", item.ID)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "2.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected record for popped item to be removed, got %v", err)
+	}
+
+	for _, want := range []int{2, 1} {
+		item, err := list.Pop()
+		if err != nil {
+			t.Fatalf("Failed to pop item: %v", err)
+		}
+		if item.ID != want {
+			t.Errorf("Expected ID %d, got %d", want, item.ID)
+		}
+	}
+
+	if got := list.Size(); got != 0 {
+		t.Errorf("Expected size to be 0, got %d", got)
+	}
+	if got := len(list.memoryData); got != 0 {
+		t.Errorf("Expected no items in memory, got %d", got)
+	}
+
+	if _, err := list.Pop(); !errors.Is(err, ErrEmpty) {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+}
+
+// TestDBList_IteratorBuffered tests that prefetching iteration returns every item in sorted order.
+func TestDBList_IteratorBuffered(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 3)
+	for i := 0; i < 50; i++ {
+		list.Add(Item{ID: i})
+	}
+
+	for _, prefetch := range []int{0, 1, 16, 100} {
+		count := 0
+		for item := range list.IteratorBuffered(context.Background(), prefetch) {
+			if item.ID != count {
+				t.Errorf("Prefetch %d: expected ID %d, got %d", prefetch, count, item.ID)
+			}
+			count++
+		}
+		if count != 50 {
+			t.Errorf("Prefetch %d: expected 50 items, got %d", prefetch, count)
+		}
+	}
+}
+
+// TestDBList_IteratorBufferedCancelled tests that cancelling the context stops a prefetching iterator.
+func TestDBList_IteratorBufferedCancelled(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0)
+	for i := 0; i < 50; i++ {
+		list.Add(Item{ID: i})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := list.IteratorBuffered(ctx, 8)
+	<-ch
+	cancel()
+
+	count := 0
+	for range ch {
+		count++
+	}
+	if count >= 49 {
+		t.Errorf("Expected iteration to stop early, got %d more items", count)
+	}
+}
+
+func BenchmarkDBList_IteratorBuffered(b *testing.B) {
+	list := newBenchmarkList(b, 2000)
+
+	for _, prefetch := range []int{1, 16} {
+		b.Run(fmt.Sprintf("prefetch=%d", prefetch), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for range list.IteratorBuffered(context.Background(), prefetch) {
+				}
+			}
+		})
+	}
+}
+
+// TestDBList_Clone tests that mutating a clone of a disk-backed list leaves the original unchanged.
+func TestDBList_Clone(t *testing.T) {
+	srcDir := t.TempDir()
+	list := NewDBList[Item](srcDir, 2)
+	list.Adds([]Item{{ID: 3}, {ID: 1}, {ID: 4}, {ID: 2}})
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+
+	cloneDir := filepath.Join(t.TempDir(), "clone")
+	clone, err := list.Clone(context.Background(), cloneDir)
+	if err != nil {
+		t.Fatalf("Failed to clone list: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if item, err := clone.Get(i); err != nil || item.ID != i+1 {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, i+1, item, err)
+		}
+	}
+
+	// Mutate both tiers of the clone
+	clone.Update(0, Item{ID: 10})
+	clone.Update(3, Item{ID: 40})
+	clone.Delete(1)
+	clone.Add(Item{ID: 50})
+	clone.Reverse()
+
+	if got := list.Size(); got != 4 {
+		t.Errorf("Expected original size to be 4, got %d", got)
+	}
+	for i := 0; i < 4; i++ {
+		if item, err := list.Get(i); err != nil || item.ID != i+1 {
+			t.Errorf("Original Get(%d): expected ID %d, got %v, err %v", i, i+1, item, err)
+		}
+	}
+
+	// A clone holds everything needed to be reopened on its own
+	otherDir := t.TempDir()
+	other, err := list.Clone(context.Background(), otherDir)
+	if err != nil {
+		t.Fatalf("Failed to clone list: %v", err)
+	}
+	if err := other.Close(); err != nil {
+		t.Fatalf("Failed to close clone: %v", err)
+	}
+	reopened, err := OpenDBList[Item](otherDir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open clone: %v", err)
+	}
+	if !reopened.isSorted || reopened.Size() != 4 {
+		t.Errorf("Expected reopened clone to hold 4 sorted items, got %d, sorted %v", reopened.Size(), reopened.isSorted)
+	}
+	if item, err := reopened.Get(0); err != nil || item.ID != 1 {
+		t.Errorf("Expected ID 1, got %v, err %v", item, err)
+	}
+
+	if _, err := list.Clone(context.Background(), srcDir); err == nil {
+		t.Errorf("Expected error cloning to the list's own path")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := list.Clone(ctx, t.TempDir()); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// TestDBList_NoDiskPath tests that overflowing a list without a disk path is an error rather than a write to the working directory.
+func TestDBList_NoDiskPath(t *testing.T) {
+	list := NewDBList[Item]("", 2)
+	list.Adds([]Item{{ID: 1}, {ID: 2}})
+
+	if err := list.Add(Item{ID: 3}); !errors.Is(err, ErrNoDiskPath) {
+		t.Errorf("Expected ErrNoDiskPath, got %v", err)
+	}
+	if err := list.AddsParallel([]Item{{ID: 4}}, 1); !errors.Is(err, ErrNoDiskPath) {
+		t.Errorf("Expected ErrNoDiskPath, got %v", err)
+	}
+	if _, err := os.Stat("2.json"); !os.IsNotExist(err) {
+		t.Errorf("Expected no file in the working directory, got err %v", err)
+	}
+
+	if got := list.Size(); got != 2 {
+		t.Errorf("Expected size to be 2, got %d", got)
+	}
+
+	// Items that fit in memory can still be added once there is room
+	if err := list.Delete(0); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+	if err := list.AddsParallel([]Item{{ID: 5}}, 1); err != nil {
+		t.Errorf("Failed to add item: %v", err)
+	}
+}
+
+// TestDBList_IteratorErr tests that a missing disk record is reported rather than skipped.
+func TestDBList_IteratorErr(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 1)
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}, {ID: 3}})
+
+	filePath, _ := list.filePathForIndex(2, false)
+	if err := os.Remove(filePath); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+
+	var ids []int
+	var errs []error
+	for res := range list.IteratorErr(context.Background()) {
+		if res.Err != nil {
+			errs = append(errs, res.Err)
+			continue
+		}
+		ids = append(ids, res.Item.ID)
+	}
+
+	if expected := []int{0, 1, 3}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected %v, got %v", expected, ids)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrIndexNotFound) {
+		t.Errorf("Expected one ErrIndexNotFound, got %v", errs)
+	}
+
+	list.Close()
+	count := 0
+	for res := range list.IteratorErr(context.Background()) {
+		if !errors.Is(res.Err, ErrClosed) {
+			t.Errorf("Expected ErrClosed, got %v", res.Err)
+		}
+		count++
+	}
+	if count != 1 {
+		t.Errorf("Expected iteration to stop after ErrClosed, got %d results", count)
+	}
+}
+
+// TestDBList_Drain tests that draining removes the items received, that cancelling leaves the
+// rest in the list, and that a full drain empties it.
+func TestDBList_Drain(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2)
+	list.Adds([]Item{{ID: 5}, {ID: 0}, {ID: 3}, {ID: 1}, {ID: 4}, {ID: 2}})
+	list.Sort(itemLess)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var drained []int
+	ch := list.Drain(ctx)
+	for item := range ch {
+		drained = append(drained, item.ID)
+		if len(drained) == 3 {
+			cancel()
+			break
+		}
+	}
+	// An item may still be received before the drain sees the cancellation
+	for item := range ch {
+		drained = append(drained, item.ID)
+	}
+
+	for i, id := range drained {
+		if id != i {
+			t.Fatalf("Expected the items in sorted order, got %v", drained)
+		}
+	}
+	remaining, err := list.Values()
+	if err != nil {
+		t.Fatalf("Failed to read the rest: %v", err)
+	}
+	if len(remaining) != 6-len(drained) {
+		t.Fatalf("Expected %d items left, got %v", 6-len(drained), remaining)
+	}
+	for i, item := range remaining {
+		if item.ID != len(drained)+i {
+			t.Errorf("Expected the undrained items to survive in order, got %v", remaining)
+			break
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "3.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the record of drained ID 1 to be removed, got %v", err)
+	}
+
+	count := 0
+	for range list.Drain(context.Background()) {
+		count++
+	}
+	if count != len(remaining) || list.Size() != 0 {
+		t.Errorf("Expected to drain the %d remaining items, got %d with %d left", len(remaining), count, list.Size())
+	}
+}
+
+// TestDBList_GetMany tests fetching a mix of memory and disk indexes in the requested order.
+func TestDBList_GetMany(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}})
+
+	items, err := list.GetMany([]int{4, 0, 3, 1, 1})
+	if err != nil {
+		t.Fatalf("Failed to get items: %v", err)
+	}
+	if expected := []Item{{ID: 4}, {ID: 0}, {ID: 3}, {ID: 1}, {ID: 1}}; !reflect.DeepEqual(items, expected) {
+		t.Errorf("Expected %v, got %v", expected, items)
+	}
+
+	if items, err := list.GetMany(nil); err != nil || len(items) != 0 {
+		t.Errorf("Expected no items, got %v, err %v", items, err)
+	}
+	if _, err := list.GetMany([]int{0, 5}); err == nil {
+		t.Errorf("Expected error for an out of range index")
+	}
+	if _, err := list.GetMany([]int{-1}); err == nil {
+		t.Errorf("Expected error for a negative index")
+	}
+}
+
+// TestDBList_SortConcurrentGet tests that Get keeps working during a Sort, and is meant to be run with -race.
+func TestDBList_SortConcurrentGet(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 10)
+	for i := 200; i > 0; i-- {
+		list.Add(Item{ID: i})
+	}
+
+	sorting := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-sorting
+		list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+	}()
+
+	close(sorting)
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Sort did not finish")
+		default:
+			// Each read sees either the old or the new order, never a partial one
+			first, err := list.First()
+			if err != nil || (first.ID != 200 && first.ID != 1) {
+				t.Fatalf("Expected ID 200 or 1 first, got %v, err %v", first, err)
+			}
+		}
+	}
+
+	for i := 0; i < 200; i++ {
+		if item, err := list.Get(i); err != nil || item.ID != i+1 {
+			t.Fatalf("Get(%d): expected ID %d, got %v, err %v", i, i+1, item, err)
+		}
+	}
+}
+
+// TestDBList_SortConcurrentAdd tests that items added during a Sort are not lost.
+func TestDBList_SortConcurrentAdd(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 10)
+	for i := 100; i > 0; i-- {
+		list.Add(Item{ID: i})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 101; i <= 150; i++ {
+			list.Add(Item{ID: i})
+		}
+	}()
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+	wg.Wait()
+
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+	if got := list.Size(); got != 150 {
+		t.Fatalf("Expected size to be 150, got %d", got)
+	}
+	for i := 0; i < 150; i++ {
+		if item, err := list.Get(i); err != nil || item.ID != i+1 {
+			t.Fatalf("Get(%d): expected ID %d, got %v, err %v", i, i+1, item, err)
+		}
+	}
+}
+
+// TestDBList_Dedup tests that only the first occurrence of each key remains, and that duplicate files are removed.
+func TestDBList_Dedup(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2)
+	list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 1}, {ID: 3}, {ID: 2}, {ID: 1}})
+
+	removed, err := list.Dedup(func(item Item) string { return strconv.Itoa(item.ID) })
+	if err != nil {
+		t.Fatalf("Failed to dedup list: %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("Expected 3 duplicates removed, got %d", removed)
+	}
+	if got := list.Size(); got != 3 {
+		t.Errorf("Expected size to be 3, got %d", got)
+	}
+
+	var ids []int
+	for item := range list.All() {
+		ids = append(ids, item.ID)
+	}
+	if expected := []int{1, 2, 3}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected %v, got %v", expected, ids)
+	}
+
+	// Only the record of ID 3 at index 3 is left on disk
+	entries, _ := os.ReadDir(tempDir)
+	if len(entries) != 1 || entries[0].Name() != "3.json" {
+		t.Errorf("Expected only 3.json on disk, got %v", entries)
+	}
+}
+
+// TestReduce tests summing the IDs of a disk-backed list.
+func TestReduce(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 3)
+	for i := 1; i <= 100; i++ {
+		list.Add(Item{ID: i})
+	}
+
+	sum, err := Reduce(context.Background(), list, 0, func(acc int, item Item) int { return acc + item.ID })
+	if err != nil {
+		t.Fatalf("Failed to reduce list: %v", err)
+	}
+	if sum != 5050 {
+		t.Errorf("Expected sum 5050, got %d", sum)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Reduce(ctx, list, 0, func(acc int, item Item) int { return acc + 1 }); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// TestDBList_Truncate tests capping a disk-backed list by dropping items from either end.
+func TestDBList_Truncate(t *testing.T) {
+	tests := []struct {
+		fromEnd  bool
+		expected []int
+		files    []string
+	}{
+		{fromEnd: false, expected: []int{3, 4, 5}, files: []string{"3.json", "4.json", "5.json"}},
+		{fromEnd: true, expected: []int{0, 1, 2}, files: []string{"2.json"}},
+	}
+
+	for _, tt := range tests {
+		tempDir := t.TempDir()
+		list := NewDBList[Item](tempDir, 2)
+		list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}})
+
+		removed, err := list.Truncate(3, tt.fromEnd)
+		if err != nil || removed != 3 {
+			t.Fatalf("fromEnd %v: expected 3 removed, got %d, err %v", tt.fromEnd, removed, err)
+		}
+
+		var ids []int
+		for item := range list.All() {
+			ids = append(ids, item.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.expected) {
+			t.Errorf("fromEnd %v: expected %v, got %v", tt.fromEnd, tt.expected, ids)
+		}
+
+		var files []string
+		entries, _ := os.ReadDir(tempDir)
+		for _, entry := range entries {
+			files = append(files, entry.Name())
+		}
+		if !reflect.DeepEqual(files, tt.files) {
+			t.Errorf("fromEnd %v: expected files %v, got %v", tt.fromEnd, tt.files, files)
+		}
+
+		// A list already within the cap is left alone
+		if removed, err := list.Truncate(5, tt.fromEnd); err != nil || removed != 0 || list.Size() != 3 {
+			t.Errorf("fromEnd %v: expected nothing removed, got %d, size %d, err %v", tt.fromEnd, removed, list.Size(), err)
+		}
+	}
+
+	if _, err := NewDBList[Item]("", 1).Truncate(-1, false); err == nil {
+		t.Errorf("Expected error for a negative maximum")
+	}
+}
+
+// TestDBList_Order tests that Order reflects a sort and cannot change the list.
+func TestDBList_Order(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 30}, {ID: 10}, {ID: 20}, {ID: 40}})
+	list.Sort(itemLess)
+
+	order := list.Order()
+	if expected := []int{1, 2, 0, 3}; !reflect.DeepEqual(order, expected) {
+		t.Fatalf("Expected order %v, got %v", expected, order)
+	}
+	for i, physical := range order {
+		sorted, _ := list.Get(i)
+		if raw, err := list.GetRaw(physical); err != nil || raw != sorted {
+			t.Errorf("GetRaw(%d): expected %v, got %v, err %v", physical, sorted, raw, err)
+		}
+	}
+
+	order[0] = 3
+	if item, err := list.Get(0); err != nil || item.ID != 10 {
+		t.Errorf("Expected changing the copy to leave the list alone, got %v, err %v", item, err)
+	}
+}
+
+// TestDBList_GetRaw tests that GetRaw follows insertion order while Get follows the sort order.
+func TestDBList_GetRaw(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 30}, {ID: 10}, {ID: 20}, {ID: 40}})
+	list.Sort(itemLess)
+
+	for i, tt := range []struct{ raw, sorted int }{{30, 10}, {10, 20}, {20, 30}, {40, 40}} {
+		if item, err := list.GetRaw(i); err != nil || item.ID != tt.raw {
+			t.Errorf("GetRaw(%d): expected ID %d, got %v, err %v", i, tt.raw, item, err)
+		}
+		if item, err := list.Get(i); err != nil || item.ID != tt.sorted {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, tt.sorted, item, err)
+		}
+	}
+
+	list.Delete(0)
+	for _, index := range []int{1, -1, 4} {
+		if _, err := list.GetRaw(index); !errors.Is(err, ErrIndexNotFound) {
+			t.Errorf("GetRaw(%d): expected ErrIndexNotFound, got %v", index, err)
+		}
+	}
+}
+
+// TestDBList_AddFromChannel tests draining a channel into the list and stopping on cancellation.
+func TestDBList_AddFromChannel(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+
+	ch := make(chan Item)
+	go func() {
+		defer close(ch)
+		for i := range 5 {
+			ch <- Item{ID: i}
+		}
+	}()
+
+	added, err := list.AddFromChannel(context.Background(), ch)
+	if err != nil || added != 5 {
+		t.Fatalf("Expected 5 items added, got %d, err %v", added, err)
+	}
+	if size := list.Size(); size != 5 {
+		t.Errorf("Expected size 5, got %d", size)
+	}
+	if item, err := list.Get(4); err != nil || item.ID != 4 {
+		t.Errorf("Expected ID 4 last, got %v, err %v", item, err)
+	}
+
+	// A channel that never closes is abandoned when the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if added, err := list.AddFromChannel(ctx, make(chan Item)); !errors.Is(err, context.Canceled) || added != 0 {
+		t.Errorf("Expected context.Canceled with nothing added, got %d, err %v", added, err)
+	}
+}
+
+// TestDBList_MinMax tests finding the extremes of memory-only and disk-backed lists without reordering them.
+func TestDBList_MinMax(t *testing.T) {
+	items := []Item{{ID: 30}, {ID: 10}, {ID: 50}, {ID: 20}, {ID: 40}}
+	for _, tt := range []struct {
+		name string
+		list *DBList[Item]
+	}{
+		{name: "memory", list: NewDBList[Item]("", 10)},
+		{name: "disk", list: NewDBList[Item](t.TempDir(), 1)},
+	} {
+		if _, err := tt.list.Min(itemLess); !errors.Is(err, ErrEmpty) {
+			t.Errorf("%s: expected ErrEmpty, got %v", tt.name, err)
+		}
+
+		tt.list.Adds(items)
+		if item, err := tt.list.Min(itemLess); err != nil || item.ID != 10 {
+			t.Errorf("%s: expected min ID 10, got %v, err %v", tt.name, item, err)
+		}
+		if item, err := tt.list.Max(itemLess); err != nil || item.ID != 50 {
+			t.Errorf("%s: expected max ID 50, got %v, err %v", tt.name, item, err)
+		}
+		if item, _ := tt.list.Get(0); item.ID != 30 {
+			t.Errorf("%s: expected the order to be unchanged, got %v first", tt.name, item)
+		}
+	}
+}
+
+// TestDBList_CompareAndUpdate tests that of two goroutines racing to replace the same item, exactly one succeeds.
+func TestDBList_CompareAndUpdate(t *testing.T) {
+	list := NewDBList[Document](t.TempDir(), 1)
+	list.Adds([]Document{{ID: 0, Body: "memory"}, {ID: 1, Body: "disk"}})
+
+	for index := range 2 {
+		expected, _ := list.Get(index)
+
+		var wg sync.WaitGroup
+		swapped := make([]bool, 2)
+		for g := range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := list.CompareAndUpdate(index, expected, Document{ID: index, Body: strconv.Itoa(g)},
+					func(a, b Document) bool { return a == b })
+				if err != nil {
+					t.Errorf("CompareAndUpdate(%d): %v", index, err)
+				}
+				swapped[g] = ok
+			}()
+		}
+		wg.Wait()
+
+		if swapped[0] == swapped[1] {
+			t.Fatalf("Index %d: expected exactly one update to succeed, got %v", index, swapped)
+		}
+		winner := "0"
+		if swapped[1] {
+			winner = "1"
+		}
+		if item, _ := list.Get(index); item.Body != winner {
+			t.Errorf("Index %d: expected the winner's update %q, got %q", index, winner, item.Body)
+		}
+	}
+}
+
+// TestDBList_RangeIterator tests iterating over a range in the middle of the list, crossing into the disk tier.
+func TestDBList_RangeIterator(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 3)
+	for i := range 10 {
+		list.Add(Item{ID: i})
+	}
+
+	var got []int
+	for item := range list.RangeIterator(context.Background(), 2, 6) {
+		got = append(got, item.ID)
+	}
+	if expected := []int{2, 3, 4, 5}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// Bounds beyond the list are clipped
+	got = nil
+	for item := range list.RangeIterator(context.Background(), 8, 20) {
+		got = append(got, item.ID)
+	}
+	if expected := []int{8, 9}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := list.RangeIterator(ctx, 2, 6)
+	<-ch
+	cancel()
+	for range ch {
+	}
+}
+
+// TestGroupBy tests splitting a list into per-key lists by ID parity.
+func TestGroupBy(t *testing.T) {
+	dir := t.TempDir()
+	src := NewDBList[Item](filepath.Join(dir, "src"), 2)
+	for i := range 7 {
+		src.Add(Item{ID: i})
+	}
+
+	groups, err := GroupBy(context.Background(), src, func(item Item) int { return item.ID % 2 },
+		func(k int) string { return filepath.Join(dir, strconv.Itoa(k)) }, 2)
+	if err != nil {
+		t.Fatalf("Failed to group: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+	for k, expected := range map[int][]int{0: {0, 2, 4, 6}, 1: {1, 3, 5}} {
+		var got []int
+		for item := range groups[k].All() {
+			got = append(got, item.ID)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Group %d: expected %v, got %v", k, expected, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "0", "2.json")); err != nil {
+		t.Errorf("Expected group 0 to spill to its own path: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GroupBy(ctx, src, func(item Item) int { return item.ID % 2 },
+		func(k int) string { return filepath.Join(dir, "cancelled", strconv.Itoa(k)) }, 2); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// The groups keep the settings of the source
+	key := bytes.Repeat([]byte{7}, 32)
+	secret := NewDBList[Item](filepath.Join(dir, "secret"), 0, WithEncryption(key))
+	secret.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+	if _, err := GroupBy(context.Background(), secret, func(item Item) int { return item.ID % 2 },
+		func(k int) string { return filepath.Join(dir, "encrypted", strconv.Itoa(k)) }, 0); err != nil {
+		t.Fatalf("Failed to group encrypted list: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "encrypted", "0", "0.json")); err != nil || bytes.Contains(data, []byte(`"ID"`)) {
+		t.Errorf("Expected an encrypted record, got %q, err %v", data, err)
+	}
+
+	// An item that cannot be loaded stops the grouping with the groups made so far
+	if err := os.Remove(filepath.Join(dir, "secret", "1.json")); err != nil {
+		t.Fatalf("Failed to remove record: %v", err)
+	}
+	partial, err := GroupBy(context.Background(), secret, func(item Item) int { return item.ID % 2 },
+		func(k int) string { return filepath.Join(dir, "partial", strconv.Itoa(k)) }, 0)
+	if !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound, got %v", err)
+	}
+	if len(partial) != 1 || partial[0].Size() != 1 {
+		t.Errorf("Expected the group made before the error, got %v", partial)
+	}
+}
+
+// TestDBList_ToSlice tests collecting the list under, at and over the limit, and without one.
+func TestDBList_ToSlice(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 2}, {ID: 0}, {ID: 1}})
+	list.Sort(itemLess)
+	expected := []Item{{ID: 0}, {ID: 1}, {ID: 2}}
+
+	for _, limit := range []int{5, 3, 0, -1} {
+		if items, err := list.ToSlice(limit); err != nil || !reflect.DeepEqual(items, expected) {
+			t.Errorf("ToSlice(%d): expected %v, got %v, err %v", limit, expected, items, err)
+		}
+	}
+	if items, err := list.ToSlice(2); err == nil || items != nil {
+		t.Errorf("ToSlice(2): expected an error, got %v", items)
+	}
+}
+
+// TestDBList_AddsAtomic tests that a concurrent reader only ever sees whole batches from Adds.
+func TestDBList_AddsAtomic(t *testing.T) {
+	const batch = 10
+	list := NewDBList[Item](t.TempDir(), 25)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for b := range 10 {
+			items := make([]Item, batch)
+			for i := range items {
+				items[i] = Item{ID: b}
+			}
+			if err := list.Adds(items); err != nil {
+				t.Errorf("Failed to add batch %d: %v", b, err)
+				return
+			}
+		}
+	}()
+
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+
+		if size := list.Size(); size%batch != 0 {
+			t.Fatalf("Saw a partial batch: %d items", size)
+		}
+	}
+
+	// A batch that cannot be stored is not added at all
+	memoryOnly := NewDBList[Item]("", 2)
+	if err := memoryOnly.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}}); !errors.Is(err, ErrNoDiskPath) {
+		t.Errorf("Expected ErrNoDiskPath, got %v", err)
+	}
+	if size := memoryOnly.Size(); size != 0 {
+		t.Errorf("Expected no items from a failed batch, got %d", size)
+	}
+}
+
+// cancelAfterWrites is a store that cancels a context once a number of records have been written.
+type cancelAfterWrites struct {
+	store
+	writes int
+	cancel context.CancelFunc
+}
+
+func (s *cancelAfterWrites) put(index int, data []byte) error {
+	if err := s.store.put(index, data); err != nil {
+		return err
+	}
+	if s.writes--; s.writes == 0 {
+		s.cancel()
+	}
+	return nil
+}
+
+// TestDBList_AddsCtx tests that cancelling part way through a batch adds none of it and leaves
+// the list as it was, and that AddCtx stops before writing.
+func TestDBList_AddsCtx(t *testing.T) {
+	dir := t.TempDir()
+	list := NewDBList[Item](dir, 2)
+	list.Add(Item{ID: -1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	list.disk = &cancelAfterWrites{store: list.disk, writes: 2, cancel: cancel}
+
+	if err := list.AddsCtx(ctx, []Item{{ID: 0}, {ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if size := list.Size(); size != 1 {
+		t.Errorf("Expected only the earlier item, got size %d", size)
+	}
+	if len(list.memoryData) != 1 || list.nextIndex != 1 {
+		t.Errorf("Expected the reservation to be rolled back, got %d in memory and next index %d", len(list.memoryData), list.nextIndex)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected the written records to be removed, got %d files", len(entries))
+	}
+
+	list.Add(Item{ID: 5})
+	if err := list.AddCtx(ctx, Item{ID: 6}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from AddCtx, got %v", err)
+	}
+	if err := list.AddCtx(context.Background(), Item{ID: 6}); err != nil {
+		t.Errorf("Failed to add: %v", err)
+	}
+	if item, err := list.Get(2); err != nil || item.ID != 6 {
+		t.Errorf("Expected ID 6 at 2, got %v, err %v", item, err)
+	}
+}
+
+// TestDBList_Append tests appending a sorted disk-backed list onto another across both memory tiers.
+func TestDBList_Append(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+
+	other := NewDBList[Item](t.TempDir(), 1)
+	other.Adds([]Item{{ID: 5}, {ID: 3}, {ID: 4}})
+	other.Sort(itemLess)
+
+	if err := list.Append(other); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if size := list.Size(); size != 6 {
+		t.Errorf("Expected size 6, got %d", size)
+	}
+	if got, _ := list.ToSlice(0); !reflect.DeepEqual(got, []Item{{ID: 0}, {ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}}) {
+		t.Errorf("Expected the other list's sorted order after the original items, got %v", got)
+	}
+	if size := other.Size(); size != 3 {
+		t.Errorf("Expected the other list to be unchanged, got size %d", size)
+	}
+}
+
+// TestDBList_Values tests that a corrupt record makes Values fail rather than return a short slice.
+func TestDBList_Values(t *testing.T) {
+	dir := t.TempDir()
+	list := NewDBList[Item](dir, 1)
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+
+	if values, err := list.Values(); err != nil || !reflect.DeepEqual(values, []Item{{ID: 0}, {ID: 1}, {ID: 2}}) {
+		t.Fatalf("Expected all the items, got %v, err %v", values, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "1.json"), []byte("garbage"), 0o640); err != nil {
+		t.Fatalf("Failed to corrupt record: %v", err)
+	}
+	values, err := list.Values()
+	if !errors.Is(err, ErrCorruptRecord) || values != nil {
+		t.Errorf("Expected ErrCorruptRecord and no items, got %v, err %v", values, err)
+	}
+}
+
+// TestDBList_AddMonotonic tests that AddMonotonic accepts items in time order and rejects one
+// older than the last item added, even after the list is reordered.
+func TestDBList_AddMonotonic(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 1)
+	ts := func(item Item) int64 { return int64(item.ID) }
+
+	for _, id := range []int{1, 3, 3, 7} {
+		if err := list.AddMonotonic(Item{ID: id}, ts); err != nil {
+			t.Fatalf("AddMonotonic(%d): %v", id, err)
+		}
+	}
+
+	err := list.AddMonotonic(Item{ID: 5}, ts)
+	if !errors.Is(err, ErrNotMonotonic) {
+		t.Fatalf("Expected ErrNotMonotonic, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "item at 5 is earlier than the last item at 7") {
+		t.Errorf("Expected the timestamps in the error, got %v", err)
+	}
+	if size := list.Size(); size != 4 {
+		t.Errorf("Expected the rejected item not to be added, got size %d", size)
+	}
+
+	// The check is against the last item added, not the last in sorted order
+	if err := list.Reverse(); err != nil {
+		t.Fatalf("Failed to reverse: %v", err)
+	}
+	if err := list.AddMonotonic(Item{ID: 6}, ts); !errors.Is(err, ErrNotMonotonic) {
+		t.Errorf("Expected ErrNotMonotonic after Reverse, got %v", err)
+	}
+	if err := list.AddMonotonic(Item{ID: 8}, ts); err != nil {
+		t.Errorf("AddMonotonic(8): %v", err)
+	}
+}
+
+// TestDBList_AddMonotonicRemembers tests that AddMonotonic checks against the last timestamp it
+// accepted without loading items, and forgets it once the list is cleared.
+func TestDBList_AddMonotonicRemembers(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 1)
+	loads := 0
+	ts := func(item Item) int64 {
+		loads++
+		return int64(item.ID)
+	}
+
+	for _, id := range []int{1, 2, 3} {
+		if err := list.AddMonotonic(Item{ID: id}, ts); err != nil {
+			t.Fatalf("AddMonotonic(%d): %v", id, err)
+		}
+	}
+	if loads != 3 {
+		t.Errorf("Expected ts to be called once per item, got %d calls", loads)
+	}
+
+	if err := list.Clear(); err != nil {
+		t.Fatalf("Failed to clear: %v", err)
+	}
+	if err := list.AddMonotonic(Item{ID: 1}, ts); err != nil {
+		t.Errorf("Expected an earlier item to be accepted after Clear, got %v", err)
+	}
+	if err := list.AddMonotonic(Item{ID: 0}, ts); !errors.Is(err, ErrNotMonotonic) {
+		t.Errorf("Expected ErrNotMonotonic, got %v", err)
+	}
+}
+
+func TestDBList_Equal(t *testing.T) {
+	same := func(a, b Item) bool { return a == b }
+
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}})
+
+	// The same items, split differently between memory and disk
+	other := NewDBList[Item](t.TempDir(), 0)
+	other.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}})
+	if equal, err := list.Equal(other, same); err != nil || !equal {
+		t.Errorf("Expected identical lists to be equal, got %v, err %v", equal, err)
+	}
+
+	// The comparison stops at the first differing item
+	other.Update(1, Item{ID: 20})
+	calls := 0
+	if equal, err := list.Equal(other, func(a, b Item) bool { calls++; return a == b }); err != nil || equal {
+		t.Errorf("Expected lists with a differing item to differ, got %v, err %v", equal, err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 items compared, got %d", calls)
+	}
+
+	reordered := NewDBList[Item](t.TempDir(), 2)
+	reordered.Adds([]Item{{ID: 4}, {ID: 3}, {ID: 2}, {ID: 1}})
+	if equal, err := list.Equal(reordered, same); err != nil || equal {
+		t.Errorf("Expected lists in a different order to differ, got %v, err %v", equal, err)
+	}
+	reordered.Sort(func(a, b Item) bool { return a.ID < b.ID })
+	if equal, err := list.Equal(reordered, same); err != nil || !equal {
+		t.Errorf("Expected lists to be equal once sorted alike, got %v, err %v", equal, err)
+	}
+
+	shorter := NewDBList[Item](t.TempDir(), 2)
+	shorter.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}})
+	calls = 0
+	if equal, err := list.Equal(shorter, func(a, b Item) bool { calls++; return a == b }); err != nil || equal {
+		t.Errorf("Expected lists of different sizes to differ, got %v, err %v", equal, err)
+	}
+	if calls != 0 {
+		t.Errorf("Expected no items compared for lists of different sizes, got %d", calls)
+	}
+}
+
+func TestDBList_Shuffle(t *testing.T) {
+	shuffled := func(seed int64) []Item {
+		list := NewDBList[Item](t.TempDir(), 4)
+		for i := range 10 {
+			list.Add(Item{ID: i})
+		}
+		if err := list.Shuffle(rand.New(rand.NewSource(seed))); err != nil {
+			t.Fatalf("Failed to shuffle list: %v", err)
+		}
+		values, err := list.Values()
+		if err != nil {
+			t.Fatalf("Failed to read values: %v", err)
+		}
+		return values
+	}
+
+	first := shuffled(7)
+	if again := shuffled(7); !reflect.DeepEqual(first, again) {
+		t.Errorf("Expected the same order for the same seed, got %v and %v", first, again)
+	}
+
+	ids := make([]int, len(first))
+	for i, item := range first {
+		ids[i] = item.ID
+	}
+	if slices.IsSorted(ids) {
+		t.Errorf("Expected the order to change, got %v", ids)
+	}
+	slices.Sort(ids)
+	if !slices.Equal(ids, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Errorf("Expected every item to be kept, got %v", ids)
+	}
+}
+
+func TestDBList_SampleN(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 5)
+	for i := range 20 {
+		list.Add(Item{ID: i})
+	}
+
+	sample, err := list.SampleN(6, rand.New(rand.NewSource(3)))
+	if err != nil {
+		t.Fatalf("Failed to sample list: %v", err)
+	}
+	if len(sample) != 6 {
+		t.Errorf("Expected 6 items, got %d", len(sample))
+	}
+	seen := make(map[Item]bool)
+	for _, item := range sample {
+		if seen[item] || item.ID < 0 || item.ID >= 20 {
+			t.Errorf("Expected distinct items from the list, got %v", sample)
+		}
+		seen[item] = true
+	}
+
+	if again, err := list.SampleN(6, rand.New(rand.NewSource(3))); err != nil || !reflect.DeepEqual(again, sample) {
+		t.Errorf("Expected the same sample for the same seed, got %v and %v, err %v", sample, again, err)
+	}
+
+	// Asking for more than there are returns everything
+	all, err := list.SampleN(50, rand.New(rand.NewSource(3)))
+	if err != nil || len(all) != 20 {
+		t.Errorf("Expected all 20 items, got %d, err %v", len(all), err)
+	}
+
+	if _, err := list.SampleN(-1, rand.New(rand.NewSource(3))); err == nil {
+		t.Errorf("Expected error for a negative sample size")
+	}
+}
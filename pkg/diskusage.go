@@ -0,0 +1,87 @@
+package util
+
+import (
+	"sync/atomic"
+)
+
+// sizedStore wraps a store to keep a running total of the bytes its records occupy, so the
+// disk usage of a list can be read without examining every record. A put learns the size of
+// the new record from its data, and overwriting or removing a record costs a recordSize lookup
+// to learn how many bytes it gives back. Indexes from next up have no record to look up.
+type sizedStore struct {
+	store
+	bytes atomic.Int64
+	next  atomic.Int64
+}
+
+// newSizedStore wraps inner with a byte count starting at zero.
+func newSizedStore(inner store) *sizedStore {
+	return &sizedStore{store: inner}
+}
+
+func (s *sizedStore) put(index int, data []byte) error {
+	var old int64
+	if int64(index) < s.next.Load() {
+		if size, err := s.store.recordSize(index); err == nil {
+			old = size
+		}
+	}
+	if err := s.store.put(index, data); err != nil {
+		return err
+	}
+
+	s.bytes.Add(s.store.overhead() + int64(len(data)) - old)
+	for next := s.next.Load(); int64(index) >= next && !s.next.CompareAndSwap(next, int64(index)+1); {
+		next = s.next.Load()
+	}
+
+	return nil
+}
+
+func (s *sizedStore) remove(index int) error {
+	old, sizeErr := s.store.recordSize(index)
+	if err := s.store.remove(index); err != nil {
+		return err
+	}
+
+	if sizeErr == nil {
+		s.bytes.Add(-old)
+	}
+
+	return nil
+}
+
+// measure recomputes the byte count from the size of every record in the store.
+func (s *sizedStore) measure() (int64, error) {
+	found, err := s.store.indexes()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, index := range found {
+		if size, err := s.store.recordSize(index); err == nil {
+			total += size
+		}
+	}
+
+	return total, nil
+}
+
+// remeasure resets the byte count of the DBList from the records on disk.
+func (d *DBList[T]) remeasure() error {
+	total, err := d.usage.measure()
+	if err != nil {
+		return err
+	}
+
+	d.usage.bytes.Store(total)
+	return nil
+}
+
+// DiskBytes returns the number of bytes used by the records of the DBList on disk, including
+// the records kept for items loaded into memory by OpenDBList. The count is maintained as
+// records are written and removed, so this is O(1), and it is saved with the metadata.
+func (d *DBList[T]) DiskBytes() int64 {
+	return d.usage.bytes.Load()
+}
@@ -0,0 +1,55 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// ErrEncryptionKey is returned when opening an encrypted DBList without its key, or with the wrong one.
+var ErrEncryptionKey = errors.New("encryption key does not match")
+
+// keyCheckPlaintext is encrypted into the metadata so a reopened list can verify its key.
+var keyCheckPlaintext = []byte("dbds")
+
+// newGCM creates an AES-GCM cipher from a 16, 24 or 32 byte key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encrypt seals data with AES-GCM, prefixing the result with a random nonce.
+func encrypt(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// decrypt opens data sealed by encrypt.
+func decrypt(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
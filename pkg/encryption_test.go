@@ -0,0 +1,65 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+type Secret struct {
+	ID    int
+	Value string
+}
+
+// TestDBList_WithEncryption tests that encrypted items round-trip and are not stored as plaintext.
+func TestDBList_WithEncryption(t *testing.T) {
+	tempDir := t.TempDir()
+	key := bytes.Repeat([]byte{7}, 32)
+
+	list := NewDBList[Secret](tempDir, 1, WithEncryption(key))
+	secrets := []Secret{{ID: 1, Value: "first secret"}, {ID: 2, Value: "second secret"}}
+	list.Adds(secrets)
+
+	filePath, _ := list.filePathForIndex(1, false)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read disk file: %v", err)
+	}
+	if bytes.Contains(data, []byte("second secret")) {
+		t.Errorf("Expected disk file not to contain plaintext, got %q", data)
+	}
+
+	if item, err := list.Get(1); err != nil || item != secrets[1] {
+		t.Errorf("Expected %v, got %v, err %v", secrets[1], item, err)
+	}
+
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close list: %v", err)
+	}
+
+	if _, err := OpenDBList[Secret](tempDir, 1); !errors.Is(err, ErrEncryptionKey) {
+		t.Errorf("Expected ErrEncryptionKey opening without a key, got %v", err)
+	}
+	if _, err := OpenDBList[Secret](tempDir, 1, WithEncryption(bytes.Repeat([]byte{8}, 32))); !errors.Is(err, ErrEncryptionKey) {
+		t.Errorf("Expected ErrEncryptionKey opening with the wrong key, got %v", err)
+	}
+
+	reopened, err := OpenDBList[Secret](tempDir, 1, WithEncryption(key))
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	for i, want := range secrets {
+		if item, err := reopened.Get(i); err != nil || item != want {
+			t.Errorf("Get(%d): expected %v, got %v, err %v", i, want, item, err)
+		}
+	}
+}
+
+// TestDBList_WithEncryptionInvalidKey tests that a key of the wrong length is rejected on write.
+func TestDBList_WithEncryptionInvalidKey(t *testing.T) {
+	list := NewDBList[Secret](t.TempDir(), 0, WithEncryption([]byte("short")))
+	if err := list.Add(Secret{ID: 1}); err == nil {
+		t.Errorf("Expected error adding with an invalid key")
+	}
+}
@@ -0,0 +1,154 @@
+package util
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// WriteJSON writes all items to w as a JSON array in sorted order. Items are encoded and
+// written one at a time, so the whole list is never held in memory. It stops with the
+// context's error if ctx is cancelled, leaving the array unterminated.
+func (d *DBList[T]) WriteJSON(ctx context.Context, w io.Writer) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	count := d.Size()
+	for i := 0; i < count; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		item, err := d.get(i)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+// WriteNDJSON writes all items to w as newline-delimited JSON, one item per line in sorted
+// order. It stops with the context's error if ctx is cancelled.
+func (d *DBList[T]) WriteNDJSON(ctx context.Context, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	count := d.Size()
+	for i := 0; i < count; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		item, err := d.get(i)
+		if err != nil {
+			return err
+		}
+
+		// Encode terminates each value with a newline
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteCSV writes all items to w as CSV in sorted order: a header row of field names, then
+// one row per item. T must be a struct whose exported fields are strings, integers, floats
+// or bools; unexported fields are skipped. Nested structs, pointers, slices and maps are not
+// supported, and embedded structs are not flattened, so any of these is reported as an error
+// before anything is written. It stops with the context's error if ctx is cancelled.
+func (d *DBList[T]) WriteCSV(ctx context.Context, w io.Writer) error {
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot write %s as CSV: not a struct", typ)
+	}
+
+	var fields []int
+	var header []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if !csvSupported(field.Type.Kind()) {
+			return fmt.Errorf("cannot write field %s of type %s as CSV", field.Name, field.Type)
+		}
+		fields = append(fields, i)
+		header = append(header, field.Name)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(fields))
+	count := d.Size()
+	for i := 0; i < count; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		item, err := d.get(i)
+		if err != nil {
+			return err
+		}
+
+		value := reflect.ValueOf(item)
+		for j, field := range fields {
+			record[j] = csvFormat(value.Field(field))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvSupported reports whether WriteCSV can format a field of the given kind.
+func csvSupported(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// csvFormat formats a field value of a kind accepted by csvSupported.
+func csvFormat(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32)
+	default:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	}
+}
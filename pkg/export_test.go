@@ -0,0 +1,86 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestDBList_WriteJSON tests that the exported array decodes back to the list's sorted order.
+func TestDBList_WriteJSON(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 3}, {ID: 1}, {ID: 4}, {ID: 2}})
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+
+	var buf bytes.Buffer
+	if err := list.WriteJSON(context.Background(), &buf); err != nil {
+		t.Fatalf("Failed to write JSON: %v", err)
+	}
+
+	var decoded []Item
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Failed to decode JSON %q: %v", buf.String(), err)
+	}
+	if expected := []Item{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}; !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Expected %v, got %v", expected, decoded)
+	}
+
+	// An empty list is an empty array
+	buf.Reset()
+	if err := NewDBList[Item]("", 1).WriteJSON(context.Background(), &buf); err != nil || buf.String() != "[]" {
+		t.Errorf("Expected [], got %q, err %v", buf.String(), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := list.WriteJSON(ctx, &buf); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// TestDBList_WriteCSV tests exporting a struct type with a header row, and rejecting other types.
+func TestDBList_WriteCSV(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 3}, {ID: 1}, {ID: 2}})
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+
+	var buf bytes.Buffer
+	if err := list.WriteCSV(context.Background(), &buf); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+	if expected := "ID\n1\n2\n3\n"; buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+
+	type row struct {
+		Name   string
+		Score  float64
+		Active bool
+		note   string
+	}
+	rows := NewDBList[row]("", 2)
+	rows.Add(row{Name: "a, b", Score: 1.5, Active: true, note: "skipped"})
+
+	buf.Reset()
+	if err := rows.WriteCSV(context.Background(), &buf); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+	if expected := "Name,Score,Active\n\"a, b\",1.5,true\n"; buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+
+	if err := NewDBList[int]("", 1).WriteCSV(context.Background(), &buf); err == nil {
+		t.Errorf("Expected error writing a non-struct type")
+	}
+	if err := NewDBList[Document]("", 1).WriteCSV(context.Background(), &buf); err != nil {
+		t.Errorf("Expected Document to be supported, got %v", err)
+	}
+
+	type nested struct{ Inner Item }
+	if err := NewDBList[nested]("", 1).WriteCSV(context.Background(), &buf); err == nil {
+		t.Errorf("Expected error writing a nested struct field")
+	}
+}
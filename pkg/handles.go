@@ -0,0 +1,126 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// fileHandles keeps the files a store reads from open between reads, up to a limit, closing
+// the least recently used one to make room for another. A file in use when it is closed or
+// evicted stays open until its last reader releases it, so the limit can be passed while more
+// readers than that are reading different files at once. A limit of 0 keeps nothing open.
+type fileHandles struct {
+	mutex sync.Mutex
+	limit int
+	clock uint64
+	open  map[string]*openFile
+}
+
+// openFile is a file held by fileHandles along with the number of readers using it.
+type openFile struct {
+	file     *os.File
+	users    int
+	lastUsed uint64
+	// closing is set once the file has left the cache, for the last reader to close it
+	closing bool
+}
+
+func newFileHandles(limit int) *fileHandles {
+	return &fileHandles{limit: limit, open: make(map[string]*openFile)}
+}
+
+// acquire returns path opened for reading, along with a function to call once done with it.
+func (h *fileHandles) acquire(path string) (*os.File, func(), error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.clock++
+	handle, ok := h.open[path]
+	if !ok {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		handle = &openFile{file: file, closing: h.limit == 0}
+		if h.limit > 0 {
+			h.open[path] = handle
+		}
+	}
+	handle.users++
+	handle.lastUsed = h.clock
+	h.evict()
+
+	return handle.file, func() { h.release(handle) }, nil
+}
+
+// release ends a use of handle, closing it if it has left the cache.
+func (h *fileHandles) release(handle *openFile) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	handle.users--
+	if handle.closing && handle.users == 0 {
+		handle.file.Close()
+	}
+}
+
+// evict closes the least recently used files until no more than the limit are open, or every
+// file left is in use. The caller must hold the lock.
+func (h *fileHandles) evict() {
+	for len(h.open) > h.limit {
+		var victim string
+		var oldest *openFile
+		for path, handle := range h.open {
+			if handle.users == 0 && (oldest == nil || handle.lastUsed < oldest.lastUsed) {
+				victim, oldest = path, handle
+			}
+		}
+		if oldest == nil {
+			return
+		}
+
+		delete(h.open, victim)
+		oldest.file.Close()
+	}
+}
+
+// forget closes path if it is open, before the file is deleted or replaced.
+func (h *fileHandles) forget(path string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.drop(path)
+}
+
+// closeAll closes every open file, returning any errors from closing them.
+func (h *fileHandles) closeAll() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var errs []error
+	for path, handle := range h.open {
+		delete(h.open, path)
+		handle.closing = true
+		if handle.users == 0 {
+			errs = append(errs, handle.file.Close())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// drop removes path from the cache, closing it unless a reader is still using it. The caller
+// must hold the lock.
+func (h *fileHandles) drop(path string) {
+	handle, ok := h.open[path]
+	if !ok {
+		return
+	}
+
+	delete(h.open, path)
+	handle.closing = true
+	if handle.users == 0 {
+		handle.file.Close()
+	}
+}
@@ -0,0 +1,92 @@
+package util
+
+import (
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// openFDs returns the number of file descriptors the process has open, skipping the test
+// where they cannot be counted.
+func openFDs(t *testing.T) int {
+	t.Helper()
+
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("Cannot count open file descriptors: %v", err)
+	}
+	return len(entries)
+}
+
+// TestWithMaxOpenFiles tests that random reads across more chunks than the limit keep no more
+// than the limit open, and that Close leaves none behind.
+func TestWithMaxOpenFiles(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 0, WithMaxOpenFiles(3))
+	for i := range 40 {
+		list.Add(Item{ID: i})
+	}
+	if err := list.CompactToChunks(2); err != nil {
+		t.Fatalf("Failed to compact to chunks: %v", err)
+	}
+
+	before := openFDs(t)
+	r := rand.New(rand.NewSource(1))
+	for range 500 {
+		i := r.Intn(40)
+		if item, err := list.Get(i); err != nil || item.ID != i {
+			t.Fatalf("Get(%d): expected ID %d, got %v, err %v", i, i, item, err)
+		}
+	}
+
+	if got := len(list.chunks.handles.open); got != 3 {
+		t.Errorf("Expected 3 chunk files held open, got %d", got)
+	}
+	if got := openFDs(t); got > before+3 {
+		t.Errorf("Expected at most %d open file descriptors, got %d", before+3, got)
+	}
+
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close list: %v", err)
+	}
+	if got := openFDs(t); got > before {
+		t.Errorf("Expected the chunk files to be closed, %d file descriptors open against %d before", got, before)
+	}
+}
+
+// TestFileHandles_InUse tests that a file evicted or forgotten while in use stays open for its
+// reader and is closed on release.
+func TestFileHandles_InUse(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{dir + "/a", dir + "/b"}
+	for _, path := range paths {
+		if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	h := newFileHandles(1)
+	file, release, err := h.acquire(paths[0])
+	if err != nil {
+		t.Fatalf("Failed to acquire file: %v", err)
+	}
+
+	// The first file is in use, so opening the second cannot evict it
+	_, releaseB, err := h.acquire(paths[1])
+	if err != nil {
+		t.Fatalf("Failed to acquire file: %v", err)
+	}
+	releaseB()
+	if got := len(h.open); got != 2 {
+		t.Errorf("Expected both files open while one is in use, got %d", got)
+	}
+
+	h.forget(paths[0])
+	buf := make([]byte, 4)
+	if _, err := file.ReadAt(buf, 0); err != nil {
+		t.Errorf("Expected a forgotten file to stay readable while in use, got err %v", err)
+	}
+	release()
+	if _, err := file.ReadAt(buf, 0); err == nil {
+		t.Errorf("Expected the file to be closed once released")
+	}
+}
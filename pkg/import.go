@@ -0,0 +1,72 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ReadNDJSON reads newline-delimited JSON from r and appends each decoded item with Add.
+// Blank lines are skipped. A line that fails to decode stops the import with an error
+// giving its line number; the items read before it remain in the list.
+func (d *DBList[T]) ReadNDJSON(r io.Reader) error {
+	reader := bufio.NewReader(r)
+
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read line %d: %w", line, err)
+		}
+
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			var item T
+			if err := json.Unmarshal(data, &item); err != nil {
+				return fmt.Errorf("failed to decode line %d: %w", line, err)
+			}
+			if err := d.Add(item); err != nil {
+				return err
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+}
+
+// ReadJSONArray reads a JSON array of items from r, such as one written by WriteJSON, and
+// appends each element with Add as it is decoded, so the whole array is never held in memory.
+// Elements added before an error stay in the list. A decode error reports the element number
+// and byte offset at which it occurred.
+func (d *DBList[T]) ReadJSONArray(r io.Reader) error {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("failed to read JSON array: %w", err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("failed to read JSON array: expected [ at offset %d, got %v", dec.InputOffset(), tok)
+	}
+
+	for i := 0; dec.More(); i++ {
+		offset := dec.InputOffset()
+
+		var item T
+		if err := dec.Decode(&item); err != nil {
+			return fmt.Errorf("failed to decode element %d at offset %d: %w", i, offset, err)
+		}
+		if err := d.Add(item); err != nil {
+			return err
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("failed to read end of JSON array at offset %d: %w", dec.InputOffset(), err)
+	}
+
+	return nil
+}
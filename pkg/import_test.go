@@ -0,0 +1,88 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestDBList_NDJSONRoundTrip tests exporting a list as NDJSON and importing it into a fresh list.
+func TestDBList_NDJSONRoundTrip(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 3}, {ID: 1}, {ID: 2}, {ID: 5}})
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+
+	var buf bytes.Buffer
+	if err := list.WriteNDJSON(context.Background(), &buf); err != nil {
+		t.Fatalf("Failed to write NDJSON: %v", err)
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 4 {
+		t.Errorf("Expected 4 lines, got %d in %q", got, buf.String())
+	}
+
+	imported := NewDBList[Item](t.TempDir(), 1)
+	if err := imported.ReadNDJSON(&buf); err != nil {
+		t.Fatalf("Failed to read NDJSON: %v", err)
+	}
+
+	if got := imported.Size(); got != 4 {
+		t.Fatalf("Expected size to be 4, got %d", got)
+	}
+	for i, want := range []int{1, 2, 3, 5} {
+		if item, err := imported.Get(i); err != nil || item.ID != want {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, want, item, err)
+		}
+	}
+}
+
+// TestDBList_ReadNDJSON tests that blank lines are skipped and decode errors report their line.
+func TestDBList_ReadNDJSON(t *testing.T) {
+	list := NewDBList[Item]("", 10)
+
+	input := "{\"ID\":1}\n\n   \n{\"ID\":2}\n{\"ID\":3}"
+	if err := list.ReadNDJSON(strings.NewReader(input)); err != nil {
+		t.Fatalf("Failed to read NDJSON: %v", err)
+	}
+	if got := list.Size(); got != 3 {
+		t.Errorf("Expected size to be 3, got %d", got)
+	}
+
+	err := list.ReadNDJSON(strings.NewReader("{\"ID\":4}\n{\"ID\":\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected decode error on line 2, got %v", err)
+	}
+}
+
+// TestDBList_ReadJSONArray tests re-importing an export into a fresh list, and reporting malformed input.
+func TestDBList_ReadJSONArray(t *testing.T) {
+	src := NewDBList[Item](t.TempDir(), 2)
+	src.Adds([]Item{{ID: 3}, {ID: 1}, {ID: 4}, {ID: 1}, {ID: 5}})
+
+	var buf bytes.Buffer
+	if err := src.WriteJSON(context.Background(), &buf); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	dst := NewDBList[Item](t.TempDir(), 2)
+	if err := dst.ReadJSONArray(&buf); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	expected, _ := src.ToSlice(0)
+	if got, _ := dst.ToSlice(0); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	bad := NewDBList[Item](t.TempDir(), 2)
+	err := bad.ReadJSONArray(strings.NewReader(`[{"ID":1},{"ID":"two"}]`))
+	if err == nil || !strings.Contains(err.Error(), "element 1 at offset ") {
+		t.Errorf("Expected an error locating element 1, got %v", err)
+	}
+	if size := bad.Size(); size != 1 {
+		t.Errorf("Expected the element before the error to be added, got size %d", size)
+	}
+	if err := bad.ReadJSONArray(strings.NewReader(`{"ID":1}`)); err == nil {
+		t.Errorf("Expected an error for input that is not an array")
+	}
+}
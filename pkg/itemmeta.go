@@ -0,0 +1,186 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+)
+
+// recordEnvelope is the disk record of an item added with metadata by AddWithMeta.
+type recordEnvelope[T any] struct {
+	Item T
+	Meta map[string]string
+}
+
+// ErrMetaUnsupported is returned by AddWithMeta for a list created without WithItemMeta, whose
+// records do not say whether they hold metadata.
+var ErrMetaUnsupported = errors.New("list does not support item metadata")
+
+// The kinds of disk record, one of which starts the encoding of every record of a list created
+// with WithItemMeta, ahead of any compression or encryption.
+const (
+	// recordItem is the kind of a record holding just an item.
+	recordItem byte = iota
+	// recordWithMeta is the kind of a record holding a recordEnvelope.
+	recordWithMeta
+)
+
+// AddWithMeta appends an item along with metadata, such as a priority or source tag, that is
+// returned with it by GetWithMeta. The metadata is kept with the item in memory, or stored in
+// the same disk record when the item overflows to disk, which is marked as carrying it, so the
+// metadata survives reopening the list with OpenDBList even after a crash. The list must have
+// been created with WithItemMeta; otherwise ErrMetaUnsupported is returned.
+func (d *DBList[T]) AddWithMeta(item T, meta map[string]string) error {
+	if err := d.checkUnkeyed("AddWithMeta"); err != nil {
+		return err
+	}
+	if !d.recordKinds {
+		return ErrMetaUnsupported
+	}
+
+	d.mutex.Lock()
+	defer d.unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return err
+	}
+
+	index := d.nextIndex
+	if d.reserveMemory(item) {
+		if err := d.logMemoryPut(index, item, meta); err != nil {
+			d.releaseMemory(item)
+			return err
+		}
+		d.memoryData[index] = item
+		d.setItemMeta(index, meta)
+	} else {
+		if !d.hasDisk() {
+			return d.errNoDisk()
+		}
+		data, err := d.encodeWithMeta(item, meta)
+		if err != nil {
+			return err
+		}
+		if err := d.putLogged(index, data); err != nil {
+			return err
+		}
+		d.markEnvelope(index, meta != nil)
+		d.spilled(item)
+	}
+
+	d.nextIndex++
+	d.indexLookup(index, item)
+	d.publish(index)
+
+	return nil
+}
+
+// GetWithMeta retrieves an item by sorted index along with the metadata it was added with,
+// which is nil for items added without any. Negative indexes count back from the end as in Get.
+func (d *DBList[T]) GetWithMeta(index int) (T, map[string]string, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	var zero T
+	if d.closed {
+		return zero, nil, ErrClosed
+	}
+
+	if index < 0 {
+		index += len(d.sortedIndexes)
+	}
+	if index < 0 || index >= len(d.sortedIndexes) {
+		return zero, nil, fmt.Errorf("index out of range")
+	}
+
+	index = d.sortedIndexes[index]
+	if item, ok := d.memoryData[index]; ok {
+		return item, maps.Clone(d.itemMeta[index]), nil
+	}
+
+	return d.retrieveWithMeta(index)
+}
+
+// writeWithMeta writes the disk record for the item at physical index, wrapped in an envelope
+// with meta if it is not nil. The caller must hold the write lock.
+func (d *DBList[T]) writeWithMeta(index int, item T, meta map[string]string) error {
+	data, err := d.encodeWithMeta(item, meta)
+	if err != nil {
+		return err
+	}
+
+	return d.putWithMeta(index, data, meta != nil)
+}
+
+// encodeWithMeta serializes an item into its disk record, wrapped in an envelope with meta if
+// it is not nil.
+func (d *DBList[T]) encodeWithMeta(item T, meta map[string]string) ([]byte, error) {
+	if meta == nil {
+		return d.encode(item)
+	}
+
+	return d.encode(recordEnvelope[T]{Item: item, Meta: meta})
+}
+
+// putWithMeta writes an encoded disk record for physical index, noting whether it is an
+// envelope so updates know to read back its metadata. The caller must hold the write lock.
+func (d *DBList[T]) putWithMeta(index int, data []byte, envelope bool) error {
+	if err := d.disk.put(index, data); err != nil {
+		return err
+	}
+
+	d.markEnvelope(index, envelope)
+	return nil
+}
+
+// setItemMeta records a copy of the metadata of the in-memory item at physical index.
+func (d *DBList[T]) setItemMeta(index int, meta map[string]string) {
+	if meta == nil {
+		delete(d.itemMeta, index)
+		return
+	}
+	if d.itemMeta == nil {
+		d.itemMeta = make(map[int]map[string]string)
+	}
+	d.itemMeta[index] = maps.Clone(meta)
+}
+
+// markEnvelope notes whether the disk record at physical index is a recordEnvelope. The kind of
+// the record says so too, and OpenDBList rebuilds the notes from the records it reads.
+func (d *DBList[T]) markEnvelope(index int, envelope bool) {
+	if !envelope {
+		delete(d.envelopes, index)
+		return
+	}
+	if d.envelopes == nil {
+		d.envelopes = make(map[int]bool)
+	}
+	d.envelopes[index] = true
+}
+
+// renumberKeys returns a copy of m keyed by the new physical indexes in renumbered, dropping
+// entries for indexes that are not renumbered. It returns nil if m is nil.
+func renumberKeys[V any](m map[int]V, renumbered map[int]int) map[int]V {
+	if m == nil {
+		return nil
+	}
+
+	out := make(map[int]V, len(m))
+	for index, v := range m {
+		if newIndex, ok := renumbered[index]; ok {
+			out[newIndex] = v
+		}
+	}
+
+	return out
+}
+
+// WithItemMeta lets the list hold metadata added with AddWithMeta. Every record written to disk
+// starts with a byte saying whether it holds metadata, rather than being the codec's output
+// alone. The setting is saved in the metadata file, and a list opened with OpenDBList keeps the
+// setting it was created with.
+func WithItemMeta() Option {
+	return func(o *options) {
+		o.recordKinds = true
+	}
+}
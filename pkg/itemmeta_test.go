@@ -0,0 +1,141 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestDBList_AddWithMeta tests round-tripping metadata for items in memory and on disk.
+func TestDBList_AddWithMeta(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 1, WithItemMeta())
+
+	memMeta := map[string]string{"source": "memory", "priority": "1"}
+	diskMeta := map[string]string{"source": "disk"}
+	list.AddWithMeta(Item{ID: 1}, memMeta)
+	list.AddWithMeta(Item{ID: 2}, diskMeta)
+	list.Add(Item{ID: 3})
+
+	tests := []struct {
+		index int
+		id    int
+		meta  map[string]string
+	}{
+		{index: 0, id: 1, meta: memMeta},
+		{index: 1, id: 2, meta: diskMeta},
+		{index: 2, id: 3, meta: nil},
+	}
+	for _, tt := range tests {
+		item, meta, err := list.GetWithMeta(tt.index)
+		if err != nil {
+			t.Fatalf("GetWithMeta(%d): %v", tt.index, err)
+		}
+		if item.ID != tt.id || !reflect.DeepEqual(meta, tt.meta) {
+			t.Errorf("GetWithMeta(%d): expected %d %v, got %v %v", tt.index, tt.id, tt.meta, item, meta)
+		}
+
+		// Plain Get sees the item itself, not the envelope
+		if item, err := list.Get(tt.index); err != nil || item.ID != tt.id {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", tt.index, tt.id, item, err)
+		}
+	}
+
+	// Changing the caller's map does not change the stored metadata
+	memMeta["source"] = "changed"
+	if _, meta, _ := list.GetWithMeta(0); meta["source"] != "memory" {
+		t.Errorf("Expected stored metadata to be a copy, got %v", meta)
+	}
+
+	// Updating a disk item keeps its metadata
+	if err := list.Update(1, Item{ID: 20}); err != nil {
+		t.Fatalf("Failed to update item: %v", err)
+	}
+	if item, meta, err := list.GetWithMeta(1); err != nil || item.ID != 20 || meta["source"] != "disk" {
+		t.Errorf("Expected ID 20 with its metadata, got %v %v, err %v", item, meta, err)
+	}
+}
+
+// TestDBList_AddWithMetaReopen tests that metadata survives closing and reopening the list.
+func TestDBList_AddWithMetaReopen(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 1, WithItemMeta())
+	list.AddWithMeta(Item{ID: 1}, map[string]string{"tag": "a"})
+	list.AddWithMeta(Item{ID: 2}, map[string]string{"tag": "b"})
+	list.Add(Item{ID: 3})
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close list: %v", err)
+	}
+
+	reopened, err := OpenDBList[Item](tempDir, 1)
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	for i, want := range []string{"a", "b", ""} {
+		item, meta, err := reopened.GetWithMeta(i)
+		if err != nil || item.ID != i+1 || meta["tag"] != want {
+			t.Errorf("GetWithMeta(%d): expected ID %d tag %q, got %v %v, err %v", i, i+1, want, item, meta, err)
+		}
+	}
+
+	// Compact renumbers the metadata along with the items
+	reopened.Delete(0)
+	if err := reopened.Compact(); err != nil {
+		t.Fatalf("Failed to compact list: %v", err)
+	}
+	if item, meta, err := reopened.GetWithMeta(0); err != nil || item.ID != 2 || meta["tag"] != "b" {
+		t.Errorf("Expected ID 2 tag b after compaction, got %v %v, err %v", item, meta, err)
+	}
+}
+
+// TestDBList_AddWithMetaCrash tests that a record added with metadata after the last Flush is
+// read back with its metadata when the list is reopened without being closed.
+func TestDBList_AddWithMetaCrash(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0, WithItemMeta())
+	list.Add(Item{ID: 1})
+	if err := list.Flush(); err != nil {
+		t.Fatalf("Failed to flush list: %v", err)
+	}
+	if err := list.AddWithMeta(Item{ID: 2}, map[string]string{"tag": "b"}); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+
+	// The list is abandoned without Close, as after a crash
+	reopened, err := OpenDBList[Item](tempDir, 0, WithItemMeta())
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	item, meta, err := reopened.GetWithMeta(1)
+	if err != nil || item.ID != 2 || meta["tag"] != "b" {
+		t.Errorf("Expected ID 2 tag b, got %v %v, err %v", item, meta, err)
+	}
+
+	// Updating the reopened record keeps its metadata
+	if err := reopened.Update(1, Item{ID: 20}); err != nil {
+		t.Fatalf("Failed to update item: %v", err)
+	}
+	if item, meta, err := reopened.GetWithMeta(1); err != nil || item.ID != 20 || meta["tag"] != "b" {
+		t.Errorf("Expected ID 20 tag b after update, got %v %v, err %v", item, meta, err)
+	}
+}
+
+// TestWithItemMeta tests that metadata needs WithItemMeta, and that with it an item's bytes are
+// never taken for metadata, however they begin.
+func TestWithItemMeta(t *testing.T) {
+	plain := NewDBList[Item](t.TempDir(), 1)
+	if err := plain.AddWithMeta(Item{ID: 1}, map[string]string{"tag": "a"}); !errors.Is(err, ErrMetaUnsupported) {
+		t.Errorf("Expected ErrMetaUnsupported, got %v", err)
+	}
+
+	items := [][]byte{[]byte("\x00dbds:envelope\x00{}"), {recordWithMeta, '{', '}'}, {}}
+	for _, opts := range [][]Option{{WithCodec(RawBytesCodec{})}, {WithCodec(RawBytesCodec{}), WithItemMeta()}} {
+		list := NewDBList[[]byte](t.TempDir(), 0, opts...)
+		list.Adds(items)
+		for i, want := range items {
+			if item, err := list.Get(i); err != nil || !bytes.Equal(item, want) {
+				t.Errorf("Get(%d): expected %q, got %q, err %v", i, want, item, err)
+			}
+		}
+	}
+}
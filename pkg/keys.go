@@ -0,0 +1,422 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrKeyed is returned by the methods that cannot keep the keys given by WithKeyFunc unique
+// when called on a list created with it.
+var ErrKeyed = errors.New("not supported with WithKeyFunc")
+
+// keyIndex maps the keys given by WithKeyFunc, or by the key function of GetOrAdd, to the
+// physical indexes of their items, and back.
+// It has its own lock because the file store names records by key while writing them outside
+// the list's lock.
+type keyIndex struct {
+	mutex   sync.RWMutex
+	indexes map[string]int
+	keys    map[int]string
+}
+
+func newKeyIndex(keys map[int]string) *keyIndex {
+	k := &keyIndex{}
+	k.load(keys)
+	return k
+}
+
+// load replaces every key with those in keys, by physical index. The caller must hold the lock
+// or be the only user of k.
+func (k *keyIndex) load(keys map[int]string) {
+	k.indexes = make(map[string]int, len(keys))
+	k.keys = make(map[int]string, len(keys))
+	for index, key := range keys {
+		k.indexes[key] = index
+		k.keys[index] = key
+	}
+}
+
+// lookup returns the physical index of the item with key.
+func (k *keyIndex) lookup(key string) (int, bool) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	index, ok := k.indexes[key]
+	return index, ok
+}
+
+// keyFor returns the key of the item at physical index.
+func (k *keyIndex) keyFor(index int) (string, bool) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	key, ok := k.keys[index]
+	return key, ok
+}
+
+// set records key as belonging to the item at physical index.
+func (k *keyIndex) set(key string, index int) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.indexes[key] = index
+	k.keys[index] = key
+}
+
+// add records key as belonging to the item at physical index, unless another item already has
+// it, in which case key keeps finding that one.
+func (k *keyIndex) add(key string, index int) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if _, ok := k.indexes[key]; !ok {
+		k.indexes[key] = index
+	}
+	k.keys[index] = key
+}
+
+// forget drops the key of the item at physical index.
+func (k *keyIndex) forget(index int) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if key, ok := k.keys[index]; ok {
+		if k.indexes[key] == index {
+			delete(k.indexes, key)
+		}
+		delete(k.keys, index)
+	}
+}
+
+// reset drops every key, renumbering those in renumbered if it is not nil.
+func (k *keyIndex) reset(renumbered map[int]int) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if renumbered == nil {
+		k.load(nil)
+		return
+	}
+	k.load(renumberKeys(k.keys, renumbered))
+}
+
+// replace swaps every key for those in keys, by physical index.
+func (k *keyIndex) replace(keys map[int]string) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.load(keys)
+}
+
+// snapshot returns a copy of the keys by physical index.
+func (k *keyIndex) snapshot() map[int]string {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	return maps.Clone(k.keys)
+}
+
+// checkKey returns an error if key cannot name a record file, or could be mistaken for the
+// name of a record stored by index or of another file the list keeps in its directory.
+func (d *DBList[T]) checkKey(key string) error {
+	if key == "" {
+		return errors.New("key must not be empty")
+	}
+	if key == "." || key == ".." || strings.ContainsAny(key, "/\\\x00") {
+		return fmt.Errorf("key %q cannot be used as a file name", key)
+	}
+
+	name := key + d.fileExtension()
+	if _, ok := d.indexName(name); ok {
+		return fmt.Errorf("key %q could be mistaken for an index", key)
+	}
+	if name == metaFileName || name == walFileName || name == timesFileName || isChunkFileName(name) {
+		return fmt.Errorf("key %q is the name of a file kept by the list", key)
+	}
+
+	return nil
+}
+
+// addKeyed appends item as AddCtx does, unless an item with the same key is already in the
+// list, in which case that item is replaced where it stands. Unlike an unkeyed Add, the lock
+// is held while the item is written to disk, so two adds of one key cannot both append.
+func (d *DBList[T]) addKeyed(ctx context.Context, item T) error {
+	d.mutex.Lock()
+	defer d.unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return err
+	}
+
+	return d.upsertKeyed(ctx, item)
+}
+
+// addsKeyed adds items in slice order as Add does, each replacing the item already in the list
+// with its key, including one earlier in the batch. Every key is checked before anything is
+// stored, but unlike an unkeyed batch the items are stored one at a time, so if storing one
+// fails or ctx is cancelled, the items before it stay added.
+func (d *DBList[T]) addsKeyed(ctx context.Context, items []T) error {
+	d.mutex.Lock()
+	defer d.unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := d.checkKey(d.keyOf(item)); err != nil {
+			return err
+		}
+	}
+
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := d.upsertKeyed(ctx, item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkUnkeyed returns ErrKeyed for a method that does not consult keys, if the list has them.
+func (d *DBList[T]) checkUnkeyed(method string) error {
+	if d.keyOf != nil {
+		return fmt.Errorf("%s: %w", method, ErrKeyed)
+	}
+	return nil
+}
+
+// upsertKeyed appends item under its key, or replaces the item already in the list with that
+// key where it stands. The caller must hold the write lock.
+func (d *DBList[T]) upsertKeyed(ctx context.Context, item T) error {
+	key := d.keyOf(item)
+	if err := d.checkKey(key); err != nil {
+		return err
+	}
+
+	if index, ok := d.keys.lookup(key); ok {
+		if err := d.updateInStorage(index, item); err != nil {
+			return err
+		}
+		d.isSorted = false
+		d.generation++
+		return nil
+	}
+
+	return d.appendKeyed(ctx, key, item)
+}
+
+// GetOrAdd returns the item in the list with the same key as item, as given by key, or adds
+// item as Add does if there is none, reporting whether it was added. The lookup and the add
+// happen under one write lock, so of several concurrent calls with one key exactly one adds.
+// The first call builds an index of the keys of the items already in the list, loading each of
+// them, which is then kept up to date as items are added, updated, deleted and renumbered, so
+// key must give the same keys on every call. If several items share a key, one of them is
+// returned. On a list created with WithKeyFunc, key may be nil to look up by that function.
+func (d *DBList[T]) GetOrAdd(key func(T) string, item T) (T, bool, error) {
+	var zero T
+	if key == nil && d.keyOf == nil {
+		return zero, false, errors.New("GetOrAdd needs a key function")
+	}
+
+	d.mutex.Lock()
+	defer d.unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return zero, false, err
+	}
+
+	var index int
+	var found bool
+	if key == nil {
+		k := d.keyOf(item)
+		if err := d.checkKey(k); err != nil {
+			return zero, false, err
+		}
+		index, found = d.keys.lookup(k)
+	} else {
+		if d.lookups == nil {
+			if err := d.buildLookups(key); err != nil {
+				return zero, false, err
+			}
+		}
+		index, found = d.lookups.lookup(key(item))
+	}
+
+	if found {
+		existing, err := d.getFromStorage(index)
+		if err != nil {
+			return zero, false, err
+		}
+		return existing, false, nil
+	}
+
+	if err := d.addLocked(item); err != nil {
+		return zero, false, err
+	}
+
+	return item, true, nil
+}
+
+// addLocked appends item as Add does, but with the write lock held throughout. The caller must
+// hold the write lock.
+func (d *DBList[T]) addLocked(item T) error {
+	if d.keyOf != nil {
+		return d.upsertKeyed(context.Background(), item)
+	}
+
+	index := d.nextIndex
+	if err := d.storeAt(index, item); err != nil {
+		return err
+	}
+	d.nextIndex++
+	d.publish(index)
+
+	return nil
+}
+
+// buildLookups indexes the items in the list by key for GetOrAdd. The caller must hold the
+// write lock.
+func (d *DBList[T]) buildLookups(key func(T) string) error {
+	lookups := newKeyIndex(nil)
+	for _, index := range d.sortedIndexes {
+		item, err := d.getFromStorage(index)
+		if err != nil {
+			return fmt.Errorf("failed to load index %d: %w", index, err)
+		}
+		lookups.add(key(item), index)
+	}
+
+	d.lookups, d.lookupKey = lookups, key
+	return nil
+}
+
+// indexLookup records the key of item, newly stored at physical index, in the index built by
+// GetOrAdd, if there is one. The caller must hold the write lock.
+func (d *DBList[T]) indexLookup(index int, item T) {
+	if d.lookups == nil {
+		return
+	}
+
+	d.lookups.forget(index)
+	d.lookups.add(d.lookupKey(item), index)
+}
+
+// appendKeyed appends item, whose key is not yet in the list, under key. The caller must hold
+// the write lock.
+func (d *DBList[T]) appendKeyed(ctx context.Context, key string, item T) error {
+	index := d.nextIndex
+	d.nextIndex++
+	d.keys.set(key, index)
+
+	if err := d.storeKeyed(ctx, index, item); err != nil {
+		d.keys.forget(index)
+		d.releaseIndexes(index, 1)
+		return err
+	}
+	d.publish(index)
+
+	return nil
+}
+
+// storeKeyed stores a newly added item at index, in memory if there is room and otherwise on
+// disk. The caller must hold the write lock.
+func (d *DBList[T]) storeKeyed(ctx context.Context, index int, item T) error {
+	if d.reserveMemory(item) {
+		if err := d.logMemoryPut(index, item, nil); err != nil {
+			d.releaseMemory(item)
+			return err
+		}
+		d.memoryData[index] = item
+		d.indexLookup(index, item)
+		return nil
+	}
+
+	if !d.hasDisk() {
+		return d.errNoDisk()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := d.encode(item)
+	if err != nil {
+		return err
+	}
+	if err := d.putLogged(index, data); err != nil {
+		return err
+	}
+	d.indexLookup(index, item)
+	d.spilled(item)
+
+	return nil
+}
+
+// adoptKeyedFiles gives an index to each record file named by a key that the metadata does not
+// know about, because it was written after the metadata was last saved, and returns found with
+// those indexes appended. Indexes are given in file name order after every index in use.
+func (d *DBList[T]) adoptKeyedFiles(meta *listMetadata, found []int) ([]int, error) {
+	if !d.keyedFiles {
+		return found, nil
+	}
+
+	entries, err := os.ReadDir(d.diskPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return found, nil
+		}
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	next := 0
+	if meta != nil {
+		next = meta.NextIndex
+	}
+	if len(found) > 0 {
+		next = max(next, found[len(found)-1]+1)
+	}
+	for index := range d.keys.snapshot() {
+		next = max(next, index+1)
+	}
+
+	for _, entry := range entries {
+		key, ok := strings.CutSuffix(entry.Name(), d.fileExtension())
+		if entry.IsDir() || !ok || d.checkKey(key) != nil {
+			continue
+		}
+		if _, known := d.keys.lookup(key); known {
+			continue
+		}
+
+		d.keys.set(key, next)
+		found = append(found, next)
+		next++
+	}
+
+	return found, nil
+}
+
+// WithKeyFunc gives each item the key returned by key, making Add an upsert: adding an item
+// whose key is already in the list replaces that item where it stands instead of appending a
+// duplicate. With the default file per record, an item is stored on disk as <key>.json, or
+// with the extension set by WithFileExtension. A key must be usable as a file name, and must
+// not look like the number a record would otherwise be named by.
+//
+// Add and the methods built on it, such as AddCtx, ReadNDJSON and GetOrAdd, consult keys, and
+// so do Adds and AddsParallel, which store the items of a batch one at a time under one lock,
+// so the batch is no longer atomic. AddWithMeta, InsertSorted, MergeSorted and ReplaceAll
+// return ErrKeyed. An item replaced by Update keeps the key it was added with. The keys are
+// saved with the metadata, and a record named by a key that was written since is found again
+// by OpenDBList. WithKeyFunc cannot be combined with WithWriteAheadLog.
+func WithKeyFunc[T any](key func(T) string) Option {
+	return func(o *options) {
+		o.keyFunc = key
+	}
+}
@@ -0,0 +1,304 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// keyedItem is an item identified by a name.
+type keyedItem struct {
+	Name  string
+	Count int
+}
+
+func keyedName(item keyedItem) string { return item.Name }
+
+// TestDBList_KeyFunc tests that adding an item with a key already in the list replaces it,
+// and that records are stored under their keys.
+func TestDBList_KeyFunc(t *testing.T) {
+	dir := t.TempDir()
+	list, err := NewDBListWithOptions[keyedItem](WithPath(dir), WithMaxInMemory(1), WithKeyFunc(keyedName))
+	if err != nil {
+		t.Fatalf("Failed to create list: %v", err)
+	}
+
+	for _, item := range []keyedItem{{"a", 1}, {"b", 1}, {"c", 1}, {"b", 2}, {"a", 2}} {
+		if err := list.Add(item); err != nil {
+			t.Fatalf("Failed to add %v: %v", item, err)
+		}
+	}
+	if size := list.Size(); size != 3 {
+		t.Fatalf("Expected 3 items after adding duplicate keys, got %d", size)
+	}
+	for i, want := range []keyedItem{{"a", 2}, {"b", 2}, {"c", 1}} {
+		if item, err := list.Get(i); err != nil || item != want {
+			t.Errorf("Get(%d): expected %v, got %v, err %v", i, want, item, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.json")); err != nil {
+		t.Errorf("Expected the record for b to be named by its key: %v", err)
+	}
+
+	if err := list.Add(keyedItem{Name: "12"}); err == nil {
+		t.Errorf("Expected a key that looks like an index to be rejected")
+	}
+	if err := list.Add(keyedItem{Name: "../x"}); err == nil {
+		t.Errorf("Expected a key that is not a file name to be rejected")
+	}
+
+	// A deleted key can be added again, and Compact leaves keyed records where they are
+	if err := list.Delete(1); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := list.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if err := list.Add(keyedItem{"b", 3}); err != nil {
+		t.Fatalf("Failed to add: %v", err)
+	}
+	if err := list.Add(keyedItem{"c", 2}); err != nil {
+		t.Fatalf("Failed to add: %v", err)
+	}
+	if size := list.Size(); size != 3 {
+		t.Fatalf("Expected 3 items after compacting, got %d", size)
+	}
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	// The keys survive reopening, and a keyed record written after the metadata is found again
+	if err := os.WriteFile(filepath.Join(dir, "d.json"), []byte(`{"Name":"d","Count":1}`), 0o640); err != nil {
+		t.Fatalf("Failed to write record: %v", err)
+	}
+	reopened, err := OpenDBList[keyedItem](dir, 1, WithKeyFunc(keyedName))
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if err := reopened.Add(keyedItem{"d", 2}); err != nil {
+		t.Fatalf("Failed to add: %v", err)
+	}
+	if err := reopened.Add(keyedItem{"a", 3}); err != nil {
+		t.Fatalf("Failed to add: %v", err)
+	}
+	values, err := reopened.Values()
+	if err != nil {
+		t.Fatalf("Failed to read values: %v", err)
+	}
+	expected := []keyedItem{{"a", 3}, {"c", 2}, {"b", 3}, {"d", 2}}
+	if len(values) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, values)
+	}
+	for i := range expected {
+		if values[i] != expected[i] {
+			t.Errorf("Item %d: expected %v, got %v", i, expected[i], values[i])
+		}
+	}
+}
+
+// TestDBList_KeyFuncAppendOnly tests upserts in a list whose records are not named by key.
+func TestDBList_KeyFuncAppendOnly(t *testing.T) {
+	dir := t.TempDir()
+	list := NewDBList[keyedItem](dir, 0, WithAppendOnlyFile(), WithKeyFunc(keyedName))
+	for i := range 3 {
+		list.Add(keyedItem{Name: "k" + strconv.Itoa(i%2), Count: i})
+	}
+	if err := list.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	list.Add(keyedItem{Name: "k2"})
+
+	reopened, err := OpenDBList[keyedItem](dir, 0, WithAppendOnlyFile(), WithKeyFunc(keyedName))
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	reopened.Add(keyedItem{Name: "k1", Count: 5})
+	reopened.Add(keyedItem{Name: "k2", Count: 5})
+	if size := reopened.Size(); size != 3 {
+		t.Errorf("Expected 3 items, got %d", size)
+	}
+	if item, err := reopened.Get(1); err != nil || item.Count != 5 {
+		t.Errorf("Expected k1 to be replaced, got %v, err %v", item, err)
+	}
+}
+
+// TestDBList_KeyFuncBatches tests that batch adds replace items with keys already in the list,
+// and that the methods that cannot keep keys unique refuse to run.
+func TestDBList_KeyFuncBatches(t *testing.T) {
+	list, err := NewDBListWithOptions[keyedItem](WithPath(t.TempDir()), WithMaxInMemory(1), WithKeyFunc(keyedName))
+	if err != nil {
+		t.Fatalf("Failed to create list: %v", err)
+	}
+
+	list.Add(keyedItem{"a", 1})
+	if err := list.Adds([]keyedItem{{"a", 2}, {"b", 1}, {"b", 2}}); err != nil {
+		t.Fatalf("Failed to add batch: %v", err)
+	}
+	if err := list.AddsParallel([]keyedItem{{"c", 1}, {"a", 3}}, 2); err != nil {
+		t.Fatalf("Failed to add batch in parallel: %v", err)
+	}
+	if size := list.Size(); size != 3 {
+		t.Fatalf("Expected 3 items after adding duplicate keys, got %d", size)
+	}
+	for i, want := range []keyedItem{{"a", 3}, {"b", 2}, {"c", 1}} {
+		if item, err := list.Get(i); err != nil || item != want {
+			t.Errorf("Get(%d): expected %v, got %v, err %v", i, want, item, err)
+		}
+	}
+
+	// A bad key anywhere in the batch stops it before anything is stored
+	if err := list.Adds([]keyedItem{{"d", 1}, {"../x", 1}}); err == nil {
+		t.Errorf("Expected a key that is not a file name to be rejected")
+	}
+	if size := list.Size(); size != 3 {
+		t.Errorf("Expected the rejected batch not to be added, got size %d", size)
+	}
+
+	less := func(a, b keyedItem) bool { return a.Name < b.Name }
+	for name, call := range map[string]func() error{
+		"AddWithMeta":  func() error { return list.AddWithMeta(keyedItem{"a", 4}, map[string]string{"k": "v"}) },
+		"InsertSorted": func() error { return list.InsertSorted(keyedItem{"a", 4}, less) },
+		"MergeSorted":  func() error { return list.MergeSorted([]keyedItem{{"a", 4}}, less) },
+		"ReplaceAll":   func() error { return list.ReplaceAll([]keyedItem{{"a", 4}}) },
+	} {
+		if err := call(); !errors.Is(err, ErrKeyed) {
+			t.Errorf("%s: expected ErrKeyed, got %v", name, err)
+		}
+	}
+	if size := list.Size(); size != 3 {
+		t.Errorf("Expected 3 items, got %d", size)
+	}
+}
+
+// TestDBList_KeyFuncOptions tests that WithKeyFunc rejects a function for the wrong type and
+// the write-ahead log.
+func TestDBList_KeyFuncOptions(t *testing.T) {
+	if _, err := NewDBListWithOptions[Item](WithKeyFunc(keyedName)); err == nil {
+		t.Errorf("Expected an error for a key function of the wrong type")
+	}
+	if _, err := NewDBListWithOptions[keyedItem](WithPath(t.TempDir()), WithKeyFunc(keyedName), WithWriteAheadLog()); err == nil {
+		t.Errorf("Expected an error for WithKeyFunc with WithWriteAheadLog")
+	}
+}
+
+// TestDBList_GetOrAdd tests that of many concurrent GetOrAdd calls with one key exactly one adds
+// its item, and every call returns that item.
+func TestDBList_GetOrAdd(t *testing.T) {
+	list, err := NewDBListWithOptions[keyedItem](WithPath(t.TempDir()), WithMaxInMemory(1), WithKeyFunc(keyedName))
+	if err != nil {
+		t.Fatalf("Failed to create list: %v", err)
+	}
+	list.Add(keyedItem{"first", 1})
+
+	const callers = 50
+	results := make([]keyedItem, callers)
+	added := make([]bool, callers)
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			item, ok, err := list.GetOrAdd(nil, keyedItem{"shared", i})
+			if err != nil {
+				t.Errorf("GetOrAdd failed: %v", err)
+			}
+			results[i], added[i] = item, ok
+		}()
+	}
+	wg.Wait()
+
+	winners := 0
+	for i, ok := range added {
+		if ok {
+			winners++
+		}
+		if results[i] != results[0] {
+			t.Errorf("Expected every call to return the same item, got %v and %v", results[0], results[i])
+		}
+	}
+	if winners != 1 {
+		t.Errorf("Expected exactly one call to add, got %d", winners)
+	}
+	if size := list.Size(); size != 2 {
+		t.Errorf("Expected 2 items, got %d", size)
+	}
+
+	// An item already in the list is returned rather than replaced
+	if item, ok, err := list.GetOrAdd(keyedName, keyedItem{"first", 2}); err != nil || ok || item != (keyedItem{"first", 1}) {
+		t.Errorf("Expected the existing item, got %v, added %v, err %v", item, ok, err)
+	}
+
+	unkeyed := NewDBList[keyedItem](t.TempDir(), 1)
+	if _, _, err := unkeyed.GetOrAdd(nil, keyedItem{"a", 1}); err == nil {
+		t.Errorf("Expected error for a nil key on a list without WithKeyFunc")
+	}
+}
+
+// TestDBList_GetOrAddUnkeyed tests GetOrAdd on a list without WithKeyFunc, whose index of keys
+// is built on first use and kept up to date by Add, Delete, Compact and ReplaceAll.
+func TestDBList_GetOrAddUnkeyed(t *testing.T) {
+	list := NewDBList[keyedItem](t.TempDir(), 1)
+	list.Adds([]keyedItem{{"a", 1}, {"b", 2}})
+
+	getOrAdd := func(item keyedItem, wantAdded bool, want keyedItem) {
+		t.Helper()
+		got, added, err := list.GetOrAdd(keyedName, item)
+		if err != nil || added != wantAdded || got != want {
+			t.Errorf("GetOrAdd(%v): expected %v, added %v, got %v, added %v, err %v", item, want, wantAdded, got, added, err)
+		}
+	}
+
+	// Items already in the list, in memory and on disk, are found
+	getOrAdd(keyedItem{"a", 10}, false, keyedItem{"a", 1})
+	getOrAdd(keyedItem{"b", 20}, false, keyedItem{"b", 2})
+
+	// Items added since the index was built are found, and deleted ones are not
+	list.Add(keyedItem{"c", 3})
+	getOrAdd(keyedItem{"c", 30}, false, keyedItem{"c", 3})
+	if err := list.Delete(0); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	getOrAdd(keyedItem{"a", 10}, true, keyedItem{"a", 10})
+
+	// Compact renumbers the index along with the items
+	if err := list.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	getOrAdd(keyedItem{"b", 20}, false, keyedItem{"b", 2})
+	getOrAdd(keyedItem{"a", 100}, false, keyedItem{"a", 10})
+
+	// ReplaceAll swaps the keys along with the items
+	if err := list.ReplaceAll([]keyedItem{{"b", 4}, {"d", 5}}); err != nil {
+		t.Fatalf("Failed to replace: %v", err)
+	}
+	getOrAdd(keyedItem{"b", 40}, false, keyedItem{"b", 4})
+	getOrAdd(keyedItem{"a", 1}, true, keyedItem{"a", 1})
+	if size := list.Size(); size != 3 {
+		t.Errorf("Expected 3 items, got %d", size)
+	}
+
+	// Concurrent calls with one key add exactly once
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	winners := 0
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, added, err := list.GetOrAdd(keyedName, keyedItem{"shared", i}); err != nil {
+				t.Errorf("GetOrAdd failed: %v", err)
+			} else if added {
+				mutex.Lock()
+				winners++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if winners != 1 {
+		t.Errorf("Expected exactly one call to add, got %d", winners)
+	}
+}
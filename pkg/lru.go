@@ -0,0 +1,162 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"sync"
+)
+
+// MemoryPolicy decides which items a DBList keeps in its memory tier.
+type MemoryPolicy int
+
+const (
+	// FIFO keeps the items that were added while there was room in memory, and every later
+	// item goes to disk until room is freed. It is the default.
+	FIFO MemoryPolicy = iota
+	// LRU treats the memory tier as a cache: getting an item stored on disk with Get moves it
+	// into memory, moving the least recently used items in memory out to disk to make room.
+	LRU
+)
+
+// recencyTracker records when items were last used, for the LRU memory policy. It has its own
+// lock so that readers holding only the list's read lock can record uses.
+type recencyTracker struct {
+	mutex    sync.Mutex
+	clock    uint64
+	lastUsed map[int]uint64
+}
+
+func newRecencyTracker() *recencyTracker {
+	return &recencyTracker{lastUsed: make(map[int]uint64)}
+}
+
+// touch records a use of the item at physical index.
+func (r *recencyTracker) touch(index int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.clock++
+	r.lastUsed[index] = r.clock
+}
+
+// forget drops the record of the item at physical index.
+func (r *recencyTracker) forget(index int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.lastUsed, index)
+}
+
+// reset drops every record, renumbering those in renumbered if it is not nil.
+func (r *recencyTracker) reset(renumbered map[int]int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if renumbered == nil {
+		r.lastUsed = make(map[int]uint64)
+		return
+	}
+	r.lastUsed = renumberKeys(r.lastUsed, renumbered)
+}
+
+// coldest returns the physical index of the least recently used item in memory, or -1 if
+// memory is empty. Items never used count as older than any that were, and ties go to the
+// lowest index.
+func (r *recencyTracker) coldest(memory iter.Seq[int]) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	victim := -1
+	var oldest uint64
+	for index := range memory {
+		used := r.lastUsed[index]
+		if victim < 0 || used < oldest || (used == oldest && index < victim) {
+			victim, oldest = index, used
+		}
+	}
+
+	return victim
+}
+
+// used records a use under the LRU policy of item, at physical index, moving it into memory
+// if it was read from disk.
+func (d *DBList[T]) used(index int, item T, inMemory bool) {
+	d.recency.touch(index)
+	if !inMemory {
+		d.promoteHot(index, item)
+	}
+}
+
+// promoteHot moves item, at physical index, from disk into memory, moving the least recently
+// used items in memory to disk until it fits. Items still being added stay put. An item that
+// would not fit even in an empty memory tier is left on disk without moving anything. Failures
+// are logged, since the item has already been returned to the caller.
+func (d *DBList[T]) promoteHot(index int, item T) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.checkWritable() != nil {
+		return
+	}
+	if _, ok := d.memoryData[index]; ok {
+		return
+	}
+	if !d.fitsInMemory(item) {
+		return
+	}
+
+	for {
+		moved, err := d.moveToMemory(index)
+		if errors.Is(err, ErrIndexNotFound) {
+			// Deleted since it was read
+			return
+		}
+		if err != nil {
+			d.logger.Error(fmt.Sprintf("DBList failed to promote index %d", index), "error", err)
+			return
+		}
+		if moved {
+			return
+		}
+
+		victim := d.recency.coldest(d.published())
+		if victim < 0 {
+			return
+		}
+		if err := d.moveToDisk(victim); err != nil {
+			d.logger.Error(fmt.Sprintf("DBList failed to demote index %d", victim), "error", err)
+			return
+		}
+	}
+}
+
+// published yields the physical indexes of the items in memory, leaving out the ones
+// reserved by an add that has not yet published them. The caller must hold the lock.
+func (d *DBList[T]) published() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for index := range d.memoryData {
+			if !d.reserved[index] && !yield(index) {
+				return
+			}
+		}
+	}
+}
+
+// fitsInMemory reports whether item could be held in memory were the memory tier empty.
+func (d *DBList[T]) fitsInMemory(item T) bool {
+	if d.memoryBudget <= 0 {
+		return d.maxInMemory > 0
+	}
+
+	size, err := d.memorySize(item)
+	return err == nil && size <= d.memoryBudget
+}
+
+// WithMemoryPolicy sets which items are kept in memory once the memory tier is full. The
+// default, FIFO, keeps the earliest items; LRU keeps the items most recently read with Get.
+func WithMemoryPolicy(policy MemoryPolicy) Option {
+	return func(o *options) {
+		o.memoryPolicy = policy
+	}
+}
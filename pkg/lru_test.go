@@ -0,0 +1,163 @@
+package util
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestWithMemoryPolicy_LRU tests that under a skewed access pattern the hot items end up in
+// memory, items keep their values as they move between tiers, and FIFO leaves memory alone.
+func TestWithMemoryPolicy_LRU(t *testing.T) {
+	items := make([]Item, 10)
+	for i := range items {
+		items[i] = Item{ID: i}
+	}
+
+	list := NewDBList[Item](t.TempDir(), 2, WithMemoryPolicy(LRU))
+	list.Adds(items)
+
+	for round := range 20 {
+		for _, i := range []int{2 + round%5, 7, 8, 7, 8} {
+			if item, err := list.Get(i); err != nil || item.ID != i {
+				t.Fatalf("Get(%d): expected ID %d, got %v, err %v", i, i, item, err)
+			}
+		}
+	}
+
+	if inMemory := slices.Sorted(maps.Keys(list.memoryData)); !slices.Equal(inMemory, []int{7, 8}) {
+		t.Errorf("Expected the hot items 7 and 8 in memory, got %v", inMemory)
+	}
+	for i := range items {
+		if item, err := list.get(i); err != nil || item.ID != i {
+			t.Errorf("get(%d): expected ID %d, got %v, err %v", i, i, item, err)
+		}
+	}
+	if stats := list.Stats(); stats.InMemory != 2 || stats.OnDisk != 8 {
+		t.Errorf("Expected 2 items in memory and 8 on disk, got %+v", stats)
+	}
+
+	fifo := NewDBList[Item](t.TempDir(), 2)
+	fifo.Adds(items)
+	for range 5 {
+		fifo.Get(7)
+	}
+	if inMemory := slices.Sorted(maps.Keys(fifo.memoryData)); !slices.Equal(inMemory, []int{0, 1}) {
+		t.Errorf("Expected FIFO to keep the first items in memory, got %v", inMemory)
+	}
+}
+
+// TestWithMemoryPolicy_LRUOversized tests that reading an item too large for the memory budget
+// leaves the memory tier as it is rather than emptying it to make room.
+func TestWithMemoryPolicy_LRUOversized(t *testing.T) {
+	list := NewDBList[keyedItem](t.TempDir(), 0, WithMemoryPolicy(LRU), WithMemoryBudgetBytes(100))
+	for i := range 4 {
+		list.Add(keyedItem{Name: strconv.Itoa(i)})
+	}
+	list.Add(keyedItem{Name: strings.Repeat("x", 200)})
+
+	before := list.Stats()
+	if before.InMemory == 0 || before.OnDisk != 1 {
+		t.Fatalf("Expected the small items in memory and the large one on disk, got %+v", before)
+	}
+
+	for range 3 {
+		if item, err := list.Get(4); err != nil || len(item.Name) != 200 {
+			t.Fatalf("Expected the large item, got %v, err %v", item, err)
+		}
+	}
+	if after := list.Stats(); after.InMemory != before.InMemory || after.OnDisk != before.OnDisk {
+		t.Errorf("Expected memory to be left alone, got %+v, was %+v", after, before)
+	}
+}
+
+// gatedBackend is a memoryBackend whose Put of one index signals started, then waits for
+// release and fails.
+type gatedBackend struct {
+	*memoryBackend
+	index   int
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *gatedBackend) Put(index int, data []byte) error {
+	if index != b.index {
+		return b.memoryBackend.Put(index, data)
+	}
+
+	close(b.started)
+	<-b.release
+	return errors.New("put failed")
+}
+
+// TestWithMemoryPolicy_LRUReserved tests that promoting an item does not demote a memory slot
+// AddsParallel has reserved for an item it has yet to publish, which would be orphaned on disk
+// when the add fails.
+func TestWithMemoryPolicy_LRUReserved(t *testing.T) {
+	backend := &gatedBackend{memoryBackend: newMemoryBackend(), index: 4, started: make(chan struct{}), release: make(chan struct{})}
+	list := NewDBList[Item]("", 2, WithMemoryPolicy(LRU), WithBackend(backend))
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+	if err := list.Delete(1); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+
+	// Index 3 takes the free memory slot while index 4 is stuck writing to the backend
+	done := make(chan error)
+	go func() { done <- list.AddsParallel([]Item{{ID: 3}, {ID: 4}}, 1) }()
+	<-backend.started
+
+	list.Get(0)
+	if item, err := list.Get(1); err != nil || item.ID != 2 {
+		t.Fatalf("Get(1): expected ID 2, got %v, err %v", item, err)
+	}
+	close(backend.release)
+	if err := <-done; err == nil {
+		t.Fatalf("Expected AddsParallel to fail")
+	}
+
+	if inMemory := slices.Sorted(maps.Keys(list.memoryData)); !slices.Equal(inMemory, []int{2}) {
+		t.Errorf("Expected only index 2 in memory, got %v", inMemory)
+	}
+	if _, err := backend.Get(3); err == nil {
+		t.Errorf("Expected no record left behind for the rolled back index 3")
+	}
+	for i, want := range []int{0, 2} {
+		if item, err := list.get(i); err != nil || item.ID != want {
+			t.Errorf("get(%d): expected ID %d, got %v, err %v", i, want, item, err)
+		}
+	}
+}
+
+// TestWithMemoryPolicy_LRUCrash tests that an item moved into memory by Get keeps its disk
+// record, so it survives the list being reopened without Close.
+func TestWithMemoryPolicy_LRUCrash(t *testing.T) {
+	dir := t.TempDir()
+	list := NewDBList[Item](dir, 1, WithMemoryPolicy(LRU))
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+	if err := list.Flush(); err != nil {
+		t.Fatalf("Failed to flush list: %v", err)
+	}
+	if item, err := list.Get(2); err != nil || item.ID != 2 {
+		t.Fatalf("Get(2): expected ID 2, got %v, err %v", item, err)
+	}
+	if _, ok := list.memoryData[2]; !ok {
+		t.Fatalf("Expected ID 2 to be moved into memory, got %v", list.memoryData)
+	}
+
+	// The list is abandoned without Close, as after a crash
+	reopened, err := OpenDBList[Item](dir, 1)
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if size := reopened.Size(); size != 3 {
+		t.Fatalf("Expected 3 items, got %d", size)
+	}
+	for i := range 3 {
+		if item, err := reopened.Get(i); err != nil || item.ID != i {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, i, item, err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package util
+
+import "fmt"
+
+// reserveMemory reports whether item fits in the memory tier, accounting for its size if so.
+// With a memory budget the estimated serialized size of the memory tier must stay within the
+// budget; otherwise the memory tier holds up to maxInMemory items.
+func (d *DBList[T]) reserveMemory(item T) bool {
+	if d.memoryBudget <= 0 {
+		return len(d.memoryData) < d.maxInMemory
+	}
+
+	size, err := d.memorySize(item)
+	if err != nil || d.memoryBytes+size > d.memoryBudget {
+		return false
+	}
+
+	d.memoryBytes += size
+	return true
+}
+
+// releaseMemory removes the size of an item leaving the memory tier from the budget.
+func (d *DBList[T]) releaseMemory(item T) {
+	if d.memoryBudget <= 0 {
+		return
+	}
+
+	if size, err := d.memorySize(item); err == nil {
+		d.memoryBytes -= size
+	}
+}
+
+// memorySize estimates the memory used by an item as the size of its serialized form.
+func (d *DBList[T]) memorySize(item T) (int64, error) {
+	data, err := d.codec.Marshal(item)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(data)), nil
+}
+
+// promoteFromDisk moves the first item in sorted order that is stored on disk into the memory
+// tier, if it fits, keeping its disk record. The caller must hold the write lock. Failures are
+// logged rather than returned, since the delete that freed the room has already happened.
+func (d *DBList[T]) promoteFromDisk() {
+	for _, index := range d.sortedIndexes {
+		if _, ok := d.memoryData[index]; ok {
+			continue
+		}
+
+		if _, err := d.moveToMemory(index); err != nil {
+			d.logger.Error(fmt.Sprintf("DBList failed to promote index %d", index), "error", err)
+		}
+		return
+	}
+}
+
+// moveToMemory loads the item at physical index from disk into memory, if it fits, and reports
+// whether it was moved. Its record is kept, as for the items loaded by OpenDBList, since items
+// in memory are only written out by Close; an update or delete removes it. The caller must hold
+// the write lock.
+func (d *DBList[T]) moveToMemory(index int) (bool, error) {
+	item, meta, err := d.retrieveWithMeta(index)
+	if err != nil {
+		return false, err
+	}
+	if !d.reserveMemory(item) {
+		return false, nil
+	}
+	d.memoryData[index] = item
+	d.setItemMeta(index, meta)
+
+	return true, nil
+}
+
+// moveToDisk writes the item at physical index, which is in memory, to disk and drops it from
+// memory. The caller must hold the write lock.
+func (d *DBList[T]) moveToDisk(index int) error {
+	if !d.hasDisk() {
+		return d.errNoDisk()
+	}
+
+	item := d.memoryData[index]
+	if err := d.writeWithMeta(index, item, d.itemMeta[index]); err != nil {
+		return err
+	}
+	d.releaseMemory(item)
+	delete(d.memoryData, index)
+	delete(d.itemMeta, index)
+
+	return nil
+}
+
+// Resize changes the number of items kept in memory. Shrinking writes the items in memory that
+// are last in sorted order to disk until the rest fit; growing loads the first items in sorted
+// order that are on disk into memory, keeping their records. The sort order is unchanged. When
+// a budget is set with WithMemoryBudgetBytes the count is ignored, as at construction, so only
+// the budget decides which items fit. It returns ErrNoDiskPath if items must spill without a
+// disk path.
+func (d *DBList[T]) Resize(newMax int) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return err
+	}
+	if newMax < 0 {
+		return fmt.Errorf("invalid maximum in memory %d", newMax)
+	}
+	d.waitForWrites()
+
+	d.maxInMemory = newMax
+	for i := len(d.sortedIndexes) - 1; i >= 0 && d.memoryBudget <= 0 && len(d.memoryData) > newMax; i-- {
+		index := d.sortedIndexes[i]
+		if _, ok := d.memoryData[index]; !ok {
+			continue
+		}
+		if err := d.moveToDisk(index); err != nil {
+			return err
+		}
+	}
+
+	for _, index := range d.sortedIndexes {
+		if d.memoryBudget <= 0 && len(d.memoryData) >= newMax {
+			break
+		}
+		if _, ok := d.memoryData[index]; ok {
+			continue
+		}
+
+		moved, err := d.moveToMemory(index)
+		if err != nil {
+			return err
+		}
+		if !moved {
+			break
+		}
+	}
+
+	return nil
+}
+
+// capacityHint returns the capacity to allocate up front for a memory tier of maxInMemory
+// items, which is capped so an unbounded tier does not preallocate.
+func capacityHint(maxInMemory int) int {
+	return min(max(maxInMemory, 0), defaultMaxInMemory)
+}
+
+// errNoDisk returns the error for an item that does not fit in memory when there is no disk
+// path for it to go to.
+func (d *DBList[T]) errNoDisk() error {
+	if d.memoryOnly {
+		return ErrMemoryFull
+	}
+	return ErrNoDiskPath
+}
+
+// InMemoryOnly keeps every item in memory and never touches the filesystem: the list has no
+// disk path, even if one is passed to NewDBList, so Flush and Close have nothing to write. The
+// memory tier is unbounded unless it is capped by WithMaxInMemory, which includes the maximum
+// passed to NewDBList, or by WithMemoryBudgetBytes, in either order; an item that does not fit
+// then fails with ErrMemoryFull. Lists made from this one, such as by Filter or Partition, are
+// kept in memory only too.
+func InMemoryOnly() Option {
+	return func(o *options) {
+		o.memoryOnly = true
+		o.path = ""
+	}
+}
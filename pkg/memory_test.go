@@ -0,0 +1,315 @@
+package util
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestDBList_WithMemoryBudgetBytes tests that the byte budget rather than the item count governs spilling.
+func TestDBList_WithMemoryBudgetBytes(t *testing.T) {
+	list := NewDBList[Document](t.TempDir(), 1, WithMemoryBudgetBytes(200))
+
+	small := Document{ID: 1, Body: "tiny"}                   // {"ID":1,"Body":"tiny"} is 22 bytes
+	large := Document{ID: 2, Body: strings.Repeat("x", 300)} // larger than the whole budget
+
+	// Several small items fit despite maxInMemory being 1
+	for i := 0; i < 5; i++ {
+		if err := list.Add(small); err != nil {
+			t.Fatalf("Failed to add item: %v", err)
+		}
+	}
+	if got := len(list.memoryData); got != 5 {
+		t.Errorf("Expected 5 small items in memory, got %d", got)
+	}
+
+	// A large item goes to disk, but later small items still fill the remaining budget
+	list.Add(large)
+	list.Add(small)
+	if _, ok := list.memoryData[5]; ok {
+		t.Errorf("Expected large item to spill to disk")
+	}
+	if _, ok := list.memoryData[6]; !ok {
+		t.Errorf("Expected small item after the large one to stay in memory")
+	}
+	if list.memoryBytes != 6*22 {
+		t.Errorf("Expected 132 bytes in memory, got %d", list.memoryBytes)
+	}
+
+	for i := 0; i < 5; i++ {
+		list.Add(small)
+	}
+	if list.memoryBytes > 200 {
+		t.Errorf("Expected memory tier to stay within budget, got %d bytes", list.memoryBytes)
+	}
+
+	// Deleting frees room in the budget
+	before := list.memoryBytes
+	if err := list.Delete(0); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+	if list.memoryBytes != before-22 {
+		t.Errorf("Expected delete to release 22 bytes, got %d -> %d", before, list.memoryBytes)
+	}
+
+	if item, err := list.Get(4); err != nil || item != large {
+		t.Errorf("Expected large item from disk, got %v, err %v", item.ID, err)
+	}
+}
+
+// TestDBList_WithPromoteOnDelete tests that deleting a memory item moves the first disk item into memory.
+func TestDBList_WithPromoteOnDelete(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2, WithPromoteOnDelete())
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}, {ID: 3}})
+
+	if err := list.Delete(0); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+
+	if got := len(list.memoryData); got != 2 {
+		t.Errorf("Expected memory to stay full with 2 items, got %d", got)
+	}
+	if item, ok := list.memoryData[2]; !ok || item.ID != 2 {
+		t.Errorf("Expected ID 2 to be promoted to memory, got %v", list.memoryData)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "2.json")); err != nil {
+		t.Errorf("Expected promoted item's file to be kept, got err %v", err)
+	}
+	for i, want := range []int{1, 2, 3} {
+		if item, err := list.Get(i); err != nil || item.ID != want {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, want, item, err)
+		}
+	}
+
+	// Deleting a disk item leaves memory alone, and without the option nothing is promoted
+	list.Delete(2)
+	if got := len(list.memoryData); got != 2 {
+		t.Errorf("Expected 2 items in memory, got %d", got)
+	}
+
+	plain := NewDBList[Item](t.TempDir(), 2)
+	plain.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+	plain.Delete(0)
+	if got := len(plain.memoryData); got != 1 {
+		t.Errorf("Expected 1 item in memory without the option, got %d", got)
+	}
+}
+
+// TestDBList_WithPromoteOnDeleteCrash tests that an item promoted into memory by a delete keeps
+// its disk record, so it survives the list being reopened without Close.
+func TestDBList_WithPromoteOnDeleteCrash(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 1, WithPromoteOnDelete())
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+	if err := list.Delete(0); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+	if _, ok := list.memoryData[1]; !ok {
+		t.Fatalf("Expected ID 1 to be promoted to memory, got %v", list.memoryData)
+	}
+	if err := list.Flush(); err != nil {
+		t.Fatalf("Failed to flush list: %v", err)
+	}
+
+	// The list is abandoned without Close, as after a crash
+	reopened, err := OpenDBList[Item](tempDir, 1)
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if size := reopened.Size(); size != 2 {
+		t.Fatalf("Expected 2 items, got %d", size)
+	}
+	for i, want := range []int{1, 2} {
+		if item, err := reopened.Get(i); err != nil || item.ID != want {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, want, item, err)
+		}
+	}
+}
+
+// TestDBList_Resize tests shrinking and growing the memory tier without changing the items or their order.
+func TestDBList_Resize(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 4)
+	list.Adds([]Item{{ID: 5}, {ID: 3}, {ID: 1}, {ID: 4}, {ID: 2}, {ID: 0}})
+	list.Sort(itemLess)
+
+	check := func(step string, inMemory []int) {
+		t.Helper()
+		for i := range 6 {
+			if item, err := list.Get(i); err != nil || item.ID != i {
+				t.Errorf("%s: Get(%d): expected ID %d, got %v, err %v", step, i, i, item, err)
+			}
+		}
+		var ids []int
+		for _, item := range list.memoryData {
+			ids = append(ids, item.ID)
+		}
+		slices.Sort(ids)
+		if !slices.Equal(ids, inMemory) {
+			t.Errorf("%s: expected %v in memory, got %v", step, inMemory, ids)
+		}
+	}
+
+	// The first four added are in memory, and the last in sorted order are spilled first
+	if err := list.Resize(2); err != nil {
+		t.Fatalf("Failed to shrink: %v", err)
+	}
+	check("shrink", []int{1, 3})
+
+	// The first in sorted order that are on disk are promoted
+	if err := list.Resize(5); err != nil {
+		t.Fatalf("Failed to grow: %v", err)
+	}
+	check("grow", []int{0, 1, 2, 3, 4})
+	if stats := list.Stats(); stats.OnDisk != 1 {
+		t.Errorf("Expected one item left on disk, got %+v", stats)
+	}
+
+	if err := NewDBList[Item]("", 2).Resize(-1); err == nil {
+		t.Errorf("Expected an error for a negative maximum")
+	}
+	memoryOnly := NewDBList[Item]("", 2)
+	memoryOnly.Adds([]Item{{ID: 0}, {ID: 1}})
+	if err := memoryOnly.Resize(1); !errors.Is(err, ErrNoDiskPath) {
+		t.Errorf("Expected ErrNoDiskPath, got %v", err)
+	}
+}
+
+// TestDBList_ResizeCrash tests that items loaded into memory by growing the memory tier keep
+// their disk records, so they survive the list being reopened without Close.
+func TestDBList_ResizeCrash(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0)
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+	if err := list.Flush(); err != nil {
+		t.Fatalf("Failed to flush list: %v", err)
+	}
+	if err := list.Resize(3); err != nil {
+		t.Fatalf("Failed to grow: %v", err)
+	}
+
+	// The list is abandoned without Close, as after a crash
+	reopened, err := OpenDBList[Item](tempDir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if size := reopened.Size(); size != 3 {
+		t.Fatalf("Expected 3 items, got %d", size)
+	}
+	for i := range 3 {
+		if item, err := reopened.Get(i); err != nil || item.ID != i {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, i, item, err)
+		}
+	}
+}
+
+// TestInMemoryOnly tests that a memory-only list creates no files however many items it holds,
+// and that an explicit cap is enforced with ErrMemoryFull.
+func TestInMemoryOnly(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	list := NewDBList[Item](filepath.Join(dir, "list"), 5000, InMemoryOnly())
+	for i := range 5000 {
+		if err := list.Add(Item{ID: i}); err != nil {
+			t.Fatalf("Failed to add item %d: %v", i, err)
+		}
+	}
+	list.Sort(func(a, b Item) bool { return a.ID > b.ID })
+	if err := list.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if err := list.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if item, err := list.Get(0); err != nil || item.ID != 4999 {
+		t.Errorf("Expected ID 4999 first, got %v, err %v", item, err)
+	}
+	if err := os.WriteFile("0.json", []byte("{}"), 0o640); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := list.Delete(list.Size() - 1); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, err := os.Stat("0.json"); err != nil {
+		t.Errorf("Expected Delete to leave the working directory alone: %v", err)
+	}
+	os.Remove("0.json")
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Errorf("Expected no files to be created, got %v, err %v", entries, err)
+	}
+
+	// The cap applies whichever order the options are given in
+	for _, opts := range [][]Option{{InMemoryOnly(), WithMaxInMemory(3)}, {WithMaxInMemory(3), InMemoryOnly()}} {
+		capped, err := NewDBListWithOptions[Item](opts...)
+		if err != nil {
+			t.Fatalf("Failed to create list: %v", err)
+		}
+		if err := capped.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}}); err != nil {
+			t.Fatalf("Failed to add items: %v", err)
+		}
+		if err := capped.Add(Item{ID: 3}); !errors.Is(err, ErrMemoryFull) {
+			t.Errorf("Expected ErrMemoryFull, got %v", err)
+		}
+		if size := capped.Size(); size != 3 {
+			t.Errorf("Expected 3 items, got %d", size)
+		}
+	}
+	if err := NewDBList[Item]("", 1, InMemoryOnly()).Adds([]Item{{ID: 0}, {ID: 1}}); !errors.Is(err, ErrMemoryFull) {
+		t.Errorf("Expected NewDBList's maximum to cap the list, got %v", err)
+	}
+	unbounded, err := NewDBListWithOptions[Item](InMemoryOnly())
+	if err != nil {
+		t.Fatalf("Failed to create list: %v", err)
+	}
+	if unbounded.maxInMemory != math.MaxInt {
+		t.Errorf("Expected an unbounded list without a cap, got %d", unbounded.maxInMemory)
+	}
+
+	if _, err := NewDBListWithOptions[Item](InMemoryOnly(), WithPath(dir)); err == nil {
+		t.Errorf("Expected an error for InMemoryOnly with WithPath")
+	}
+}
+
+// TestDBList_DiskOnly tests that a maxInMemory of 0 writes every item to disk, that NewDBList
+// treats a negative one the same, and that a disk-only list without a path cannot take items.
+func TestDBList_DiskOnly(t *testing.T) {
+	for _, maxInMemory := range []int{0, -3} {
+		dir := t.TempDir()
+		list := NewDBList[Item](dir, maxInMemory)
+		if list.maxInMemory != 0 {
+			t.Errorf("maxInMemory %d: expected 0 in memory, got %d", maxInMemory, list.maxInMemory)
+		}
+		if err := list.Adds([]Item{{ID: 0}, {ID: 1}}); err != nil {
+			t.Fatalf("maxInMemory %d: failed to add: %v", maxInMemory, err)
+		}
+
+		if got := len(list.memoryData); got != 0 {
+			t.Errorf("maxInMemory %d: expected nothing in memory, got %d items", maxInMemory, got)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "0.json")); err != nil {
+			t.Errorf("maxInMemory %d: expected the first item on disk: %v", maxInMemory, err)
+		}
+		if item, err := list.Get(1); err != nil || item.ID != 1 {
+			t.Errorf("maxInMemory %d: Get(1): expected ID 1, got %v, err %v", maxInMemory, item, err)
+		}
+	}
+
+	if err := NewDBList[Item]("", 0).Add(Item{ID: 0}); !errors.Is(err, ErrNoDiskPath) {
+		t.Errorf("Expected ErrNoDiskPath without a path, got %v", err)
+	}
+}
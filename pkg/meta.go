@@ -0,0 +1,299 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// metaFileName is the name of the file holding a DBList's metadata within its disk path.
+const metaFileName = "meta.json"
+
+// ErrStorageMismatch is returned by OpenDBList when the options choose a different kind of
+// storage for the records than the one the list was saved with.
+var ErrStorageMismatch = errors.New("storage does not match")
+
+// The kinds of storage for the records of a list, as saved in its metadata.
+const (
+	// storageFiles is the default of a file per record, which may be packed into chunk files.
+	storageFiles = "files"
+	// storageDataFile is the single data file of WithAppendOnlyFile and WithMemoryMappedFile.
+	storageDataFile = "datafile"
+	// storageBackend is a Backend given by WithBackend.
+	storageBackend = "backend"
+)
+
+// listMetadata is the persisted state of a DBList, written to the metadata file by Flush.
+type listMetadata struct {
+	SortedIndexes []int          `json:"sortedIndexes"`
+	TotalCount    int            `json:"totalCount"`
+	NextIndex     int            `json:"nextIndex"`
+	IsSorted      bool           `json:"isSorted"`
+	Compression   Compression    `json:"compression,omitempty"`
+	Encrypted     bool           `json:"encrypted,omitempty"`
+	KeyCheck      []byte         `json:"keyCheck,omitempty"`
+	FileExtension string         `json:"fileExtension,omitempty"`
+	ZeroPadding   int            `json:"zeroPadding,omitempty"`
+	Checksum      bool           `json:"checksum,omitempty"`
+	RecordKinds   bool           `json:"recordKinds,omitempty"`
+	Storage       string         `json:"storage,omitempty"`
+	AddedAt       map[int]int64  `json:"addedAt,omitempty"`
+	DiskBytes     int64          `json:"diskBytes,omitempty"`
+	Keys          map[int]string `json:"keys,omitempty"`
+	TimesEpoch    uint64         `json:"timesEpoch,omitempty"`
+}
+
+// Flush persists the sort order and counters of the DBList to its metadata file,
+// along with any state held in memory by the disk storage.
+func (d *DBList[T]) Flush() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return err
+	}
+
+	return d.flush()
+}
+
+// flush does the work of Flush once any in-flight writes finish. The caller must hold the
+// write lock.
+func (d *DBList[T]) flush() error {
+	d.waitForWrites()
+
+	if err := d.disk.flush(); err != nil {
+		return err
+	}
+
+	if err := d.writeMetadata(); err != nil {
+		return err
+	}
+
+	// Everything but the items held in memory is now in the records on disk
+	return d.checkpoint()
+}
+
+// persistSortOrder saves a newly sorted order as Flush would, if WithPersistentSort was given.
+// The caller must hold the write lock.
+func (d *DBList[T]) persistSortOrder() error {
+	if !d.persistSort || d.diskPath == "" || d.readOnly || d.closed {
+		return nil
+	}
+
+	if err := d.flush(); err != nil {
+		return fmt.Errorf("failed to persist sort order: %w", err)
+	}
+
+	return nil
+}
+
+// WithPersistentSort makes Sort, SortUnstable and SortByKey save the new order to the metadata
+// file before they return, so a list reopened after a crash comes back sorted instead of needing
+// another sort. It costs a Flush per sort. Without it the order is saved by the next Flush or Close.
+func WithPersistentSort() Option {
+	return func(o *options) {
+		o.persistSort = true
+	}
+}
+
+// writeMetadata atomically writes the metadata file.
+func (d *DBList[T]) writeMetadata() error {
+	if d.diskPath == "" {
+		return nil
+	}
+
+	meta := listMetadata{
+		SortedIndexes: d.sortedIndexes,
+		TotalCount:    d.totalCount,
+		NextIndex:     d.nextIndex,
+		IsSorted:      d.isSorted,
+		Compression:   d.compression,
+		FileExtension: d.extension,
+		ZeroPadding:   d.zeroPadding,
+		Checksum:      d.checksum,
+		RecordKinds:   d.recordKinds,
+		Storage:       d.storage(),
+		AddedAt:       d.addedAt,
+		DiskBytes:     d.usage.bytes.Load(),
+	}
+	if d.keys != nil {
+		meta.Keys = d.keys.snapshot()
+	}
+	if d.times != nil {
+		meta.TimesEpoch = d.times.epoch + 1
+	}
+
+	if d.encryptionKey != nil {
+		keyCheck, err := encrypt(d.encryptionKey, keyCheckPlaintext)
+		if err != nil {
+			return err
+		}
+		meta.Encrypted = true
+		meta.KeyCheck = keyCheck
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(d.diskPath, d.dirMode); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(d.diskPath, metaFileName), data, d.fileMode, true); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	// The times stamped so far are in the metadata, so they start again under its epoch
+	if d.times != nil {
+		return d.times.reset(meta.TimesEpoch)
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes data to a temp file next to path and renames it into place,
+// so readers never observe a partially written file. If sync is true the data is also
+// flushed to stable storage before the rename, and the directory after it, so the new file
+// survives a power loss. A new file is created with perm.
+func writeFileAtomic(path string, data []byte, perm os.FileMode, sync bool) error {
+	tmpPath := path + ".tmp"
+
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if sync {
+		if err := syncFile(file); err != nil {
+			file.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if sync {
+		return syncDir(filepath.Dir(path))
+	}
+
+	return nil
+}
+
+// syncFile flushes a file to stable storage. It is a variable so tests can observe the syncs.
+var syncFile = (*os.File).Sync
+
+// syncDir flushes a directory to stable storage, so the entries created or renamed in it are
+// durable. Windows cannot sync a directory, and does not need to, so it is skipped there.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := syncFile(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// readMetadata loads the metadata file, returning nil if none has been written.
+func (d *DBList[T]) readMetadata() (*listMetadata, error) {
+	if d.diskPath == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(d.diskPath, metaFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	var meta listMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
+	}
+
+	return &meta, nil
+}
+
+// checkEncryptionKey verifies that the list was opened with the key its metadata was written with.
+func (d *DBList[T]) checkEncryptionKey(meta *listMetadata) error {
+	if !meta.Encrypted {
+		if d.encryptionKey != nil {
+			return fmt.Errorf("%w: list is not encrypted", ErrEncryptionKey)
+		}
+		return nil
+	}
+
+	if d.encryptionKey == nil {
+		return fmt.Errorf("%w: list is encrypted but no key was provided", ErrEncryptionKey)
+	}
+
+	if _, err := decrypt(d.encryptionKey, meta.KeyCheck); err != nil {
+		return fmt.Errorf("%w: %w", ErrEncryptionKey, err)
+	}
+
+	return nil
+}
+
+// storage returns the kind of storage the records of the list are kept in.
+func (d *DBList[T]) storage() string {
+	switch {
+	case d.backend != nil:
+		return storageBackend
+	case d.memoryMapped || d.appendOnly:
+		return storageDataFile
+	default:
+		return storageFiles
+	}
+}
+
+// checkStorage returns ErrStorageMismatch if the list was saved with another kind of storage
+// than it now has, whose records it would not find. Metadata saved before the kind was
+// recorded is not checked.
+func (d *DBList[T]) checkStorage(meta *listMetadata) error {
+	if meta.Storage == "" || meta.Storage == d.storage() {
+		return nil
+	}
+
+	return fmt.Errorf("%w: list was saved with %s storage, not %s", ErrStorageMismatch, meta.Storage, d.storage())
+}
+
+// removeMetadata deletes the metadata file if one exists.
+func (d *DBList[T]) removeMetadata() error {
+	if d.diskPath == "" {
+		return nil
+	}
+
+	err := os.Remove(filepath.Join(d.diskPath, metaFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete metadata: %w", err)
+	}
+
+	return nil
+}
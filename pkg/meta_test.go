@@ -0,0 +1,110 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestDBList_Flush tests that the sort order survives reopening the list.
+func TestDBList_Flush(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0) // keep everything on disk
+
+	list.Adds([]Item{{ID: 3}, {ID: 1}, {ID: 4}, {ID: 2}})
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+
+	if err := list.Flush(); err != nil {
+		t.Fatalf("Failed to flush list: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, metaFileName+".tmp")); !os.IsNotExist(err) {
+		t.Errorf("Expected temp metadata file to be gone, got err %v", err)
+	}
+
+	reopened, err := OpenDBList[Item](tempDir, 2)
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+
+	if got := reopened.Size(); got != 4 {
+		t.Fatalf("Expected size to be 4, got %d", got)
+	}
+	if !reopened.isSorted {
+		t.Errorf("Expected reopened list to be sorted")
+	}
+	for i := 0; i < 4; i++ {
+		if item, err := reopened.Get(i); err != nil || item.ID != i+1 {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, i+1, item, err)
+		}
+	}
+}
+
+// TestDBList_FlushThenAdd tests that items added after a flush are still reopened.
+func TestDBList_FlushThenAdd(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0)
+
+	list.Adds([]Item{{ID: 2}, {ID: 1}})
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+	if err := list.Flush(); err != nil {
+		t.Fatalf("Failed to flush list: %v", err)
+	}
+
+	list.Add(Item{ID: 0})
+
+	reopened, err := OpenDBList[Item](tempDir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+
+	expected := []int{1, 2, 0}
+	for i, want := range expected {
+		if item, err := reopened.Get(i); err != nil || item.ID != want {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, want, item, err)
+		}
+	}
+	if reopened.isSorted {
+		t.Errorf("Expected reopened list to be unsorted after unflushed adds")
+	}
+}
+
+// TestDBList_PersistentSort tests that a list opened after a sort without Flush or Close keeps
+// the sorted order and does not need sorting again.
+func TestDBList_PersistentSort(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0, WithPersistentSort())
+	list.Adds([]Item{{ID: 3}, {ID: 1}, {ID: 2}, {ID: 0}})
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+
+	reopened, err := OpenDBList[Item](tempDir, 0, WithPersistentSort())
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+
+	compared := 0
+	reopened.Sort(func(a, b Item) bool {
+		compared++
+		return a.ID < b.ID
+	})
+	if compared != 0 {
+		t.Errorf("Expected no comparisons after reopening a sorted list, got %d", compared)
+	}
+	for i := range 4 {
+		if item, err := reopened.Get(i); err != nil || item.ID != i {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, i, item, err)
+		}
+	}
+
+	// A later sort saves the order again, including the items added since
+	if err := reopened.Add(Item{ID: -1}); err != nil {
+		t.Fatalf("Failed to add: %v", err)
+	}
+	if err := SortByKey(reopened, func(item Item) int { return item.ID }); err != nil {
+		t.Fatalf("Failed to sort: %v", err)
+	}
+	if again, err := OpenDBList[Item](tempDir, 0); err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	} else if item, err := again.Get(0); err != nil || item.ID != -1 {
+		t.Errorf("Expected ID -1 first after SortByKey, got %v, err %v", item, err)
+	}
+}
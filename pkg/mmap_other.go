@@ -0,0 +1,23 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package util
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile reads the first size bytes of file where memory mapping is not supported.
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := file.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// munmapFile releases a buffer returned by mmapFile.
+func munmapFile([]byte) error {
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the first size bytes of file read-only.
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	mapped, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map data file: %w", err)
+	}
+
+	return mapped, nil
+}
+
+// munmapFile releases a mapping created by mmapFile.
+func munmapFile(mapped []byte) error {
+	return syscall.Munmap(mapped)
+}
@@ -0,0 +1,77 @@
+package util
+
+import "os"
+
+// mmapStore is an appendStore that serves reads from a memory mapping of the data file, so
+// reading a record is a copy out of the mapped region rather than a read syscall. Records are
+// written as by appendStore, and the mapping is extended when a read reaches past its end.
+type mmapStore struct {
+	*appendStore
+	mapped []byte
+}
+
+// newMmapStore creates an mmapStore keeping its files in dir, created with the given modes.
+func newMmapStore(dir string, dirMode, fileMode os.FileMode) *mmapStore {
+	return &mmapStore{appendStore: newAppendStore(dir, dirMode, fileMode)}
+}
+
+func (s *mmapStore) get(index int) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	loc, err := s.locate(index)
+	if err != nil {
+		return nil, err
+	}
+
+	if loc.Offset+loc.Length > int64(len(s.mapped)) {
+		if err := s.remap(); err != nil {
+			return nil, err
+		}
+	}
+
+	// The mapping is replaced as the file grows, so the caller gets its own copy
+	data := make([]byte, loc.Length)
+	copy(data, s.mapped[loc.Offset:loc.Offset+loc.Length])
+
+	return data, nil
+}
+
+func (s *mmapStore) close() error {
+	s.mutex.Lock()
+	err := s.unmap()
+	s.mutex.Unlock()
+
+	if closeErr := s.appendStore.close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// remap replaces the mapping with one covering every record written so far.
+func (s *mmapStore) remap() error {
+	if err := s.unmap(); err != nil {
+		return err
+	}
+
+	mapped, err := mmapFile(s.file, s.size)
+	if err != nil {
+		return err
+	}
+	s.mapped = mapped
+
+	return nil
+}
+
+// unmap releases the mapping, if any.
+func (s *mmapStore) unmap() error {
+	if s.mapped == nil {
+		return nil
+	}
+
+	err := munmapFile(s.mapped)
+	s.mapped = nil
+
+	return err
+}
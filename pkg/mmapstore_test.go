@@ -0,0 +1,84 @@
+package util
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// TestDBList_MemoryMappedFile tests reads through the mapping as the data file grows, and reopening the file.
+func TestDBList_MemoryMappedFile(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0, WithMemoryMappedFile())
+
+	// Reading between writes forces the mapping to be extended
+	for i := 0; i < 100; i++ {
+		list.Add(Item{ID: i})
+		if item, err := list.Get(i); err != nil || item.ID != i {
+			t.Fatalf("Get(%d): expected ID %d, got %v, err %v", i, i, item, err)
+		}
+	}
+
+	list.Update(10, Item{ID: 1000})
+	list.Delete(20)
+	if item, err := list.Get(10); err != nil || item.ID != 1000 {
+		t.Errorf("Expected updated ID 1000, got %v, err %v", item, err)
+	}
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close list: %v", err)
+	}
+
+	// The data file is shared with the append-only backend
+	reopened, err := OpenDBList[Item](tempDir, 0, WithAppendOnlyFile())
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if got := reopened.Size(); got != 99 {
+		t.Errorf("Expected size to be 99, got %d", got)
+	}
+	if item, err := reopened.Get(20); err != nil || item.ID != 21 {
+		t.Errorf("Expected ID 21, got %v, err %v", item, err)
+	}
+}
+
+// newRandomGetList creates a list of records items kept on disk with the given backend options.
+func newRandomGetList(b *testing.B, records int, opts ...Option) *DBList[Item] {
+	b.Helper()
+	list := NewDBList[Item](b.TempDir(), 0, opts...)
+	items := make([]Item, records)
+	for i := range items {
+		items[i] = Item{ID: i}
+	}
+	if err := list.AddsParallel(items, 0); err != nil {
+		b.Fatalf("Failed to add items: %v", err)
+	}
+	return list
+}
+
+func BenchmarkDBList_RandomGet(b *testing.B) {
+	records := 1_000_000
+	if testing.Short() {
+		records = 10_000
+	}
+
+	for _, backend := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "files"},
+		{name: "mmap", opts: []Option{WithMemoryMappedFile()}},
+	} {
+		// Building the list once keeps it out of every round b.Run makes to size b.N
+		list := newRandomGetList(b, records, backend.opts...)
+
+		b.Run(fmt.Sprintf("%s/records=%d", backend.name, records), func(b *testing.B) {
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < b.N; i++ {
+				if _, err := list.Get(r.Intn(records)); err != nil {
+					b.Fatalf("Failed to get item: %v", err)
+				}
+			}
+		})
+		list.Close()
+	}
+}
@@ -0,0 +1,328 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Option configures optional behavior of a DBList at construction.
+type Option func(*options)
+
+// defaultMaxInMemory is the number of items kept in memory when WithMaxInMemory is not given.
+const defaultMaxInMemory = 1000
+
+// options holds the settings applied by Option functions.
+type options struct {
+	path          string
+	maxItems      int
+	maxItemsSet   bool
+	memoryOnly    bool
+	codec         Codec
+	appendOnly    bool
+	memoryMapped  bool
+	writeBuffer   int
+	compression   Compression
+	logger        *slog.Logger
+	encryptionKey []byte
+	memoryBudget  int64
+	extension     string
+	zeroPadding   int
+	pathMapper    PathMapper
+	backend       Backend
+	maxOpenFiles  int
+	checksum      bool
+	recordKinds   bool
+	promote       bool
+	writeAheadLog bool
+	persistSort   bool
+	ephemeral     bool
+	onSpill       any
+	factories     any
+	keyFunc       any
+	memoryPolicy  MemoryPolicy
+	flushInterval time.Duration
+	syncOnWrite   bool
+	ttl           time.Duration
+	ttlSkipOnRead bool
+	now           func() time.Time
+	dirMode       os.FileMode
+	fileMode      os.FileMode
+}
+
+// defaultOptions returns the settings used when no Option overrides them.
+func defaultOptions() options {
+	return options{
+		maxItems: defaultMaxInMemory,
+		codec:    JSONCodec{},
+		logger:   slog.Default(),
+		now:      time.Now,
+		dirMode:  0o750,
+		fileMode: 0o640,
+	}
+}
+
+// resolveOptions applies opts over the default options. Settings that depend on each other
+// are resolved once every option is applied, so the order of opts does not matter.
+func resolveOptions(opts []Option) options {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.memoryOnly && !o.maxItemsSet {
+		o.maxItems = math.MaxInt
+	}
+	return o
+}
+
+// validate returns an error if the options cannot be used to create a DBList.
+func (o options) validate() error {
+	if o.codec == nil {
+		return errors.New("codec must not be nil")
+	}
+	if o.logger == nil {
+		return errors.New("logger must not be nil")
+	}
+	if o.encryptionKey != nil {
+		if _, err := newGCM(o.encryptionKey); err != nil {
+			return err
+		}
+	}
+	if o.memoryOnly && o.path != "" {
+		return errors.New("InMemoryOnly cannot be combined with WithPath")
+	}
+	if o.memoryOnly && o.backend != nil {
+		return errors.New("InMemoryOnly cannot be combined with WithBackend")
+	}
+	if o.maxItems < 0 {
+		return fmt.Errorf("invalid maximum in memory %d", o.maxItems)
+	}
+	if o.maxOpenFiles < 0 {
+		return fmt.Errorf("invalid maximum open files %d", o.maxOpenFiles)
+	}
+	if o.zeroPadding < 0 {
+		return fmt.Errorf("invalid zero padding %d", o.zeroPadding)
+	}
+	return nil
+}
+
+// validateTyped returns an error if an option tied to the element type was given for a type
+// other than T, which would otherwise be ignored.
+func validateTyped[T any](o options) error {
+	if _, ok := o.onSpill.(func(T)); o.onSpill != nil && !ok {
+		return fmt.Errorf("WithOnSpill callback is a %T, not a func(%s)", o.onSpill, typeName[T]())
+	}
+	if _, ok := o.keyFunc.(func(T) string); o.keyFunc != nil && !ok {
+		return fmt.Errorf("WithKeyFunc function is a %T, not a func(%s) string", o.keyFunc, typeName[T]())
+	}
+	if o.keyFunc != nil && o.writeAheadLog {
+		return errors.New("WithKeyFunc cannot be combined with WithWriteAheadLog")
+	}
+	if o.factories != nil {
+		factories, ok := o.factories.([]func() T)
+		if !ok {
+			return fmt.Errorf("WithTypes factories are %T, not []func() %s", o.factories, typeName[T]())
+		}
+		if _, err := newTypeRegistry(factories); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// typeName returns the name of T for error messages.
+func typeName[T any]() string {
+	return reflect.TypeFor[T]().String()
+}
+
+// WithPath sets the directory holding the items that overflow to disk, along with the metadata.
+func WithPath(path string) Option {
+	return func(o *options) {
+		o.path = path
+	}
+}
+
+// WithMaxInMemory sets the maximum number of items kept in memory before overflowing to disk.
+// Zero keeps nothing in memory, so every item goes to disk from the first; a negative maximum
+// is invalid.
+func WithMaxInMemory(maxInMemory int) Option {
+	return func(o *options) {
+		o.maxItems = maxInMemory
+		o.maxItemsSet = true
+	}
+}
+
+// WithCodec sets the Codec used to serialize items stored on disk.
+func WithCodec(codec Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// WithAppendOnlyFile stores overflowed items as records appended to a single data file,
+// instead of the default of one file per item. The kind of storage is saved with the metadata,
+// so OpenDBList must be given this option, or WithMemoryMappedFile, to reopen the list.
+func WithAppendOnlyFile() Option {
+	return func(o *options) {
+		o.appendOnly = true
+	}
+}
+
+// WithMemoryMappedFile stores overflowed items in a single data file like WithAppendOnlyFile,
+// but reads them through a memory mapping of the file, avoiding a syscall per read. A list
+// created with either option can be opened with the other.
+func WithMemoryMappedFile() Option {
+	return func(o *options) {
+		o.memoryMapped = true
+	}
+}
+
+// WithWriteBuffer buffers up to records serialized items in memory before writing them to
+// disk in the background. Buffered items remain readable and are written out by Flush.
+func WithWriteBuffer(records int) Option {
+	return func(o *options) {
+		o.writeBuffer = records
+	}
+}
+
+// WithSyncOnWrite flushes each record to stable storage before the write that created it
+// returns, so an item Add has stored on disk survives a power loss. With the default file per
+// record the directory is synced too. It costs a sync per record, so it is off by default.
+// Items held in memory or by WithWriteBuffer are only as durable as the next Flush.
+func WithSyncOnWrite(enabled bool) Option {
+	return func(o *options) {
+		o.syncOnWrite = enabled
+	}
+}
+
+// WithFlushInterval also writes the items held by WithWriteBuffer out to disk every interval,
+// bounding how long a buffered item can go unwritten when the buffer is slow to fill. The
+// background writer stops when the list is closed. It has no effect without WithWriteBuffer,
+// and does not write the metadata, which still needs Flush or Close.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.flushInterval = interval
+	}
+}
+
+// WithMaxOpenFiles keeps up to n of the chunk files written by CompactToChunks open between
+// reads, closing the least recently used one to open another, so random reads across many
+// chunks neither reopen a file each time nor run out of file descriptors. By default each
+// read opens and closes its chunk. The single data file of WithAppendOnlyFile and
+// WithMemoryMappedFile is always held open, as one handle. Close closes them all.
+func WithMaxOpenFiles(n int) Option {
+	return func(o *options) {
+		o.maxOpenFiles = n
+	}
+}
+
+// WithCompression compresses items stored on disk. Items held in memory are not compressed.
+func WithCompression(compression Compression) Option {
+	return func(o *options) {
+		o.compression = compression
+	}
+}
+
+// WithLogger sets the logger used to report errors that cannot be returned, such as items
+// skipped by Iterator. By default the slog default logger is used.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithEncryption encrypts items stored on disk with AES-GCM using key, which must be 16, 24
+// or 32 bytes long. Items held in memory are not encrypted. The key itself is never stored.
+func WithEncryption(key []byte) Option {
+	return func(o *options) {
+		o.encryptionKey = key
+	}
+}
+
+// WithMemoryBudgetBytes limits the memory tier by the estimated serialized size of its items
+// rather than their count: items spill to disk once keeping them in memory would take the
+// total over bytes. The maxInMemory count is ignored when a budget is set.
+func WithMemoryBudgetBytes(bytes int64) Option {
+	return func(o *options) {
+		o.memoryBudget = bytes
+	}
+}
+
+// WithFileExtension sets the extension of the files holding items stored on disk, in place
+// of the default of ".json", or ".json.gz" with compression. A leading dot is added if missing.
+func WithFileExtension(ext string) Option {
+	return func(o *options) {
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		o.extension = ext
+	}
+}
+
+// WithZeroPadding pads the index in the names of the files holding items stored on disk with
+// leading zeros to at least width digits, so the names sort lexically in index order.
+func WithZeroPadding(width int) Option {
+	return func(o *options) {
+		o.zeroPadding = width
+	}
+}
+
+// WithChecksum stores a CRC32 with each item written to disk and verifies it when the item is
+// read back, so a damaged record is reported as ErrChecksumMismatch rather than decoded.
+func WithChecksum() Option {
+	return func(o *options) {
+		o.checksum = true
+	}
+}
+
+// WithDirMode sets the permissions of the directories created for the disk tier. The default
+// is 0750. As with os.MkdirAll, existing directories are left as they are.
+func WithDirMode(mode os.FileMode) Option {
+	return func(o *options) {
+		o.dirMode = mode
+	}
+}
+
+// WithFileMode sets the permissions of the files created for the disk tier and its metadata.
+// The default is 0640.
+func WithFileMode(mode os.FileMode) Option {
+	return func(o *options) {
+		o.fileMode = mode
+	}
+}
+
+// WithPromoteOnDelete refills the memory tier when an item held in memory is deleted, by
+// moving the first item in sorted order that is stored on disk into memory. Its record is
+// kept, so it survives a crash before Close. This costs a disk read on such deletes.
+func WithPromoteOnDelete() Option {
+	return func(o *options) {
+		o.promote = true
+	}
+}
+
+// WithOnSpill registers a callback for each item that is written to disk when it is added
+// because the memory tier is full, for example to release resources held by the in-memory
+// value. Items stored in memory and items moved to disk later, such as by Close, are not
+// reported. It is called once the list's lock is released, in the goroutine that added the
+// item, so it may call the list's methods.
+// T must be the list's element type; NewDBListWithOptions reports an error otherwise.
+func WithOnSpill[T any](f func(T)) Option {
+	return func(o *options) {
+		o.onSpill = f
+	}
+}
+
+// WithEphemeralStorage makes Close delete the disk tier instead of persisting it, for lists
+// whose data is not needed afterwards. Only directories the list creates are removed: the
+// outermost directory of the path that did not exist when the list was created is deleted
+// with everything in it. A list whose path already existed is closed as usual.
+func WithEphemeralStorage(enabled bool) Option {
+	return func(o *options) {
+		o.ephemeral = enabled
+	}
+}
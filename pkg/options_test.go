@@ -0,0 +1,281 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestDBList_WithLogger tests that iteration errors are reported to the injected logger.
+func TestDBList_WithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	list := NewDBList[Item](t.TempDir(), 0, WithLogger(logger))
+	list.Adds([]Item{{ID: 1}, {ID: 2}})
+
+	filePath, _ := list.filePathForIndex(0, false)
+	if err := os.Remove(filePath); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+
+	count := 0
+	for range list.Iterator(context.Background()) {
+		count++
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 item to be iterated, got %d", count)
+	}
+
+	if output := buf.String(); !strings.Contains(output, "DBList failed to load index 0") {
+		t.Errorf("Expected injected logger to receive the error, got %q", output)
+	}
+}
+
+// TestDBList_FileNaming tests custom file extensions and zero padding, and that reopening uses the saved scheme.
+func TestDBList_FileNaming(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0, WithFileExtension("dat"), WithZeroPadding(10))
+
+	filePath, err := list.filePathForIndex(42, false)
+	if err != nil {
+		t.Fatalf("Failed to generate path: %v", err)
+	}
+	if expected := filepath.Join(tempDir, "0000000042.dat"); filePath != expected {
+		t.Errorf("Expected path %q, got %q", expected, filePath)
+	}
+
+	list.Adds([]Item{{ID: 1}, {ID: 2}})
+	if _, err := os.Stat(filepath.Join(tempDir, "0000000001.dat")); err != nil {
+		t.Errorf("Expected padded file to exist: %v", err)
+	}
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close list: %v", err)
+	}
+
+	// Files from another scheme are not mistaken for items
+	if err := os.WriteFile(filepath.Join(tempDir, "2.dat"), []byte(`{"ID":3}`), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// The scheme comes from the metadata, not the options passed to OpenDBList
+	reopened, err := OpenDBList[Item](tempDir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if got := reopened.Size(); got != 2 {
+		t.Fatalf("Expected size to be 2, got %d", got)
+	}
+	if item, err := reopened.Get(1); err != nil || item.ID != 2 {
+		t.Errorf("Expected ID 2, got %v, err %v", item, err)
+	}
+
+	if _, ok := reopened.indexForFileName("0000000007.dat"); !ok {
+		t.Errorf("Expected padded name to be parsed")
+	}
+	if _, ok := reopened.indexForFileName("7.dat"); ok {
+		t.Errorf("Expected unpadded name to be rejected")
+	}
+}
+
+// TestNewDBListWithOptions tests combining options, the defaults for omitted ones, and rejecting invalid ones.
+func TestNewDBListWithOptions(t *testing.T) {
+	list, err := NewDBListWithOptions[Item]()
+	if err != nil {
+		t.Fatalf("Failed to create list: %v", err)
+	}
+	if list.diskPath != "" || list.maxInMemory != defaultMaxInMemory {
+		t.Errorf("Expected no path and %d in memory, got %q and %d", defaultMaxInMemory, list.diskPath, list.maxInMemory)
+	}
+	if _, ok := list.codec.(JSONCodec); !ok {
+		t.Errorf("Expected the JSON codec by default, got %T", list.codec)
+	}
+
+	tempDir := t.TempDir()
+	list, err = NewDBListWithOptions[Item](
+		WithPath(tempDir),
+		WithMaxInMemory(1),
+		WithCompression(Gzip),
+		WithChecksum(),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create list: %v", err)
+	}
+	list.Adds([]Item{{ID: 1}, {ID: 2}})
+	if _, err := os.Stat(filepath.Join(tempDir, "1.json.gz")); err != nil {
+		t.Errorf("Expected compressed file for the overflowed item: %v", err)
+	}
+	if item, err := list.Get(1); err != nil || item.ID != 2 {
+		t.Errorf("Expected ID 2, got %v, err %v", item, err)
+	}
+
+	list, err = NewDBListWithOptions[Item](WithPath(t.TempDir()), WithMaxInMemory(0), WithAppendOnlyFile(), WithWriteBuffer(4))
+	if err != nil {
+		t.Fatalf("Failed to create list: %v", err)
+	}
+	list.Add(Item{ID: 1})
+	if item, err := list.Get(0); err != nil || item.ID != 1 {
+		t.Errorf("Expected ID 1, got %v, err %v", item, err)
+	}
+
+	invalid := map[string][]Option{
+		"key":     {WithEncryption([]byte("short"))},
+		"codec":   {WithCodec(nil)},
+		"logger":  {WithLogger(nil)},
+		"padding": {WithZeroPadding(-1)},
+		"memory":  {WithMaxInMemory(-1)},
+		"files":   {WithMaxOpenFiles(-1)},
+	}
+	for name, opts := range invalid {
+		if _, err := NewDBListWithOptions[Item](opts...); err == nil {
+			t.Errorf("Expected error for invalid %s", name)
+		}
+	}
+}
+
+// TestDBList_DirAndFileMode tests the permissions of the created directories and files, by default and when set.
+func TestDBList_DirAndFileMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		dirMode  os.FileMode
+		fileMode os.FileMode
+	}{
+		{name: "default", dirMode: 0o750, fileMode: 0o640},
+		{name: "custom", opts: []Option{WithDirMode(0o700), WithFileMode(0o600)}, dirMode: 0o700, fileMode: 0o600},
+		{name: "append", opts: []Option{WithAppendOnlyFile(), WithDirMode(0o700), WithFileMode(0o600)}, dirMode: 0o700, fileMode: 0o600},
+	}
+
+	for _, tt := range tests {
+		dir := filepath.Join(t.TempDir(), "list")
+		list := NewDBList[Item](dir, 0, tt.opts...)
+		list.Add(Item{ID: 1})
+		if err := list.Close(); err != nil {
+			t.Fatalf("%s: failed to close list: %v", tt.name, err)
+		}
+
+		info, err := os.Stat(dir)
+		if err != nil {
+			t.Fatalf("%s: failed to stat directory: %v", tt.name, err)
+		}
+		if got := info.Mode().Perm(); got != tt.dirMode {
+			t.Errorf("%s: expected directory mode %v, got %v", tt.name, tt.dirMode, got)
+		}
+
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				t.Fatalf("%s: failed to stat %s: %v", tt.name, entry.Name(), err)
+			}
+			if got := info.Mode().Perm(); got != tt.fileMode {
+				t.Errorf("%s: expected mode %v for %s, got %v", tt.name, tt.fileMode, entry.Name(), got)
+			}
+		}
+	}
+}
+
+// TestWithEphemeralStorage tests that Close removes the directories the list created, and only those.
+func TestWithEphemeralStorage(t *testing.T) {
+	base := t.TempDir()
+	path := filepath.Join(base, "scratch", "list")
+
+	list := NewDBList[Item](path, 1, WithEphemeralStorage(true))
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+	if err := list.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(base, "scratch")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the created directories to be removed, got %v", err)
+	}
+
+	// A directory that already existed may be shared, so it is kept
+	shared := NewDBList[Item](base, 1, WithEphemeralStorage(true))
+	shared.Adds([]Item{{ID: 0}, {ID: 1}})
+	if err := shared.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(base, metaFileName)); err != nil {
+		t.Errorf("Expected the existing directory to be kept, got %v", err)
+	}
+}
+
+// TestWithOnSpill tests that the callback sees exactly the items added past the memory threshold.
+func TestWithOnSpill(t *testing.T) {
+	var spilled []int
+	list := NewDBList[Item](t.TempDir(), 2, WithOnSpill(func(item Item) {
+		spilled = append(spilled, item.ID)
+	}))
+
+	list.Adds([]Item{{ID: 0}, {ID: 1}})
+	if len(spilled) != 0 {
+		t.Errorf("Expected no spills below the threshold, got %v", spilled)
+	}
+	list.Adds([]Item{{ID: 2}, {ID: 3}})
+	if err := list.AddsParallel([]Item{{ID: 4}, {ID: 5}}, 2); err != nil {
+		t.Fatalf("Failed to add in parallel: %v", err)
+	}
+	if expected := []int{2, 3, 4, 5}; !slices.Equal(spilled, expected) {
+		t.Errorf("Expected spills %v, got %v", expected, spilled)
+	}
+
+	if _, err := NewDBListWithOptions[Item](WithOnSpill(func(string) {})); err == nil {
+		t.Errorf("Expected an error for a callback of the wrong type")
+	}
+}
+
+// TestWithOnSpillUsesList tests that the callback is called after the lock is released by every
+// way of adding, so it can read the list, which sees the spilled item.
+func TestWithOnSpillUsesList(t *testing.T) {
+	var list *DBList[Item]
+	var sizes []int
+	list = NewDBList[Item](t.TempDir(), 1, WithItemMeta(), WithOnSpill(func(item Item) {
+		sizes = append(sizes, list.Size())
+	}))
+	less := func(a, b Item) bool { return a.ID < b.ID }
+
+	adds := map[string]func() error{
+		"Add":          func() error { return list.Add(Item{ID: 1}) },
+		"AddsParallel": func() error { return list.AddsParallel([]Item{{ID: 2}}, 1) },
+		"AddWithMeta":  func() error { return list.AddWithMeta(Item{ID: 3}, map[string]string{"k": "v"}) },
+		"InsertSorted": func() error { list.Sort(less); return list.InsertSorted(Item{ID: 4}, less) },
+		"MergeSorted":  func() error { list.Sort(less); return list.MergeSorted([]Item{{ID: 5}}, less) },
+		"GetOrAdd": func() error {
+			_, _, err := list.GetOrAdd(func(item Item) string { return strconv.Itoa(item.ID) }, Item{ID: 6})
+			return err
+		},
+		"ReplaceAll": func() error { return list.ReplaceAll([]Item{{ID: 0}, {ID: 1}}) },
+	}
+	list.Add(Item{ID: 0})
+	for name, add := range adds {
+		sizes = nil
+		if err := add(); err != nil {
+			t.Fatalf("%s: failed to add: %v", name, err)
+		}
+		if len(sizes) != 1 || sizes[0] != list.Size() {
+			t.Errorf("%s: expected one call seeing size %d, got %v", name, list.Size(), sizes)
+		}
+	}
+
+	var keyed *DBList[keyedItem]
+	calls := 0
+	keyed = NewDBList[keyedItem](t.TempDir(), 0, WithKeyFunc(keyedName), WithOnSpill(func(keyedItem) {
+		keyed.Size()
+		calls++
+	}))
+	keyed.Adds([]keyedItem{{"a", 1}, {"b", 2}})
+	keyed.Add(keyedItem{"c", 3})
+	if calls != 3 {
+		t.Errorf("Expected 3 calls for keyed adds, got %d", calls)
+	}
+}
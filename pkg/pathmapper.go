@@ -0,0 +1,97 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// PathMapper decides where the default file per record store keeps the record for each physical
+// index, for layouts such as bucketing records into subdirectories.
+type PathMapper interface {
+	// PathFor returns the path of the record for index, relative to the disk path of the list
+	// and using slashes as separators. It must be a local path, and different for every index.
+	PathFor(index int) string
+}
+
+// PathParser may be implemented by a PathMapper to turn a path that PathFor returned back into
+// its index. OpenDBList then finds every record under the disk path; with a PathMapper alone it
+// only looks for the indexes up to the last one saved in the metadata, so records written after
+// the last Flush or Close are not found.
+type PathParser interface {
+	// IndexFor returns the index whose record is at path, relative to the disk path of the list
+	// and using slashes as separators, reporting false for a file that is not a record.
+	IndexFor(path string) (int, bool)
+}
+
+// mappedPath returns the path of the record for index under the disk path given by the
+// PathMapper of the list.
+func (d *DBList[T]) mappedPath(index int) (string, error) {
+	rel := filepath.FromSlash(d.pathMapper.PathFor(index))
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("path %q for index %d is not within the disk path", rel, index)
+	}
+
+	return filepath.Join(d.diskPath, rel), nil
+}
+
+// mappedIndexes lists the indexes of the records under the disk path in ascending order, for a
+// list with a PathMapper.
+func (d *DBList[T]) mappedIndexes() ([]int, error) {
+	parser, ok := d.pathMapper.(PathParser)
+	if !ok {
+		var found []int
+		for index := range d.nextIndex {
+			filePath, err := d.mappedPath(index)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := os.Stat(filePath); err == nil {
+				found = append(found, index)
+			}
+		}
+		return found, nil
+	}
+
+	var found []int
+	err := filepath.WalkDir(d.diskPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(d.diskPath, path)
+		if err != nil {
+			return err
+		}
+		if index, ok := parser.IndexFor(filepath.ToSlash(rel)); ok {
+			found = append(found, index)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	sort.Ints(found)
+
+	return found, nil
+}
+
+// WithPathMapper lays out the records of the default file per record store as mapper decides,
+// in place of <index>.json in the disk path. WithZeroPadding, WithFileExtension and the names
+// given by WithKeyFunc do not apply. The metadata, the write-ahead log and the chunks written by
+// CompactToChunks stay in the disk path itself, so mapper must not use their names. A list must
+// be reopened with an equivalent mapper.
+func WithPathMapper(mapper PathMapper) Option {
+	return func(o *options) {
+		o.pathMapper = mapper
+	}
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// bucketMapper zero-pads each index and buckets the records by thousands.
+type bucketMapper struct{}
+
+func (bucketMapper) PathFor(index int) string {
+	return fmt.Sprintf("%03d/%06d.json", index/1000, index)
+}
+
+func (bucketMapper) IndexFor(path string) (int, bool) {
+	var bucket, index int
+	if _, err := fmt.Sscanf(path, "%03d/%06d.json", &bucket, &index); err != nil || bucket != index/1000 {
+		return 0, false
+	}
+	return index, true
+}
+
+// bucketPaths lays out records like bucketMapper but cannot parse them back.
+type bucketPaths struct{}
+
+func (bucketPaths) PathFor(index int) string {
+	return bucketMapper{}.PathFor(index)
+}
+
+// TestDBList_WithPathMapper tests that records are stored, read, deleted and found again at the
+// paths a PathMapper gives.
+func TestDBList_WithPathMapper(t *testing.T) {
+	dir := t.TempDir()
+	list := NewDBList[Item](dir, 0, WithPathMapper(bucketMapper{}))
+	for i := range 1003 {
+		if err := list.Add(Item{ID: i}); err != nil {
+			t.Fatalf("Failed to add item %d: %v", i, err)
+		}
+	}
+
+	for _, rel := range []string{"000/000007.json", "001/001002.json"} {
+		if _, err := os.Stat(filepath.Join(dir, rel)); err != nil {
+			t.Errorf("Expected a record at %s: %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "7.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected no record at the default path, got %v", err)
+	}
+	if item, err := list.Get(1001); err != nil || item.ID != 1001 {
+		t.Errorf("Get(1001): expected ID 1001, got %v, err %v", item, err)
+	}
+
+	if err := list.Delete(1001); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "001", "001001.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected the deleted record to be removed, got %v", err)
+	}
+
+	// Every record is found by parsing the paths, without any metadata
+	reopened, err := OpenDBList[Item](dir, 0, WithPathMapper(bucketMapper{}))
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if size := reopened.Size(); size != 1002 {
+		t.Fatalf("Expected 1002 items, got %d", size)
+	}
+	if item, err := reopened.Get(1001); err != nil || item.ID != 1002 {
+		t.Errorf("Get(1001): expected ID 1002, got %v, err %v", item, err)
+	}
+
+	// Without a parser only the indexes the metadata knows of are looked for
+	if err := reopened.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	reopened.Add(Item{ID: 1003})
+	unparsed, err := OpenDBList[Item](dir, 0, WithPathMapper(bucketPaths{}))
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if size := unparsed.Size(); size != 1002 {
+		t.Errorf("Expected the 1002 items in the metadata, got %d", size)
+	}
+}
@@ -0,0 +1,215 @@
+package util
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// IndexOf returns the sorted index of the first item for which eq(item, target) is true.
+// It scans the list in sorted order, reading disk items as it goes, so it is O(n) and a
+// large disk-backed list incurs one disk read per item examined. An item that cannot be
+// loaded stops the scan with its error, so a corrupt record is not mistaken for a miss.
+func (d *DBList[T]) IndexOf(target T, eq func(a, b T) bool) (int, bool, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if d.closed {
+		return -1, false, ErrClosed
+	}
+
+	for i, index := range d.sortedIndexes {
+		item, err := d.getFromStorage(index)
+		if err != nil {
+			return -1, false, fmt.Errorf("failed to load index %d: %w", i, err)
+		}
+		if eq(item, target) {
+			return i, true, nil
+		}
+	}
+
+	return -1, false, nil
+}
+
+// Contains reports whether the list holds an item for which eq(item, target) is true.
+// Like IndexOf, it is O(n) and fails on an item that cannot be loaded.
+func (d *DBList[T]) Contains(target T, eq func(a, b T) bool) (bool, error) {
+	_, found, err := d.IndexOf(target, eq)
+	return found, err
+}
+
+// BinarySearch finds the sorted index of target in a list sorted by Sort with the same less,
+// reading only O(log n) items. If target is not present, pos is the index at which it would
+// be inserted to keep the order. If the list is not currently sorted, it falls back to a
+// linear scan for an item equal to target, returning -1 if there is none like IndexOf, and
+// like IndexOf fails on an item the scan cannot load. In a sorted list, as in Sort, an item
+// that cannot be loaded is compared as the zero value.
+func (d *DBList[T]) BinarySearch(target T, less func(a, b T) bool) (pos int, found bool, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if d.closed {
+		return -1, false, ErrClosed
+	}
+
+	if !d.isSorted {
+		for i, index := range d.sortedIndexes {
+			item, err := d.getFromStorage(index)
+			if err != nil {
+				return -1, false, fmt.Errorf("failed to load index %d: %w", i, err)
+			}
+			if !less(item, target) && !less(target, item) {
+				return i, true, nil
+			}
+		}
+		return -1, false, nil
+	}
+
+	pos, found = d.search(target, less)
+	return pos, found, nil
+}
+
+// search binary-searches the sorted order for target. The caller must hold the lock.
+func (d *DBList[T]) search(target T, less func(a, b T) bool) (int, bool) {
+	pos := sort.Search(len(d.sortedIndexes), func(i int) bool {
+		item, _ := d.getFromStorage(d.sortedIndexes[i])
+		return !less(item, target)
+	})
+
+	if pos < len(d.sortedIndexes) {
+		item, _ := d.getFromStorage(d.sortedIndexes[pos])
+		return pos, !less(target, item)
+	}
+
+	return pos, false
+}
+
+// InsertSorted adds item to a list sorted by Sort with the same less, placing it after any
+// equal items so the list stays sorted without being re-sorted. The item is stored in memory
+// or on disk as by Add. It returns ErrNotSorted if the list is not currently sorted.
+func (d *DBList[T]) InsertSorted(item T, less func(a, b T) bool) error {
+	if err := d.checkUnkeyed("InsertSorted"); err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return err
+	}
+	if !d.isSorted {
+		return ErrNotSorted
+	}
+
+	pos := sort.Search(len(d.sortedIndexes), func(i int) bool {
+		other, _ := d.getFromStorage(d.sortedIndexes[i])
+		return less(item, other)
+	})
+
+	index := d.nextIndex
+	if err := d.storeAt(index, item); err != nil {
+		return err
+	}
+
+	d.stamp(index)
+	d.sortedIndexes = slices.Insert(d.sortedIndexes, pos, index)
+	d.generation++
+	d.totalCount++
+	d.nextIndex++
+
+	return nil
+}
+
+// MergeSorted adds items, which must already be sorted by less, to a list sorted by Sort with
+// the same less. The items are stored as by Add and then merged into the existing order in a
+// single O(n+m) pass, each placed after any equal items already in the list, so the list stays
+// sorted. It returns ErrNotSorted if the list is not currently sorted, and an error if items
+// are not sorted. If storing any item fails, none of them are added.
+func (d *DBList[T]) MergeSorted(items []T, less func(a, b T) bool) error {
+	if err := d.checkUnkeyed("MergeSorted"); err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return err
+	}
+	if !d.isSorted {
+		return ErrNotSorted
+	}
+	for i := 1; i < len(items); i++ {
+		if less(items[i], items[i-1]) {
+			return fmt.Errorf("items to merge are not sorted at index %d", i)
+		}
+	}
+
+	base := d.nextIndex
+	for i, item := range items {
+		if err := d.storeAt(base+i, item); err != nil {
+			for j := range i {
+				d.logDelete(base + j)
+				d.deleteFromStorage(base + j)
+			}
+			d.spills = nil
+			return err
+		}
+	}
+
+	// Each existing item is read once, however many new items are compared with it
+	merged := make([]int, 0, len(d.sortedIndexes)+len(items))
+	existing := d.sortedIndexes
+	var head T
+	if len(existing) > 0 {
+		head, _ = d.getFromStorage(existing[0])
+	}
+	for i, item := range items {
+		for len(existing) > 0 && !less(item, head) {
+			merged = append(merged, existing[0])
+			existing = existing[1:]
+			if len(existing) > 0 {
+				head, _ = d.getFromStorage(existing[0])
+			}
+		}
+		merged = append(merged, base+i)
+		d.stamp(base + i)
+	}
+	d.sortedIndexes = append(merged, existing...)
+
+	d.generation++
+	d.totalCount += len(items)
+	d.nextIndex += len(items)
+
+	return nil
+}
+
+// storeAt stores item at physical index, in memory if there is room and otherwise on disk.
+// The caller must hold the write lock and publish the index in the sort order.
+func (d *DBList[T]) storeAt(index int, item T) error {
+	if d.reserveMemory(item) {
+		if err := d.logMemoryPut(index, item, nil); err != nil {
+			d.releaseMemory(item)
+			return err
+		}
+		d.memoryData[index] = item
+		d.indexLookup(index, item)
+		return nil
+	}
+
+	if !d.hasDisk() {
+		return d.errNoDisk()
+	}
+	data, err := d.encode(item)
+	if err != nil {
+		return err
+	}
+	if err := d.putLogged(index, data); err != nil {
+		return err
+	}
+
+	d.indexLookup(index, item)
+	d.spilled(item)
+	return nil
+}
@@ -0,0 +1,176 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func itemsEqual(a, b Item) bool {
+	return a.ID == b.ID
+}
+
+// TestDBList_IndexOf tests finding items in memory, on disk, and not at all.
+func TestDBList_IndexOf(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 5}, {ID: 3}, {ID: 4}, {ID: 1}, {ID: 2}})
+	list.Sort(func(a, b Item) bool { return a.ID < b.ID })
+
+	// ID 3 is in memory and ID 2 is on disk
+	for _, id := range []int{3, 2} {
+		if pos, found, err := list.IndexOf(Item{ID: id}, itemsEqual); err != nil || !found || pos != id-1 {
+			t.Errorf("IndexOf(%d): expected position %d, got %d, found %v, err %v", id, id-1, pos, found, err)
+		}
+		if found, err := list.Contains(Item{ID: id}, itemsEqual); err != nil || !found {
+			t.Errorf("Contains(%d): expected true, got %v, err %v", id, found, err)
+		}
+	}
+
+	if pos, found, err := list.IndexOf(Item{ID: 9}, itemsEqual); err != nil || found || pos != -1 {
+		t.Errorf("IndexOf(9): expected no match, got %d, found %v, err %v", pos, found, err)
+	}
+	if found, err := list.Contains(Item{ID: 9}, itemsEqual); err != nil || found {
+		t.Errorf("Contains(9): expected false, got %v, err %v", found, err)
+	}
+}
+
+// TestDBList_IndexOfLoadError tests that IndexOf and Contains fail on a record that cannot be
+// loaded instead of reporting a miss.
+func TestDBList_IndexOfLoadError(t *testing.T) {
+	dir := t.TempDir()
+	list := NewDBList[Item](dir, 1)
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+	if err := os.WriteFile(filepath.Join(dir, "1.json"), []byte("garbage"), 0o640); err != nil {
+		t.Fatalf("Failed to corrupt record: %v", err)
+	}
+
+	if pos, found, err := list.IndexOf(Item{ID: 2}, itemsEqual); !errors.Is(err, ErrCorruptRecord) || found || pos != -1 {
+		t.Errorf("Expected ErrCorruptRecord, got %d, found %v, err %v", pos, found, err)
+	}
+	if found, err := list.Contains(Item{ID: 9}, itemsEqual); !errors.Is(err, ErrCorruptRecord) || found {
+		t.Errorf("Expected ErrCorruptRecord, got %v, err %v", found, err)
+	}
+
+	// An item found before the corrupt record is still returned
+	if pos, found, err := list.IndexOf(Item{ID: 0}, itemsEqual); err != nil || !found || pos != 0 {
+		t.Errorf("IndexOf(0): expected position 0, got %d, found %v, err %v", pos, found, err)
+	}
+}
+
+func itemLess(a, b Item) bool {
+	return a.ID < b.ID
+}
+
+// TestDBList_BinarySearch tests searching a sorted list for present, absent and boundary targets.
+func TestDBList_BinarySearch(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 50}, {ID: 10}, {ID: 40}, {ID: 20}, {ID: 30}})
+	list.Sort(itemLess)
+
+	tests := []struct {
+		id    int
+		pos   int
+		found bool
+	}{
+		{id: 10, pos: 0, found: true},
+		{id: 30, pos: 2, found: true},
+		{id: 50, pos: 4, found: true},
+		{id: 5, pos: 0, found: false},
+		{id: 25, pos: 2, found: false},
+		{id: 55, pos: 5, found: false},
+	}
+	for _, tt := range tests {
+		if pos, found, err := list.BinarySearch(Item{ID: tt.id}, itemLess); err != nil || pos != tt.pos || found != tt.found {
+			t.Errorf("BinarySearch(%d): expected %d, %v, got %d, %v, err %v", tt.id, tt.pos, tt.found, pos, found, err)
+		}
+	}
+
+	if pos, found, err := NewDBList[Item]("", 1).BinarySearch(Item{ID: 1}, itemLess); err != nil || pos != 0 || found {
+		t.Errorf("Expected insertion point 0 in an empty list, got %d, %v, err %v", pos, found, err)
+	}
+
+	// An unsorted list falls back to a linear scan
+	list.Swap(0, 4)
+	if pos, found, err := list.BinarySearch(Item{ID: 10}, itemLess); err != nil || pos != 4 || !found {
+		t.Errorf("Expected linear scan to find ID 10 at 4, got %d, %v, err %v", pos, found, err)
+	}
+	if pos, found, err := list.BinarySearch(Item{ID: 25}, itemLess); err != nil || pos != -1 || found {
+		t.Errorf("Expected linear scan to miss ID 25, got %d, %v, err %v", pos, found, err)
+	}
+
+	// The linear scan fails on a record it cannot load instead of missing
+	if err := os.WriteFile(filepath.Join(list.diskPath, "3.json"), []byte("garbage"), 0o640); err != nil {
+		t.Fatalf("Failed to corrupt record: %v", err)
+	}
+	if pos, found, err := list.BinarySearch(Item{ID: 25}, itemLess); !errors.Is(err, ErrCorruptRecord) || found {
+		t.Errorf("Expected ErrCorruptRecord from the linear scan, got %d, %v, err %v", pos, found, err)
+	}
+}
+
+// TestDBList_InsertSorted tests that inserting out-of-order items keeps the list sorted.
+func TestDBList_InsertSorted(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+
+	for _, id := range []int{5, 1, 4, 1, 3, 2, 6} {
+		if err := list.InsertSorted(Item{ID: id}, itemLess); err != nil {
+			t.Fatalf("Failed to insert %d: %v", id, err)
+		}
+	}
+
+	if !list.isSorted {
+		t.Errorf("Expected list to stay sorted")
+	}
+	var got []int
+	for item := range list.All() {
+		got = append(got, item.ID)
+	}
+	if expected := []int{1, 1, 2, 3, 4, 5, 6}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	list.Add(Item{ID: 0})
+	if err := list.InsertSorted(Item{ID: 7}, itemLess); !errors.Is(err, ErrNotSorted) {
+		t.Errorf("Expected ErrNotSorted, got %v", err)
+	}
+}
+
+// TestDBList_MergeSorted tests merging sorted batches into a sorted list, in memory and on disk.
+func TestDBList_MergeSorted(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 3)
+
+	if err := list.MergeSorted([]Item{{ID: 2}, {ID: 4}, {ID: 6}, {ID: 8}}, itemLess); err != nil {
+		t.Fatalf("Failed to merge first batch: %v", err)
+	}
+	if err := list.MergeSorted([]Item{{ID: 1}, {ID: 4}, {ID: 5}, {ID: 9}, {ID: 10}}, itemLess); err != nil {
+		t.Fatalf("Failed to merge second batch: %v", err)
+	}
+
+	if !list.isSorted {
+		t.Errorf("Expected list to stay sorted")
+	}
+	var got []int
+	for item := range list.All() {
+		got = append(got, item.ID)
+	}
+	if expected := []int{1, 2, 4, 4, 5, 6, 8, 9, 10}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	// The existing 4 stays ahead of the merged one
+	if pos, found, err := list.IndexOf(Item{ID: 4}, itemsEqual); err != nil || !found || list.sortedIndexes[pos] != 1 {
+		t.Errorf("Expected the first 4 to be the existing item, got physical index %d", list.sortedIndexes[pos])
+	}
+
+	if err := list.MergeSorted([]Item{{ID: 3}, {ID: 2}}, itemLess); err == nil {
+		t.Errorf("Expected an error for an unsorted batch")
+	}
+	if size := list.Size(); size != 9 {
+		t.Errorf("Expected size 9 after a failed merge, got %d", size)
+	}
+
+	list.Swap(0, 1)
+	if err := list.MergeSorted([]Item{{ID: 0}}, itemLess); !errors.Is(err, ErrNotSorted) {
+		t.Errorf("Expected ErrNotSorted, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package util
+
+// SortView adapts a DBList to sort.Interface using a comparator, so the stdlib sort
+// functions can be used on it. Swap only reorders the sorted index and never touches storage.
+type SortView[T any] struct {
+	list *DBList[T]
+	less func(a, b T) bool
+}
+
+// SortView returns a sort.Interface over the list that orders items with less.
+func (d *DBList[T]) SortView(less func(a, b T) bool) *SortView[T] {
+	return &SortView[T]{list: d, less: less}
+}
+
+// Len returns the number of items in the list.
+func (v *SortView[T]) Len() int {
+	return v.list.Size()
+}
+
+// Less reports whether the item at sorted index i sorts before the item at sorted index j.
+func (v *SortView[T]) Less(i, j int) bool {
+	d := v.list
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	itemA, _ := d.getFromStorage(d.sortedIndexes[i])
+	itemB, _ := d.getFromStorage(d.sortedIndexes[j])
+	return v.less(itemA, itemB)
+}
+
+// Swap exchanges the items at sorted indexes i and j. sort.Interface leaves it no way to
+// return ErrClosed as DBList.Swap does, so on a closed list it does nothing.
+func (v *SortView[T]) Swap(i, j int) {
+	d := v.list
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closed {
+		return
+	}
+
+	d.sortedIndexes[i], d.sortedIndexes[j] = d.sortedIndexes[j], d.sortedIndexes[i]
+	d.isSorted = false
+	d.generation++
+}
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"sort"
+	"testing"
+)
+
+// TestDBList_SortView tests sorting a disk-backed list through sort.Sort.
+func TestDBList_SortView(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 2)
+	list.Adds([]Item{{ID: 4}, {ID: 2}, {ID: 5}, {ID: 1}, {ID: 3}})
+
+	view := list.SortView(func(a, b Item) bool { return a.ID < b.ID })
+	var _ sort.Interface = view
+
+	if sort.IsSorted(view) {
+		t.Errorf("Expected list not to be sorted yet")
+	}
+	sort.Sort(view)
+	if !sort.IsSorted(view) {
+		t.Errorf("Expected list to be sorted")
+	}
+
+	for i := 0; i < 5; i++ {
+		if item, err := list.Get(i); err != nil || item.ID != i+1 {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, i+1, item, err)
+		}
+	}
+
+	// Storage is untouched, so the physical order is still the insertion order
+	if item, err := list.getFromStorage(0); err != nil || item.ID != 4 {
+		t.Errorf("Expected physical index 0 to still hold ID 4, got %v, err %v", item, err)
+	}
+}
+
+// TestDBList_SortViewClosed tests that swapping through a SortView leaves a closed list alone.
+func TestDBList_SortViewClosed(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+	list.Adds([]Item{{ID: 2}, {ID: 1}})
+	view := list.SortView(func(a, b Item) bool { return a.ID < b.ID })
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close list: %v", err)
+	}
+
+	before := list.Order()
+	view.Swap(0, 1)
+	if after := list.Order(); after[0] != before[0] || after[1] != before[1] {
+		t.Errorf("Expected the order of a closed list to be unchanged, got %v, was %v", after, before)
+	}
+}
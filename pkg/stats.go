@@ -0,0 +1,30 @@
+package util
+
+// ListStats describes how the items of a DBList are split between memory and disk.
+type ListStats struct {
+	Total     int
+	InMemory  int
+	OnDisk    int
+	DiskBytes int64
+}
+
+// Stats returns the current item counts of the DBList and the bytes used by its disk records,
+// as reported by DiskBytes. Items still being added are not counted until Get can see them.
+func (d *DBList[T]) Stats() ListStats {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	inMemory := len(d.memoryData)
+	for index := range d.reserved {
+		if _, ok := d.memoryData[index]; ok {
+			inMemory--
+		}
+	}
+
+	return ListStats{
+		Total:     d.totalCount,
+		InMemory:  inMemory,
+		OnDisk:    d.totalCount - inMemory,
+		DiskBytes: d.DiskBytes(),
+	}
+}
@@ -0,0 +1,151 @@
+package util
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestDBList_Stats tests the counts reported after crossing the memory threshold.
+func TestDBList_Stats(t *testing.T) {
+	list := NewDBList[Item](t.TempDir(), 2)
+
+	if stats := list.Stats(); stats != (ListStats{}) {
+		t.Errorf("Expected empty stats, got %+v", stats)
+	}
+
+	list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 10}})
+
+	stats := list.Stats()
+	if stats.Total != 4 || stats.InMemory != 2 || stats.OnDisk != 2 {
+		t.Errorf("Expected 4 total, 2 in memory and 2 on disk, got %+v", stats)
+	}
+	// {"ID":3} and {"ID":10}
+	if stats.DiskBytes != 8+9 {
+		t.Errorf("Expected 17 disk bytes, got %d", stats.DiskBytes)
+	}
+}
+
+// TestDBList_DiskBytes tests that the tracked byte count matches a full recomputation as
+// records are added, replaced and deleted, and across a reopen, for each kind of storage.
+func TestDBList_DiskBytes(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"files":       nil,
+		"append-only": {WithAppendOnlyFile()},
+		"buffered":    {WithAppendOnlyFile(), WithWriteBuffer(2)},
+	} {
+		dir := t.TempDir()
+		list := NewDBList[Item](dir, 2, opts...)
+
+		check := func(step string) {
+			t.Helper()
+			measured, err := list.usage.measure()
+			if err != nil {
+				t.Fatalf("%s: %s: failed to measure: %v", name, step, err)
+			}
+			if tracked := list.DiskBytes(); tracked != measured {
+				t.Errorf("%s: %s: tracked %d bytes, measured %d", name, step, tracked, measured)
+			}
+		}
+
+		list.Adds([]Item{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 10}, {ID: 200}})
+		check("add")
+		if bytes := list.DiskBytes(); opts == nil && bytes != 8+9+10 {
+			t.Errorf("Expected 27 disk bytes, got %d", bytes)
+		}
+
+		list.Update(3, Item{ID: 12345})
+		check("update")
+		list.Delete(4)
+		list.Delete(0)
+		check("delete")
+		list.Compact()
+		check("compact")
+
+		if err := list.Close(); err != nil {
+			t.Fatalf("%s: failed to close: %v", name, err)
+		}
+		list, err := OpenDBList[Item](dir, 2, opts...)
+		if err != nil {
+			t.Fatalf("%s: failed to open: %v", name, err)
+		}
+		check("reopen")
+		list.Add(Item{ID: 7})
+		check("add after reopen")
+
+		list.Clear()
+		if bytes := list.DiskBytes(); bytes != 0 {
+			t.Errorf("%s: expected no disk bytes after Clear, got %d", name, bytes)
+		}
+	}
+}
+
+// countingStore is a store that counts its recordSize lookups.
+type countingStore struct {
+	store
+	lookups int
+}
+
+func (s *countingStore) recordSize(index int) (int64, error) {
+	s.lookups++
+	return s.store.recordSize(index)
+}
+
+// TestSizedStore_Put tests that writing a new record counts its size without any lookup, and
+// that overwriting one looks up only the size it gives back.
+func TestSizedStore_Put(t *testing.T) {
+	inner := &countingStore{store: newAppendStore(t.TempDir(), 0o750, 0o640)}
+	s := newSizedStore(inner)
+	defer s.close()
+
+	for index, data := range []string{"a", "bb", "ccc"} {
+		if err := s.put(index, []byte(data)); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if inner.lookups != 0 {
+		t.Errorf("Expected no lookups for new records, got %d", inner.lookups)
+	}
+	if bytes := s.bytes.Load(); bytes != 3*recordHeaderSize+6 {
+		t.Errorf("Expected %d bytes, got %d", 3*recordHeaderSize+6, bytes)
+	}
+
+	if err := s.put(1, []byte("dddd")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if inner.lookups != 1 {
+		t.Errorf("Expected one lookup to overwrite a record, got %d", inner.lookups)
+	}
+	if measured, err := s.measure(); err != nil || s.bytes.Load() != measured {
+		t.Errorf("Expected %d bytes as measured, got %d, err %v", measured, s.bytes.Load(), err)
+	}
+}
+
+// TestDBList_StatsInFlight tests that Stats and GetRaw leave out the items of an add that has
+// not yet published them.
+func TestDBList_StatsInFlight(t *testing.T) {
+	backend := &gatedBackend{memoryBackend: newMemoryBackend(), index: 2, started: make(chan struct{}), release: make(chan struct{})}
+	list := NewDBList[Item]("", 2, WithBackend(backend))
+	list.Add(Item{ID: 0})
+
+	// Index 1 takes the free memory slot while index 2 is stuck writing to the backend
+	done := make(chan error)
+	go func() { done <- list.AddsParallel([]Item{{ID: 1}, {ID: 2}}, 1) }()
+	<-backend.started
+
+	if stats := list.Stats(); stats.Total != 1 || stats.InMemory != 1 || stats.OnDisk != 0 {
+		t.Errorf("Expected 1 item in memory and none on disk, got %+v", stats)
+	}
+	for _, index := range []int{1, 2} {
+		if item, err := list.GetRaw(index); !errors.Is(err, ErrIndexNotFound) {
+			t.Errorf("GetRaw(%d): expected ErrIndexNotFound, got %v, err %v", index, item, err)
+		}
+	}
+
+	close(backend.release)
+	if err := <-done; err == nil {
+		t.Fatalf("Expected AddsParallel to fail")
+	}
+	if stats := list.Stats(); stats.Total != 1 || stats.InMemory != 1 || stats.OnDisk != 0 {
+		t.Errorf("Expected 1 item in memory and none on disk, got %+v", stats)
+	}
+}
@@ -0,0 +1,122 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// store persists the serialized records of items that overflow to disk, keyed by physical index.
+type store interface {
+	// put writes the record for index, replacing any existing record.
+	put(index int, data []byte) error
+	// get reads the record for index, returning an error wrapping os.ErrNotExist if there is none.
+	get(index int) ([]byte, error)
+	// remove deletes the record for index, returning an error wrapping os.ErrNotExist if there is none.
+	remove(index int) error
+	// recordSize returns the number of bytes the record for index occupies on disk.
+	recordSize(index int) (int64, error)
+	// overhead returns the number of bytes a record occupies on disk beyond its data.
+	overhead() int64
+	// indexes lists the indexes of all stored records in ascending order.
+	indexes() ([]int, error)
+	// flush persists any state the store keeps in memory.
+	flush() error
+	// close releases any resources held by the store.
+	close() error
+}
+
+// fileStore is the default store, writing each record to its own file named by filePathForIndex.
+// Records are written to a temp file and renamed into place, so a record is never seen half written.
+type fileStore[T any] struct {
+	list *DBList[T]
+}
+
+func (s fileStore[T]) put(index int, data []byte) error {
+	filePath, err := s.list.filePathForIndex(index, true)
+	if err != nil {
+		return err
+	}
+
+	// A failed write leaves any previous record in place rather than a truncated one
+	if err := writeFileAtomic(filePath, data, s.list.fileMode, s.list.syncOnWrite); err != nil {
+		return fmt.Errorf("failed to write to disk: %w", err)
+	}
+
+	return nil
+}
+
+func (s fileStore[T]) get(index int) ([]byte, error) {
+	filePath, err := s.list.filePathForIndex(index, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(filePath)
+}
+
+func (s fileStore[T]) remove(index int) error {
+	filePath, err := s.list.filePathForIndex(index, false)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(filePath)
+}
+
+func (s fileStore[T]) recordSize(index int) (int64, error) {
+	filePath, err := s.list.filePathForIndex(index, false)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+func (s fileStore[T]) overhead() int64 {
+	return 0
+}
+
+func (s fileStore[T]) indexes() ([]int, error) {
+	if s.list.diskPath == "" {
+		return nil, nil
+	}
+	if s.list.pathMapper != nil {
+		return s.list.mappedIndexes()
+	}
+
+	entries, err := os.ReadDir(s.list.diskPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var found []int
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if index, ok := s.list.indexForFileName(entry.Name()); ok {
+			found = append(found, index)
+		}
+	}
+	sort.Ints(found)
+
+	return found, nil
+}
+
+func (s fileStore[T]) flush() error {
+	return nil
+}
+
+func (s fileStore[T]) close() error {
+	return nil
+}
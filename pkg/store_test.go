@@ -0,0 +1,83 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestFileStore_WriteError tests that a failed write leaves neither a partial record nor a temp file behind,
+// and that the previous record for the index survives.
+func TestFileStore_WriteError(t *testing.T) {
+	tempDir := t.TempDir()
+	list := NewDBList[Item](tempDir, 0)
+	list.Add(Item{ID: 1})
+
+	// A directory in the way of the temp file makes the write fail
+	blocker := filepath.Join(tempDir, "1.json.tmp")
+	if err := os.MkdirAll(filepath.Join(blocker, "child"), os.ModePerm); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	if err := list.Add(Item{ID: 2}); err == nil {
+		t.Fatalf("Expected error adding item")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "1.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected no record for the failed write, got err %v", err)
+	}
+	if got := list.Size(); got != 1 {
+		t.Errorf("Expected size to be 1, got %d", got)
+	}
+
+	if err := os.Rename(blocker, filepath.Join(tempDir, "0.json.tmp")); err != nil {
+		t.Fatalf("Failed to move directory: %v", err)
+	}
+	if err := list.Update(0, Item{ID: 3}); err == nil {
+		t.Fatalf("Expected error updating item")
+	}
+	if item, err := list.Get(0); err != nil || item.ID != 1 {
+		t.Errorf("Expected the previous record to survive, got %v, err %v", item, err)
+	}
+
+	// A successful write leaves only the final file
+	os.RemoveAll(filepath.Join(tempDir, "0.json.tmp"))
+	if err := list.Update(0, Item{ID: 3}); err != nil {
+		t.Fatalf("Failed to update item: %v", err)
+	}
+	entries, _ := os.ReadDir(tempDir)
+	if len(entries) != 1 || entries[0].Name() != "0.json" {
+		t.Errorf("Expected only 0.json on disk, got %v", entries)
+	}
+}
+
+// TestWithSyncOnWrite tests that each record written by Add is synced, with its directory for
+// the file per record store, and that nothing is synced by default.
+func TestWithSyncOnWrite(t *testing.T) {
+	var synced []string
+	defer func(orig func(*os.File) error) { syncFile = orig }(syncFile)
+	syncFile = func(f *os.File) error {
+		synced = append(synced, filepath.Base(f.Name()))
+		return f.Sync()
+	}
+
+	dir := t.TempDir()
+	list := NewDBList[Item](dir, 1, WithSyncOnWrite(true))
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+	if expected := []string{"1.json.tmp", filepath.Base(dir), "2.json.tmp", filepath.Base(dir)}; !slices.Equal(synced, expected) {
+		t.Errorf("Expected syncs %v, got %v", expected, synced)
+	}
+
+	synced = nil
+	appendOnly := NewDBList[Item](t.TempDir(), 1, WithAppendOnlyFile(), WithSyncOnWrite(true))
+	appendOnly.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+	if expected := []string{appendLogFileName, appendLogFileName}; !slices.Equal(synced, expected) {
+		t.Errorf("Expected syncs %v, got %v", expected, synced)
+	}
+
+	synced = nil
+	NewDBList[Item](t.TempDir(), 1).Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}})
+	if len(synced) != 0 {
+		t.Errorf("Expected no syncs by default, got %v", synced)
+	}
+}
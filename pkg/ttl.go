@@ -0,0 +1,228 @@
+package util
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// timesFileName is the file in a DBList's disk path holding the insertion times stamped
+	// since its metadata was last saved.
+	timesFileName = "ttl.log"
+	// timesHeaderSize is the size of the epoch at the start of the times file.
+	timesHeaderSize = 8
+	// timesEntrySize is the size of the physical index and time of each entry in the times file.
+	timesEntrySize = 16
+)
+
+// timesLog keeps the insertion times stamped for WithTTL on disk as they are stamped, so they
+// survive a crash that comes before the metadata is saved. The file starts with the epoch of
+// the metadata it follows on from: saving the metadata takes the next epoch and starts a new
+// file, so a file left behind by a crash in between is recognised as already saved and ignored.
+// The caller must hold the list's write lock.
+type timesLog struct {
+	path       string
+	dirMode    os.FileMode
+	fileMode   os.FileMode
+	syncWrites bool
+	epoch      uint64
+	file       *os.File
+	// size is the size of file, taken when it is opened and kept up to date by append
+	size int64
+}
+
+// newTimesLog creates a timesLog kept in dir. The file is created on first use.
+func newTimesLog(dir string, dirMode, fileMode os.FileMode, syncWrites bool) *timesLog {
+	return &timesLog{path: filepath.Join(dir, timesFileName), dirMode: dirMode, fileMode: fileMode, syncWrites: syncWrites}
+}
+
+// append records that the item at index was added at nanos, in Unix nanoseconds.
+func (l *timesLog) append(index int, nanos int64) error {
+	if l.file == nil {
+		if err := os.MkdirAll(filepath.Dir(l.path), l.dirMode); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, l.fileMode)
+		if err != nil {
+			return fmt.Errorf("failed to open times file: %w", err)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to open times file: %w", err)
+		}
+		l.file, l.size = file, info.Size()
+	}
+
+	var buf []byte
+	if l.size == 0 {
+		buf = binary.LittleEndian.AppendUint64(buf, l.epoch)
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(index))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(nanos))
+
+	n, err := l.file.Write(buf)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write times file: %w", err)
+	}
+	if l.syncWrites {
+		if err := syncFile(l.file); err != nil {
+			return fmt.Errorf("failed to sync times file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// read returns the times in the file by physical index, later entries taking precedence, or
+// nil if the file is missing or belongs to another epoch, in which case it is deleted so new
+// entries start a file of their own. A torn entry at the end is ignored.
+func (l *timesLog) read() (map[int]int64, error) {
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read times file: %w", err)
+	}
+	if len(data) < timesHeaderSize || binary.LittleEndian.Uint64(data) != l.epoch {
+		return nil, l.reset(l.epoch)
+	}
+
+	times := make(map[int]int64)
+	for data = data[timesHeaderSize:]; len(data) >= timesEntrySize; data = data[timesEntrySize:] {
+		index := int(binary.LittleEndian.Uint64(data[0:8]))
+		times[index] = int64(binary.LittleEndian.Uint64(data[8:16]))
+	}
+
+	return times, nil
+}
+
+// reset starts a new, empty file for epoch.
+func (l *timesLog) reset(epoch uint64) error {
+	if err := l.close(); err != nil {
+		return err
+	}
+	l.epoch = epoch
+
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete times file: %w", err)
+	}
+
+	return nil
+}
+
+// close closes the file if it is open.
+func (l *timesLog) close() error {
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
+
+// stamp records the insertion time of the item at physical index when a TTL is configured.
+// The caller must hold the write lock.
+func (d *DBList[T]) stamp(index int) {
+	if d.ttl <= 0 {
+		return
+	}
+	if d.addedAt == nil {
+		d.addedAt = make(map[int]int64)
+	}
+	now := d.now().UnixNano()
+	d.addedAt[index] = now
+
+	if d.times != nil {
+		if err := d.times.append(index, now); err != nil {
+			d.logger.Error("DBList failed to save an insertion time", "index", index, "error", err)
+		}
+	}
+}
+
+// expired reports whether the item at physical index was added more than the TTL ago.
+// The caller must hold the lock.
+func (d *DBList[T]) expired(index int) bool {
+	addedAt, ok := d.addedAt[index]
+	return ok && addedAt < d.now().Add(-d.ttl).UnixNano()
+}
+
+// errExpired is returned to the iterators for an item that WithTTLSkipOnRead hides.
+var errExpired = errors.New("item has expired")
+
+// iterGet gets the item at sorted index for the iterators, which skip it if it has expired
+// and WithTTLSkipOnRead was given.
+func (d *DBList[T]) iterGet(index int) (T, error) {
+	item, physical, _, err := d.lookup(index)
+	if err != nil || d.ttl <= 0 || !d.ttlSkipOnRead {
+		return item, err
+	}
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if d.expired(physical) {
+		var zero T
+		return zero, errExpired
+	}
+	return item, nil
+}
+
+// Expire removes every item added more than the TTL set by WithTTL ago and reports how many
+// were removed. Expired items are not removed until Expire is called: Get still returns them,
+// and so do the iterators unless WithTTLSkipOnRead was given. It does nothing if no TTL is
+// configured. Insertion times are kept in memory, so finding the expired items reads nothing
+// from disk.
+func (d *DBList[T]) Expire() (removed int, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return 0, err
+	}
+	if d.ttl <= 0 {
+		return 0, nil
+	}
+
+	// Deleting from the end keeps the earlier positions valid
+	for i := len(d.sortedIndexes) - 1; i >= 0; i-- {
+		if !d.expired(d.sortedIndexes[i]) {
+			continue
+		}
+		if err := d.deleteAt(i); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// WithTTL records the time each item is added so that Expire can remove the items older than
+// ttl. With a disk path, each time is also written to a file in it as the item is added, and
+// the times are saved in the metadata, so they survive a crash before Flush or Close as well
+// as the records do. Items found on disk by OpenDBList without a saved time are treated as
+// added when the list is opened.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithTTLSkipOnRead makes Iterator, RangeIterator, IteratorBuffered, IteratorErr, All and All2
+// skip the items that have outlived the TTL set by WithTTL but not yet been removed by Expire.
+// Get, Size and the other methods still see them. All2 yields the sorted indexes of the items
+// it does not skip, so the indexes it yields may have gaps.
+func WithTTLSkipOnRead() Option {
+	return func(o *options) {
+		o.ttlSkipOnRead = true
+	}
+}
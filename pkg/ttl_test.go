@@ -0,0 +1,196 @@
+package util
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock for tests that only moves when told to.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+// TestDBList_Expire tests that only items older than the TTL are evicted, in memory and on disk.
+func TestDBList_Expire(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	list := NewDBList[Item](t.TempDir(), 1, WithTTL(time.Minute))
+	list.now = clock.now
+
+	list.Adds([]Item{{ID: 0}, {ID: 1}})
+	clock.t = clock.t.Add(30 * time.Second)
+	list.Adds([]Item{{ID: 2}, {ID: 3}})
+
+	clock.t = clock.t.Add(29 * time.Second)
+	if removed, err := list.Expire(); err != nil || removed != 0 {
+		t.Errorf("Expected nothing to expire yet, got %d, err %v", removed, err)
+	}
+
+	clock.t = clock.t.Add(2 * time.Second)
+	removed, err := list.Expire()
+	if err != nil || removed != 2 {
+		t.Fatalf("Expected 2 items to expire, got %d, err %v", removed, err)
+	}
+	for i, want := range []int{2, 3} {
+		if item, err := list.Get(i); err != nil || item.ID != want {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, want, item, err)
+		}
+	}
+
+	clock.t = clock.t.Add(time.Minute)
+	if removed, err := list.Expire(); err != nil || removed != 2 || list.Size() != 0 {
+		t.Errorf("Expected the rest to expire, got %d, size %d, err %v", removed, list.Size(), err)
+	}
+}
+
+// TestDBList_ExpireReopen tests that insertion times survive reopening the list.
+func TestDBList_ExpireReopen(t *testing.T) {
+	tempDir := t.TempDir()
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	list := NewDBList[Item](tempDir, 0, WithTTL(time.Minute))
+	list.now = clock.now
+
+	list.Add(Item{ID: 0})
+	clock.t = clock.t.Add(time.Minute)
+	list.Add(Item{ID: 1})
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close list: %v", err)
+	}
+
+	reopened, err := OpenDBList[Item](tempDir, 0, WithTTL(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	reopened.now = func() time.Time { return clock.t.Add(30 * time.Second) }
+
+	if removed, err := reopened.Expire(); err != nil || removed != 1 {
+		t.Errorf("Expected 1 item to expire, got %d, err %v", removed, err)
+	}
+	if item, err := reopened.Get(0); err != nil || item.ID != 1 {
+		t.Errorf("Expected ID 1 to remain, got %v, err %v", item, err)
+	}
+
+	// Without a TTL nothing is tracked or expired
+	plain := NewDBList[Item]("", 2)
+	plain.Add(Item{ID: 0})
+	if removed, err := plain.Expire(); err != nil || removed != 0 || plain.addedAt != nil {
+		t.Errorf("Expected nothing to expire without a TTL, got %d, err %v", removed, err)
+	}
+}
+
+// TestDBList_ExpireAfterCrash tests that the insertion times of items on disk survive a list
+// that is abandoned without Flush or Close, both before and after the metadata is first saved.
+func TestDBList_ExpireAfterCrash(t *testing.T) {
+	tempDir := t.TempDir()
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	list := NewDBList[Item](tempDir, 0, WithTTL(time.Minute))
+	list.now = clock.now
+
+	list.Add(Item{ID: 0})
+	if err := list.Flush(); err != nil {
+		t.Fatalf("Failed to flush list: %v", err)
+	}
+	list.Add(Item{ID: 1})
+	clock.t = clock.t.Add(time.Minute)
+	list.Add(Item{ID: 2})
+
+	// The list is abandoned here, as if the process had crashed
+	reopened, err := OpenDBList[Item](tempDir, 0, WithTTL(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	reopened.now = func() time.Time { return clock.t.Add(30 * time.Second) }
+
+	if removed, err := reopened.Expire(); err != nil || removed != 2 {
+		t.Errorf("Expected the 2 older items to expire, got %d, err %v", removed, err)
+	}
+	if item, err := reopened.Get(0); err != nil || item.ID != 2 {
+		t.Errorf("Expected ID 2 to remain, got %v, err %v", item, err)
+	}
+
+	// Once the metadata holds the times, the file of times since is started again
+	if err := reopened.Flush(); err != nil {
+		t.Fatalf("Failed to flush list: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, timesFileName)); !os.IsNotExist(err) {
+		t.Errorf("Expected no times file after Flush, got err %v", err)
+	}
+}
+
+// TestWithTTLSkipOnRead tests that the iterators skip expired items only when asked to, while
+// Get still returns them.
+func TestWithTTLSkipOnRead(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	collect := func(list *DBList[Item]) []int {
+		var ids []int
+		for item := range list.All() {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+
+	skipping := NewDBList[Item](t.TempDir(), 1, WithTTL(time.Minute), WithTTLSkipOnRead())
+	plain := NewDBList[Item](t.TempDir(), 1, WithTTL(time.Minute))
+	for _, list := range []*DBList[Item]{skipping, plain} {
+		list.now = clock.now
+		list.Adds([]Item{{ID: 0}, {ID: 1}})
+	}
+	clock.t = clock.t.Add(2 * time.Minute)
+	for _, list := range []*DBList[Item]{skipping, plain} {
+		list.Add(Item{ID: 2})
+	}
+
+	if got := collect(skipping); !slices.Equal(got, []int{2}) {
+		t.Errorf("Expected only the unexpired item, got %v", got)
+	}
+	var fromChannel []int
+	for item := range skipping.Iterator(context.Background()) {
+		fromChannel = append(fromChannel, item.ID)
+	}
+	if !slices.Equal(fromChannel, []int{2}) {
+		t.Errorf("Expected Iterator to skip the expired items, got %v", fromChannel)
+	}
+	if item, err := skipping.Get(0); err != nil || item.ID != 0 {
+		t.Errorf("Expected Get to still return an expired item, got %v, err %v", item, err)
+	}
+
+	if got := collect(plain); !slices.Equal(got, []int{0, 1, 2}) {
+		t.Errorf("Expected every item without WithTTLSkipOnRead, got %v", got)
+	}
+}
+
+// TestTimesLog_Append tests that the epoch is written once at the start of the file, including
+// when appending to a file left by an earlier timesLog.
+func TestTimesLog_Append(t *testing.T) {
+	dir := t.TempDir()
+	l := newTimesLog(dir, 0o750, 0o640, false)
+	l.epoch = 3
+	for index := range 2 {
+		if err := l.append(index, int64(100+index)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	l.close()
+
+	l = newTimesLog(dir, 0o750, 0o640, false)
+	l.epoch = 3
+	if err := l.append(2, 102); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	l.close()
+
+	if info, err := os.Stat(filepath.Join(dir, timesFileName)); err != nil || info.Size() != timesHeaderSize+3*timesEntrySize {
+		t.Fatalf("Expected one header and 3 entries, got %v, err %v", info, err)
+	}
+	times, err := l.read()
+	if err != nil || len(times) != 3 || times[0] != 100 || times[2] != 102 {
+		t.Errorf("Expected the 3 times, got %v, err %v", times, err)
+	}
+}
@@ -0,0 +1,102 @@
+package util
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// typeRegistry records the concrete types that may be stored in a list whose element type is
+// an interface, so that items read back from disk are recreated with their original types.
+// Each record is prefixed with the name of its item's type, and decoding starts from a new
+// value of that type, which a codec such as JSON then fills in through the pointer.
+type typeRegistry[T any] struct {
+	factories map[string]func() T
+	names     map[reflect.Type]string
+}
+
+// newTypeRegistry creates a typeRegistry from factories that each return a new pointer to a
+// different concrete type.
+func newTypeRegistry[T any](factories []func() T) (*typeRegistry[T], error) {
+	r := &typeRegistry[T]{
+		factories: make(map[string]func() T, len(factories)),
+		names:     make(map[reflect.Type]string, len(factories)),
+	}
+
+	for _, factory := range factories {
+		typ := reflect.TypeOf(factory())
+		if typ == nil || typ.Kind() != reflect.Pointer {
+			return nil, fmt.Errorf("factory for %s must return a pointer, not %v", typeName[T](), typ)
+		}
+
+		name := typ.String()
+		if _, ok := r.factories[name]; ok {
+			return nil, fmt.Errorf("type %s is registered twice", name)
+		}
+		r.factories[name] = factory
+		r.names[typ] = name
+	}
+
+	return r, nil
+}
+
+// tag prefixes data, the encoding of v, with the name of the type of the item it holds.
+func (r *typeRegistry[T]) tag(v any, data []byte) ([]byte, error) {
+	var item any
+	switch x := v.(type) {
+	case recordEnvelope[T]:
+		item = x.Item
+	case T:
+		item = x
+	default:
+		return nil, fmt.Errorf("cannot tag a %T", v)
+	}
+
+	name, ok := r.names[reflect.TypeOf(item)]
+	if !ok {
+		return nil, fmt.Errorf("type %T is not registered with WithTypes", item)
+	}
+
+	tagged := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(name)+len(data)), uint64(len(name)))
+	tagged = append(tagged, name...)
+	return append(tagged, data...), nil
+}
+
+// prepare strips the type name from data and sets the item v decodes into, a *T or a
+// *recordEnvelope[T], to a new value of that type. It returns the encoding of the item.
+func (r *typeRegistry[T]) prepare(data []byte, v any) ([]byte, error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length {
+		return nil, errors.New("record has no type name")
+	}
+	name := string(data[n : n+int(length)])
+
+	factory, ok := r.factories[name]
+	if !ok {
+		return nil, fmt.Errorf("type %s is not registered with WithTypes", name)
+	}
+
+	switch x := v.(type) {
+	case *T:
+		*x = factory()
+	case *recordEnvelope[T]:
+		x.Item = factory()
+	default:
+		return nil, fmt.Errorf("cannot decode a typed record into a %T", v)
+	}
+
+	return data[n+int(length):], nil
+}
+
+// WithTypes lets a list whose element type T is an interface store items on disk and read
+// them back with their concrete types. Each factory returns a new pointer to one of the
+// concrete types, such as func() Shape { return &Circle{} }; every item written to disk must
+// be one of those pointer types. Records are tagged with the Go name of their type, so
+// renaming a type makes its records unreadable. The codec must decode into the value an
+// interface already holds, as JSONCodec does.
+func WithTypes[T any](factories ...func() T) Option {
+	return func(o *options) {
+		o.factories = factories
+	}
+}
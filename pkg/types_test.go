@@ -0,0 +1,85 @@
+package util
+
+import (
+	"math"
+	"testing"
+)
+
+type shape interface {
+	area() float64
+}
+
+type circle struct {
+	Radius float64
+}
+
+func (c *circle) area() float64 {
+	return math.Pi * c.Radius * c.Radius
+}
+
+type rect struct {
+	Width, Height float64
+}
+
+func (r *rect) area() float64 {
+	return r.Width * r.Height
+}
+
+// TestWithTypes tests that items of an interface type come back from disk, and from a
+// reopened list, with their concrete types and values.
+func TestWithTypes(t *testing.T) {
+	dir := t.TempDir()
+	types := WithTypes(func() shape { return &circle{} }, func() shape { return &rect{} })
+	shapes := []shape{&circle{Radius: 1}, &rect{Width: 2, Height: 3}, &circle{Radius: 2}, &rect{Width: 4, Height: 5}}
+
+	check := func(list *DBList[shape]) {
+		t.Helper()
+		for i, want := range shapes {
+			got, err := list.Get(i)
+			if err != nil {
+				t.Fatalf("Get(%d): %v", i, err)
+			}
+			switch want := want.(type) {
+			case *circle:
+				if c, ok := got.(*circle); !ok || *c != *want {
+					t.Errorf("Get(%d): expected %v, got %#v", i, want, got)
+				}
+			case *rect:
+				if r, ok := got.(*rect); !ok || *r != *want {
+					t.Errorf("Get(%d): expected %v, got %#v", i, want, got)
+				}
+			}
+		}
+	}
+
+	list, err := NewDBListWithOptions[shape](WithPath(dir), WithMaxInMemory(1), types)
+	if err != nil {
+		t.Fatalf("Failed to create list: %v", err)
+	}
+	list.Adds(shapes)
+	check(list)
+
+	if err := list.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	reopened, err := OpenDBList[shape](dir, 0, types)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	check(reopened)
+
+	// An unregistered type cannot be written to disk
+	if err := reopened.Add(&unregisteredShape{}); err == nil {
+		t.Errorf("Expected an error adding an unregistered type")
+	}
+
+	if _, err := NewDBListWithOptions[shape](WithTypes(func() shape { return nil })); err == nil {
+		t.Errorf("Expected an error for a factory that does not return a pointer")
+	}
+}
+
+type unregisteredShape struct{}
+
+func (*unregisteredShape) area() float64 {
+	return 0
+}
@@ -0,0 +1,113 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"slices"
+)
+
+// RepairPolicy decides what Repair does with items whose disk records cannot be read.
+type RepairPolicy int
+
+const (
+	// RepairDrop removes bad items from the list, deleting whatever is left of their records.
+	RepairDrop RepairPolicy = iota
+	// RepairZero replaces bad items with the zero value of the element type, keeping their place.
+	RepairZero
+)
+
+// Verify reads every item stored on disk and returns the sorted indexes, in ascending order,
+// of those whose records are missing, unreadable or cannot be decoded. Items in memory are not
+// checked. It costs a disk read per item on disk and holds the read lock throughout.
+func (d *DBList[T]) Verify() ([]int, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if d.closed {
+		return nil, ErrClosed
+	}
+
+	return d.badPositions(), nil
+}
+
+// badPositions returns the sorted indexes of the items on disk that cannot be loaded. The
+// caller must hold the lock.
+func (d *DBList[T]) badPositions() []int {
+	var bad []int
+	for i, index := range d.sortedIndexes {
+		if _, ok := d.memoryData[index]; ok {
+			continue
+		}
+		if _, _, err := d.retrieveWithMeta(index); err != nil {
+			bad = append(bad, i)
+		}
+	}
+
+	return bad
+}
+
+// Repair finds the items that Verify would report and fixes them according to policy, then
+// rewrites the metadata to match. It returns the number of items repaired. With RepairDrop
+// the remaining items keep their order, so the sorted indexes after a dropped item shift down.
+func (d *DBList[T]) Repair(policy RepairPolicy) (int, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.checkWritable(); err != nil {
+		return 0, err
+	}
+	d.waitForWrites()
+
+	bad := d.badPositions()
+	if len(bad) == 0 {
+		return 0, nil
+	}
+
+	switch policy {
+	case RepairDrop:
+		dropped := make(map[int]bool, len(bad))
+		for _, pos := range bad {
+			index := d.sortedIndexes[pos]
+			if err := d.logDelete(index); err != nil {
+				return 0, err
+			}
+			if err := d.deleteFromStorage(index); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return 0, err
+			}
+			dropped[index] = true
+		}
+		d.sortedIndexes = slices.DeleteFunc(d.sortedIndexes, func(index int) bool {
+			return dropped[index]
+		})
+		d.totalCount = len(d.sortedIndexes)
+
+	case RepairZero:
+		var zero T
+		data, err := d.encode(zero)
+		if err != nil {
+			return 0, err
+		}
+		for _, pos := range bad {
+			index := d.sortedIndexes[pos]
+			if err := d.logPut(index, data); err != nil {
+				return 0, err
+			}
+			if err := d.putWithMeta(index, data, false); err != nil {
+				return 0, err
+			}
+			delete(d.itemMeta, index)
+			d.indexLookup(index, zero)
+		}
+		d.isSorted = false
+
+	default:
+		return 0, errors.New("unknown repair policy")
+	}
+	d.generation++
+
+	if err := d.writeMetadata(); err != nil {
+		return len(bad), err
+	}
+
+	return len(bad), nil
+}
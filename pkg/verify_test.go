@@ -0,0 +1,74 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// corruptList returns a list of IDs 0 to 5 with 0 and 1 in memory, the record of ID 2 deleted
+// and the record of ID 4 overwritten with garbage.
+func corruptList(t *testing.T) *DBList[Item] {
+	t.Helper()
+	dir := t.TempDir()
+	list := NewDBList[Item](dir, 2)
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}})
+
+	if err := os.Remove(filepath.Join(dir, "2.json")); err != nil {
+		t.Fatalf("Failed to delete record: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "4.json"), []byte("{not json"), 0o640); err != nil {
+		t.Fatalf("Failed to corrupt record: %v", err)
+	}
+
+	return list
+}
+
+// TestDBList_Verify tests that missing and corrupt records are reported by sorted index.
+func TestDBList_Verify(t *testing.T) {
+	list := corruptList(t)
+
+	bad, err := list.Verify()
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if expected := []int{2, 4}; !reflect.DeepEqual(bad, expected) {
+		t.Errorf("Expected bad indexes %v, got %v", expected, bad)
+	}
+
+	clean := NewDBList[Item](t.TempDir(), 1)
+	clean.Adds([]Item{{ID: 0}, {ID: 1}})
+	if bad, err := clean.Verify(); err != nil || len(bad) != 0 {
+		t.Errorf("Expected a clean list to verify, got %v, err %v", bad, err)
+	}
+}
+
+// TestDBList_Repair tests dropping and zeroing the bad items.
+func TestDBList_Repair(t *testing.T) {
+	list := corruptList(t)
+	if repaired, err := list.Repair(RepairDrop); err != nil || repaired != 2 {
+		t.Fatalf("Expected 2 items dropped, got %d, err %v", repaired, err)
+	}
+	if got, err := list.ToSlice(0); err != nil || !reflect.DeepEqual(got, []Item{{ID: 0}, {ID: 1}, {ID: 3}, {ID: 5}}) {
+		t.Errorf("Expected the good items in order, got %v, err %v", got, err)
+	}
+
+	list = corruptList(t)
+	if repaired, err := list.Repair(RepairZero); err != nil || repaired != 2 {
+		t.Fatalf("Expected 2 items zeroed, got %d, err %v", repaired, err)
+	}
+	if got, err := list.ToSlice(0); err != nil || !reflect.DeepEqual(got, []Item{{ID: 0}, {ID: 1}, {}, {ID: 3}, {}, {ID: 5}}) {
+		t.Errorf("Expected the bad items zeroed in place, got %v, err %v", got, err)
+	}
+	if bad, _ := list.Verify(); len(bad) != 0 {
+		t.Errorf("Expected nothing left to repair, got %v", bad)
+	}
+
+	if _, err := list.Repair(RepairPolicy(9)); err != nil {
+		t.Errorf("Expected a clean list to need no repair, got %v", err)
+	}
+	if _, err := corruptList(t).Repair(RepairPolicy(9)); err == nil {
+		t.Errorf("Expected an error for an unknown policy, got %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package util
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// walFileName is the name of the write-ahead log within a DBList's disk path.
+const walFileName = "wal.log"
+
+// walHeaderSize is the size of the kind, index and length header of each WAL entry.
+// Each entry is followed by a CRC32 of its header and payload.
+const walHeaderSize = 13
+
+const (
+	// walPut records that the record for an index is payload.
+	walPut byte = iota + 1
+	// walDelete records that the item at an index was removed.
+	walDelete
+)
+
+// walEntry is a change to the records of a DBList read back from its write-ahead log.
+type walEntry struct {
+	kind    byte
+	index   int
+	payload []byte
+}
+
+// writeAheadLog is an append-only log of the changes made to a DBList since its last
+// checkpoint. Each entry is synced to disk before the change is acknowledged, so a list
+// reopened after a crash can replay the changes that were not yet safely in its records.
+type writeAheadLog struct {
+	path     string
+	dirMode  os.FileMode
+	fileMode os.FileMode
+	mutex    sync.Mutex
+	file     *os.File
+}
+
+// newWriteAheadLog creates a writeAheadLog kept in dir. The file is created on first use.
+func newWriteAheadLog(dir string, dirMode, fileMode os.FileMode) *writeAheadLog {
+	return &writeAheadLog{path: filepath.Join(dir, walFileName), dirMode: dirMode, fileMode: fileMode}
+}
+
+// append adds an entry to the log and syncs it to disk.
+func (w *writeAheadLog) append(kind byte, index int, payload []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	if _, err := w.file.Write(encodeWALEntry(walEntry{kind: kind, index: index, payload: payload})); err != nil {
+		return fmt.Errorf("failed to write to log: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync log: %w", err)
+	}
+
+	return nil
+}
+
+// rewrite atomically replaces the log with the given entries, discarding everything before them.
+func (w *writeAheadLog) rewrite(entries []walEntry) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var data []byte
+	for _, entry := range entries {
+		data = append(data, encodeWALEntry(entry)...)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(w.path), w.dirMode); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := writeFileAtomic(w.path, data, w.fileMode, true); err != nil {
+		return fmt.Errorf("failed to write log: %w", err)
+	}
+
+	// The open file is the one that was replaced, so appends must reopen the new one
+	return w.closeFile()
+}
+
+// read returns the entries in the log, ignoring a torn entry at its end.
+func (w *writeAheadLog) read() ([]walEntry, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read log: %w", err)
+	}
+
+	var entries []walEntry
+	for len(data) >= walHeaderSize+crc32.Size {
+		length := int(binary.LittleEndian.Uint32(data[9:13]))
+		end := walHeaderSize + length
+		if end+crc32.Size > len(data) {
+			break
+		}
+		if binary.LittleEndian.Uint32(data[end:]) != crc32.ChecksumIEEE(data[:end]) {
+			break
+		}
+
+		entries = append(entries, walEntry{
+			kind:    data[0],
+			index:   int(binary.LittleEndian.Uint64(data[1:9])),
+			payload: data[walHeaderSize:end],
+		})
+		data = data[end+crc32.Size:]
+	}
+
+	return entries, nil
+}
+
+// close releases the log file.
+func (w *writeAheadLog) close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.closeFile()
+}
+
+// open opens the log file for appending if it is not already open.
+func (w *writeAheadLog) open() error {
+	if w.file != nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(w.path), w.dirMode); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, w.fileMode)
+	if err != nil {
+		return fmt.Errorf("failed to open log: %w", err)
+	}
+	w.file = file
+
+	return nil
+}
+
+// closeFile closes the log file if it is open.
+func (w *writeAheadLog) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+	w.file = nil
+
+	return err
+}
+
+// encodeWALEntry frames an entry with its header and checksum.
+func encodeWALEntry(entry walEntry) []byte {
+	buf := make([]byte, walHeaderSize+len(entry.payload), walHeaderSize+len(entry.payload)+crc32.Size)
+	buf[0] = entry.kind
+	binary.LittleEndian.PutUint64(buf[1:9], uint64(entry.index))
+	binary.LittleEndian.PutUint32(buf[9:13], uint32(len(entry.payload)))
+	copy(buf[walHeaderSize:], entry.payload)
+
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+// logPut records in the write-ahead log, if any, that the record for index is data.
+func (d *DBList[T]) logPut(index int, data []byte) error {
+	if d.wal == nil {
+		return nil
+	}
+
+	return d.wal.append(walPut, index, data)
+}
+
+// logMemoryPut records an item kept in memory in the write-ahead log, if any, so it survives a crash.
+func (d *DBList[T]) logMemoryPut(index int, item T, meta map[string]string) error {
+	if d.wal == nil {
+		return nil
+	}
+
+	data, err := d.encodeWithMeta(item, meta)
+	if err != nil {
+		return err
+	}
+
+	return d.logPut(index, data)
+}
+
+// logDelete records the removal of the item at index in the write-ahead log, if any.
+func (d *DBList[T]) logDelete(index int) error {
+	if d.wal == nil {
+		return nil
+	}
+
+	return d.wal.append(walDelete, index, nil)
+}
+
+// putLogged writes the disk record for an item newly added at physical index, logging it first.
+// If the write fails the removal is logged too, so a reopened list does not replay the add. It
+// needs no lock, as each index has its own record.
+func (d *DBList[T]) putLogged(index int, data []byte) error {
+	if err := d.logPut(index, data); err != nil {
+		return err
+	}
+	if err := d.disk.put(index, data); err != nil {
+		d.logDelete(index)
+		return err
+	}
+
+	return nil
+}
+
+// checkpoint replaces the write-ahead log, if any, with entries for the items held only in
+// memory, once everything else is in the records on disk. The caller must hold the write lock.
+func (d *DBList[T]) checkpoint() error {
+	if d.wal == nil {
+		return nil
+	}
+
+	entries := make([]walEntry, 0, len(d.memoryData))
+	for index, item := range d.memoryData {
+		data, err := d.encodeWithMeta(item, d.itemMeta[index])
+		if err != nil {
+			return err
+		}
+		entries = append(entries, walEntry{kind: walPut, index: index, payload: data})
+	}
+
+	return d.wal.rewrite(entries)
+}
+
+// replayLog applies the changes in the write-ahead log, if any, to the records on disk, so that
+// a reopened list holds every change acknowledged before a crash. Only the last change to each
+// index matters, and writing it again is harmless if it had already reached the records.
+func (d *DBList[T]) replayLog() error {
+	if d.wal == nil {
+		return nil
+	}
+
+	entries, err := d.wal.read()
+	if err != nil {
+		return err
+	}
+
+	last := make(map[int]walEntry, len(entries))
+	for _, entry := range entries {
+		last[entry.index] = entry
+	}
+
+	for index, entry := range last {
+		if entry.kind == walDelete {
+			if err := d.disk.remove(index); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to delete from disk: %w", err)
+			}
+			continue
+		}
+
+		if err := d.disk.put(index, entry.payload); err != nil {
+			return err
+		}
+	}
+
+	return d.disk.flush()
+}
+
+// WithWriteAheadLog records every change to the list in a log that is synced to disk before
+// the change is acknowledged, including items that are only held in memory. OpenDBList replays
+// the log, so nothing acknowledged is lost if the process crashes before Flush or Close. The
+// log is cut back at each Flush, Compact and Close. It costs a sync per change.
+func WithWriteAheadLog() Option {
+	return func(o *options) {
+		o.writeAheadLog = true
+	}
+}
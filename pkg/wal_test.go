@@ -0,0 +1,115 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestDBList_WriteAheadLog tests that a list abandoned without Flush or Close is recovered
+// from its log, including a torn data file, items only held in memory and deletions.
+func TestDBList_WriteAheadLog(t *testing.T) {
+	dir := t.TempDir()
+	list := NewDBList[Item](dir, 1, WithWriteAheadLog())
+	list.Adds([]Item{{ID: 0}, {ID: 1}, {ID: 2}, {ID: 3}})
+	if err := list.Delete(3); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+
+	// Simulate a crash part way through writing the record for index 1
+	if err := os.Truncate(filepath.Join(dir, "1.json"), 3); err != nil {
+		t.Fatalf("Failed to truncate record: %v", err)
+	}
+
+	recovered, err := OpenDBList[Item](dir, 1, WithWriteAheadLog())
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if size := recovered.Size(); size != 3 {
+		t.Fatalf("Expected 3 items, got %d", size)
+	}
+	for i := range 3 {
+		if item, err := recovered.Get(i); err != nil || item.ID != i {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, i, item, err)
+		}
+	}
+
+	// After a clean close there is nothing left to replay
+	if err := recovered.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, walFileName)); err != nil || info.Size() != 0 {
+		t.Errorf("Expected an empty log after Close, got %v, err %v", info, err)
+	}
+}
+
+// TestWriteAheadLog_TornTail tests that an entry cut short by a crash is ignored.
+func TestWriteAheadLog_TornTail(t *testing.T) {
+	dir := t.TempDir()
+	wal := newWriteAheadLog(dir, 0o750, 0o640)
+	defer wal.close()
+
+	if err := wal.append(walPut, 0, []byte("first")); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if err := wal.append(walPut, 1, []byte("second")); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+
+	info, err := os.Stat(wal.path)
+	if err != nil {
+		t.Fatalf("Failed to stat log: %v", err)
+	}
+	if err := os.Truncate(wal.path, info.Size()-2); err != nil {
+		t.Fatalf("Failed to truncate log: %v", err)
+	}
+
+	entries, err := wal.read()
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	if len(entries) != 1 || entries[0].index != 0 || string(entries[0].payload) != "first" {
+		t.Errorf("Expected only the first entry, got %v", entries)
+	}
+}
+
+// failingBackend is a memoryBackend whose Put of one index fails.
+type failingBackend struct {
+	*memoryBackend
+	index int
+}
+
+func (b *failingBackend) Put(index int, data []byte) error {
+	if index == b.index {
+		return errors.New("put failed")
+	}
+	return b.memoryBackend.Put(index, data)
+}
+
+// TestDBList_WriteAheadLogFailedPut tests that an add whose record could not be written is not
+// brought back by replaying the log when the list is reopened after a crash.
+func TestDBList_WriteAheadLogFailedPut(t *testing.T) {
+	dir := t.TempDir()
+	backend := &failingBackend{memoryBackend: newMemoryBackend(), index: 2}
+	list := NewDBList[Item](dir, 1, WithWriteAheadLog(), WithBackend(backend))
+	list.Add(Item{ID: 1})
+	list.Add(Item{ID: 2})
+	if err := list.Add(Item{ID: 3}); err == nil {
+		t.Fatal("Expected the failed put to be reported")
+	}
+
+	// The list is abandoned without Close, as after a crash
+	recovered, err := OpenDBList[Item](dir, 1, WithWriteAheadLog(), WithBackend(backend.memoryBackend))
+	if err != nil {
+		t.Fatalf("Failed to open list: %v", err)
+	}
+	if size := recovered.Size(); size != 2 {
+		t.Fatalf("Expected 2 items, got %d", size)
+	}
+	for i := range 2 {
+		if item, err := recovered.Get(i); err != nil || item.ID != i+1 {
+			t.Errorf("Get(%d): expected ID %d, got %v, err %v", i, i+1, item, err)
+		}
+	}
+}